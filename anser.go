@@ -21,12 +21,14 @@ package anser
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/mongodb/amboy"
 	"github.com/mongodb/anser/model"
 	"github.com/mongodb/grip"
 	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 // Application define the root level of a database
@@ -43,20 +45,47 @@ import (
 // function has dependencies, then the migrations it produces will
 // depend on all migrations produced by the generators dependencies.
 //
-// If the DryRun operation is set, then the application will run all
-// of the migration.
+// If the DryRun operation is set, then the application runs the
+// generators, but evaluates simple migrations without writing to the
+// documents, and reports the changes that the migrations would make.
+// The DryRunReport method returns the report of the last dry run.
 //
 // If the Limit operation is set to a value greater than 0, the
 // application will only run *that* number of jobs.
+//
+// Generators that define rollback options can be undone with the
+// Rollback method, which reverses completed migrations in the
+// opposite order of their dependencies.
+//
+// Status and Pending report the progress of the migrations. If the
+// VerifyPending option is set, Run fails when documents still match
+// a generator's query after the migrations complete.
+//
+// Setup fails if a generator depends on a generator that is not
+// defined, or if the dependencies have cycles. The Plan method
+// reports the order in which the migrations run without setting up
+// the application.
+//
+// Migrations that depend on a generator with verification options
+// do not run unless the verification passes.
+//
+// Generators with canaries only migrate a sample of their documents,
+// and the Canaries method summarizes the results.
+//
+// If the Lock option is set, Run and Rollback hold a lease in the
+// metadata database while they run, and fail (or wait, as
+// configured) if another application holds the lease.
 type Application struct {
 	Generators []Generator
 	Options    model.ApplicationOptions
 	env        Environment
 	hasSetup   bool
+	report     *DryRunReport
 }
 
 // Setup takes a configured anser.Environment implementation and
-// configures all generator.
+// configures all generator. Setup fails if the generators'
+// dependencies are not valid.
 //
 // You can only run this function once; subsequent attempts return an
 // error but are a noop otherwise.
@@ -75,23 +104,114 @@ func (a *Application) Setup(e Environment) error {
 		return errors.Wrap(err, "getting dependency tracker")
 	}
 
+	if err = checkGeneratorIDs(a.Generators); err != nil {
+		return err
+	}
+
 	for _, gen := range a.Generators {
 		network.Add(gen.ID(), gen.Dependency().Edges())
+
+		// migrations that depend on a verified migration also
+		// depend on its verification.
+		if vg, ok := gen.(verifyGenerator); ok && vg.verification() != nil {
+			network.AddGroup(gen.ID(), []string{verificationID(gen.ID())})
+		}
+	}
+
+	if err = network.Validate(); err != nil {
+		return errors.Wrap(err, "invalid migration dependencies")
 	}
 
 	a.hasSetup = true
 	return nil
 }
 
+// Plan returns the IDs of the application's generators in the order
+// that their migrations run. See the Plan function.
+func (a *Application) Plan() ([]string, error) { return Plan(a.Generators) }
+
+// Plan returns the IDs of the generators in the order that their
+// migrations run, such that every generator appears after all of the
+// generators that it depends on, without setting up or running the
+// migrations. Plan returns an error that names the generators if
+// there are duplicate generator IDs, dependencies on generators that
+// are not defined, or dependency cycles.
+func Plan(generators []Generator) ([]string, error) {
+	if err := checkGeneratorIDs(generators); err != nil {
+		return nil, err
+	}
+
+	network := newDependencyNetwork()
+	for _, gen := range generators {
+		network.Add(gen.ID(), gen.Dependency().Edges())
+	}
+
+	return planNetwork(network)
+}
+
+func planNetwork(network model.DependencyNetworker) ([]string, error) {
+	if err := network.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid migration dependencies")
+	}
+
+	return sortDependencies(network.Network())
+}
+
+func checkGeneratorIDs(generators []Generator) error {
+	catcher := grip.NewBasicCatcher()
+	seen := make(map[string]struct{}, len(generators))
+	for _, gen := range generators {
+		id := gen.ID()
+		if _, ok := seen[id]; ok {
+			catcher.Errorf("generator '%s' is defined more than once", id)
+		}
+		seen[id] = struct{}{}
+	}
+
+	return catcher.Resolve()
+}
+
 func (a *Application) Run(ctx context.Context) error {
+	ctx, unlock, err := a.lock(ctx)
+	if err != nil {
+		return errors.Wrap(err, "locking application")
+	}
+	defer unlock()
+
+	// the migrations' operations have all run when Run returns, so
+	// their rate limiters are no longer needed.
+	ids := make([]string, 0, len(a.Generators))
+	for _, generator := range a.Generators {
+		ids = append(ids, generator.ID())
+	}
+	if len(ids) > 0 {
+		defer releaseMigrationLimiters(a.env, ids...)
+	}
+
 	queue, err := a.env.GetQueue()
 	if err != nil {
 		return errors.Wrap(err, "getting queue")
 	}
 
+	canaries := a.hasCanaries()
+	verify := a.Options.VerifyPending && !a.Options.DryRun && a.Options.Limit == 0 && !canaries
+	if a.Options.VerifyPending {
+		pending, err := a.Pending(ctx)
+		if err != nil {
+			return errors.Wrap(err, "estimating pending migrations")
+		}
+
+		for id, num := range pending {
+			grip.Infof("migration %s has %d documents to migrate", id, num)
+		}
+	}
+
 	catcher := grip.NewCatcher()
 	// iterate through generators
 	for _, generator := range a.Generators {
+		if ag, ok := generator.(applicationGenerator); ok {
+			ag.setApplicationOptions(a.Options)
+		}
 		catcher.Add(queue.Put(ctx, generator))
 	}
 
@@ -104,14 +224,13 @@ func (a *Application) Run(ctx context.Context) error {
 		return errors.New("migration operation canceled")
 	}
 
-	numMigrations, err := addMigrationJobs(ctx, queue, a.Options.DryRun, a.Options.Limit)
-	if err != nil {
-		return errors.Wrap(err, "adding generated migration jobs")
+	if a.Options.DryRun {
+		return a.runDryRun(ctx, queue)
 	}
 
-	if a.Options.DryRun {
-		grip.Noticef("ending dry run, generated %d jobs in %d migrations", numMigrations, len(a.Generators))
-		return nil
+	numMigrations, err := addMigrationJobs(ctx, a.env, queue, a.Options.Limit)
+	if err != nil {
+		return errors.Wrap(err, "adding generated migration jobs")
 	}
 
 	grip.Infof("added %d migration jobs from %d migrations", numMigrations, len(a.Generators))
@@ -125,5 +244,358 @@ func (a *Application) Run(ctx context.Context) error {
 		return errors.Wrap(err, "running migration jobs")
 	}
 
+	if canaries {
+		if err := a.reportCanaries(ctx); err != nil {
+			return errors.Wrap(err, "summarizing canary migrations")
+		}
+	}
+
+	if verify {
+		return errors.Wrap(a.verifyPending(ctx), "verifying migrations")
+	}
+
 	return nil
 }
+
+// Pending counts the documents that match the query of each of the
+// application's generators, by generator ID. Before the migrations
+// run, this estimates the number of migration operations; after they
+// run, documents that still match indicate an incomplete migration
+// for migrations that modify documents so that they no longer match
+// the query.
+func (a *Application) Pending(ctx context.Context) (map[string]int, error) {
+	if !a.hasSetup {
+		return nil, errors.New("cannot count pending migrations for an application that has not been set up")
+	}
+
+	helper := NewMigrationHelper(a.env)
+	out := map[string]int{}
+	for _, gen := range a.Generators {
+		sg, ok := gen.(sourceGenerator)
+		if !ok {
+			continue
+		}
+
+		ns, query := sg.source()
+		num := helper.PendingMigrationOperations(ctx, ns, query)
+		if num < 0 {
+			return nil, errors.Errorf("could not count pending documents for '%s' in '%s'", gen.ID(), ns)
+		}
+
+		out[gen.ID()] = num
+	}
+
+	return out, nil
+}
+
+// verifyPending returns an error that names the migrations that left
+// documents matching their queries.
+func (a *Application) verifyPending(ctx context.Context) error {
+	pending, err := a.Pending(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for _, gen := range a.Generators {
+		if num := pending[gen.ID()]; num > 0 {
+			catcher.Errorf("migration '%s' is incomplete: %d documents still match its query", gen.ID(), num)
+		}
+	}
+
+	return catcher.Resolve()
+}
+
+// Rollback undoes the completed migrations of all generators that
+// define a rollback operation. Rollback walks the dependency network
+// in reverse, so that a generator's migrations are rolled back only
+// after the migrations of all generators that depend on it. Rollback
+// waits for each generator's rollback operations to complete before
+// moving on to the next generator.
+//
+// Migrations that have been rolled back are marked in the migration
+// metadata and are not rolled back again. Once all of a generator's
+// migrations are rolled back, the generator's metadata is marked as
+// well, so that migrations that depend on it do not run until it runs
+// again. If the DryRun option is set, Rollback logs the operations it
+// would have run.
+func (a *Application) Rollback(ctx context.Context) error {
+	if !a.hasSetup {
+		return errors.New("cannot roll back an application that has not been set up")
+	}
+
+	ctx, unlock, err := a.lock(ctx)
+	if err != nil {
+		return errors.Wrap(err, "locking application")
+	}
+	defer unlock()
+
+	queue, err := a.env.GetQueue()
+	if err != nil {
+		return errors.Wrap(err, "getting queue")
+	}
+
+	network, err := a.env.GetDependencyNetwork()
+	if err != nil {
+		return errors.Wrap(err, "getting dependency network")
+	}
+
+	order, err := sortDependencies(network.Network())
+	if err != nil {
+		return errors.Wrap(err, "ordering migrations")
+	}
+
+	generators := make(map[string]Generator, len(a.Generators))
+	for _, gen := range a.Generators {
+		generators[gen.ID()] = gen
+	}
+
+	helper := NewMigrationHelper(a.env)
+	count := 0
+	for idx := len(order) - 1; idx >= 0; idx-- {
+		gen, ok := generators[order[idx]]
+		if !ok {
+			continue
+		}
+
+		rg, ok := gen.(rollbackGenerator)
+		if !ok {
+			continue
+		}
+
+		events, err := getRollbackEvents(ctx, helper, gen.ID())
+		if err != nil {
+			return errors.Wrapf(err, "finding completed migrations for '%s'", gen.ID())
+		}
+
+		migrations := rg.rollbackMigrations(a.env, events)
+		if len(migrations) == 0 {
+			continue
+		}
+
+		if a.Options.DryRun {
+			for _, m := range migrations {
+				grip.Infof("dry-run: would have added %s", m.ID())
+			}
+			continue
+		}
+
+		catcher := grip.NewCatcher()
+		for _, m := range migrations {
+			catcher.Add(queue.Put(ctx, m))
+		}
+		if catcher.HasErrors() {
+			return errors.Wrapf(catcher.Resolve(), "adding rollback jobs for '%s'", gen.ID())
+		}
+		count += len(migrations)
+
+		grip.Noticef("waiting for %d rollback jobs of migration %s", len(migrations), gen.ID())
+		amboy.WaitInterval(ctx, queue, time.Second)
+		if ctx.Err() != nil {
+			return errors.New("rollback operation canceled")
+		}
+
+		// rollback jobs that fail leave their migrations'
+		// metadata as it was, and their errors are reported
+		// below.
+		remaining, err := getRollbackEvents(ctx, helper, gen.ID())
+		if err != nil {
+			return errors.Wrapf(err, "finding migrations of '%s' that were not rolled back", gen.ID())
+		}
+		if len(remaining) == 0 {
+			if err = markRolledBack(ctx, a.env, gen.ID()); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	if a.Options.DryRun {
+		grip.Notice("ending dry run of rollback")
+		return nil
+	}
+
+	grip.Infof("ran %d rollback jobs for %d migrations", count, len(a.Generators))
+	if err := amboy.ResolveErrors(ctx, queue); err != nil {
+		return errors.Wrap(err, "running rollback jobs")
+	}
+
+	return nil
+}
+
+// markRolledBack records that the migration was rolled back in the
+// metadata of its generator, so that the migrations that depend on it
+// are blocked until the generator runs again and replaces its
+// metadata.
+func markRolledBack(ctx context.Context, env Environment, migration string) error {
+	cl, err := env.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "getting database client")
+	}
+
+	ns := env.MetadataNamespace()
+	_, err = cl.Database(ns.DB).Collection(ns.Collection).UpdateOne(ctx,
+		bson.M{"_id": migration},
+		bson.M{"$set": bson.M{"rolled_back": true}})
+
+	return errors.Wrapf(err, "marking migration '%s' as rolled back", migration)
+}
+
+// getRollbackEvents returns the metadata for all migration operations
+// of the migration that completed successfully and have not been
+// rolled back, excluding the metadata of the generator itself and of
+// the migration's verification. Operations that failed after updating
+// some of their documents, such as batches whose bulk writes failed
+// part of the way through, are included with the documents that they
+// updated as their targets.
+func getRollbackEvents(ctx context.Context, helper MigrationHelper, migration string) ([]*model.MigrationMetadata, error) {
+	iter := helper.GetMigrationEvents(ctx, map[string]interface{}{
+		"_id":       map[string]interface{}{"$ne": migration},
+		"migration": migration,
+		"completed": true,
+		"$or": []interface{}{
+			map[string]interface{}{"has_errors": false},
+			map[string]interface{}{"targets.0": map[string]interface{}{"$exists": true}},
+		},
+		"rolled_back":  map[string]interface{}{"$ne": true},
+		"verification": map[string]interface{}{"$ne": true},
+	})
+
+	out := []*model.MigrationMetadata{}
+	for iter.Next(ctx) {
+		out = append(out, iter.Item())
+	}
+
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(iter.Err())
+	catcher.Add(iter.Close())
+
+	return out, catcher.Resolve()
+}
+
+// Status reports the progress of each of the application's
+// migrations, in the order of the application's generators, based on
+// the metadata that the generators and their migration operations
+// recorded. Status does not require the migrations to be running, and
+// can report on migrations that another process runs.
+func (a *Application) Status(ctx context.Context) ([]model.MigrationStatus, error) {
+	if !a.hasSetup {
+		return nil, errors.New("cannot report the status of an application that has not been set up")
+	}
+
+	ids := make([]string, 0, len(a.Generators))
+	for _, gen := range a.Generators {
+		ids = append(ids, gen.ID())
+	}
+
+	return GetMigrationStatus(ctx, a.env, ids...)
+}
+
+// GetMigrationStatus reports the progress of the migrations, in the
+// order given, from the metadata in the environment's metadata
+// namespace. Unlike the Status method, GetMigrationStatus does not
+// need an application, and so does not need the migration operations
+// to be registered.
+func GetMigrationStatus(ctx context.Context, env Environment, migrations ...string) ([]model.MigrationStatus, error) {
+	helper := NewMigrationHelper(env)
+	out := make([]model.MigrationStatus, 0, len(migrations))
+	for _, id := range migrations {
+		status, err := getMigrationStatus(ctx, helper, id)
+		if err != nil {
+			return nil, errors.Wrapf(err, "finding status of migration '%s'", id)
+		}
+
+		out = append(out, *status)
+	}
+
+	return out, nil
+}
+
+// ResetMigration removes the metadata that the migration's generator
+// and migration operations recorded, including the generator's
+// checkpoints and stop requests, so that the migration runs again
+// from the beginning the next time that an application runs it.
+// ResetMigration does not change the migrated documents, or remove
+// jobs from a queue that persists them.
+func ResetMigration(ctx context.Context, env Environment, migration string) error {
+	if migration == "" {
+		return errors.New("cannot reset a migration without a name")
+	}
+
+	cl, err := env.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "getting database client")
+	}
+
+	ns := env.MetadataNamespace()
+	_, err = cl.Database(ns.DB).Collection(ns.Collection).DeleteMany(ctx, bson.M{
+		"$or": []bson.M{
+			{"migration": migration},
+			{"generator": migration},
+		},
+	})
+
+	return errors.Wrapf(err, "removing metadata for migration '%s'", migration)
+}
+
+// getMigrationStatus summarizes the metadata of the migration's
+// generator and migration operations.
+func getMigrationStatus(ctx context.Context, helper MigrationHelper, migration string) (*model.MigrationStatus, error) {
+	iter := helper.GetMigrationEvents(ctx, map[string]interface{}{"migration": migration})
+
+	status := &model.MigrationStatus{Migration: migration}
+	for iter.Next(ctx) {
+		meta := iter.Item()
+
+		if !meta.StartedAt.IsZero() && (status.StartedAt.IsZero() || meta.StartedAt.Before(status.StartedAt)) {
+			status.StartedAt = meta.StartedAt
+		}
+		if meta.CompletedAt.After(status.CompletedAt) {
+			status.CompletedAt = meta.CompletedAt
+		}
+
+		switch {
+		case meta.ID == migration:
+			status.GeneratorCompleted = meta.Completed
+			status.Generated = meta.Generated
+		case meta.Verification:
+			if !meta.Completed {
+				continue
+			}
+			status.Verification = model.VerificationPassed
+			if meta.HasErrors {
+				status.Verification = model.VerificationFailed
+			}
+		case !meta.Completed:
+			continue
+		case meta.HasErrors:
+			status.Failed++
+		default:
+			status.Completed++
+			if meta.RolledBack {
+				status.RolledBack++
+			}
+		}
+
+		for _, err := range meta.Errors {
+			status.Errors = append(status.Errors, fmt.Sprintf("%s: %s", meta.ID, err))
+		}
+	}
+
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(iter.Err())
+	catcher.Add(iter.Close())
+	if catcher.HasErrors() {
+		return nil, catcher.Resolve()
+	}
+
+	status.Pending = status.Generated - status.Completed - status.Failed
+	if status.Pending < 0 {
+		status.Pending = 0
+	}
+
+	if !status.GeneratorCompleted || status.Pending > 0 {
+		status.CompletedAt = time.Time{}
+	}
+
+	return status, nil
+}
@@ -3,15 +3,18 @@ package anser
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/mongodb/amboy"
 	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/anser/client"
 	"github.com/mongodb/anser/mock"
 	"github.com/mongodb/anser/model"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 type ApplicationSuite struct {
@@ -59,6 +62,47 @@ func (s *ApplicationSuite) TestSetupCanGetNetwork() {
 	s.Equal(errors.Cause(err), s.env.NetworkError)
 }
 
+func (s *ApplicationSuite) TestSetupValidatesDependencies() {
+	s.env.Network.ValidateError = errors.New("cycle detected: foo -> foo")
+
+	err := s.app.Setup(s.env)
+	s.Require().Error(err)
+	s.Contains(err.Error(), "cycle detected: foo -> foo")
+	s.False(s.app.hasSetup)
+}
+
+func (s *ApplicationSuite) TestSetupRejectsDuplicateGenerators() {
+	opts := model.GeneratorOptions{JobID: "foo", NS: model.Namespace{DB: "foo", Collection: "bar"}}
+	s.app.Generators = []Generator{
+		NewSimpleMigrationGenerator(s.env, opts, nil),
+		NewSimpleMigrationGenerator(s.env, opts, nil),
+	}
+
+	err := s.app.Setup(s.env)
+	s.Require().Error(err)
+	s.Contains(err.Error(), "generator 'foo' is defined more than once")
+}
+
+func (s *ApplicationSuite) TestPlan() {
+	ns := model.Namespace{DB: "foo", Collection: "bar"}
+	s.app.Generators = []Generator{
+		NewSimpleMigrationGenerator(s.env, model.GeneratorOptions{JobID: "third", NS: ns, DependsOn: []string{"first", "second"}}, nil),
+		NewSimpleMigrationGenerator(s.env, model.GeneratorOptions{JobID: "second", NS: ns, DependsOn: []string{"first"}}, nil),
+		NewSimpleMigrationGenerator(s.env, model.GeneratorOptions{JobID: "first", NS: ns}, nil),
+	}
+
+	order, err := s.app.Plan()
+	s.Require().NoError(err)
+	s.Equal([]string{"first", "second", "third"}, order)
+
+	s.app.Generators = append(s.app.Generators,
+		NewSimpleMigrationGenerator(s.env, model.GeneratorOptions{JobID: "fourth", NS: ns, DependsOn: []string{"frist"}}, nil))
+	order, err = Plan(s.app.Generators)
+	s.Require().Error(err)
+	s.Nil(order)
+	s.Contains(err.Error(), "'fourth' depends on 'frist', which is not defined")
+}
+
 func (s *ApplicationSuite) TestRunMethodErrorsIfQueueHasError() {
 	s.env.QueueError = errors.New("problem")
 	ctx := context.Background()
@@ -90,6 +134,20 @@ func (s *ApplicationSuite) TestRunDoesNotErrorWithDryRun() {
 	s.NoError(s.app.Run(ctx))
 }
 
+func (s *ApplicationSuite) TestDryRunWritesReport() {
+	s.NoError(s.app.Setup(s.env))
+	s.Nil(s.app.DryRunReport())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.NoError(s.env.Queue.Start(ctx))
+	s.app.Options.DryRun = true
+	s.app.Options.DryRunReport = filepath.Join(s.T().TempDir(), "report.json")
+	s.Require().NoError(s.app.Run(ctx))
+	s.NotNil(s.app.DryRunReport())
+	s.FileExists(s.app.Options.DryRunReport)
+}
+
 func (s *ApplicationSuite) TestLimitIsRespected() {
 	opts := model.GeneratorOptions{}
 	job := NewManualMigrationGenerator(s.env, opts, "").(*manualMigrationGenerator)
@@ -115,7 +173,7 @@ func (s *ApplicationSuite) TestLimitIsRespected() {
 	s.Equal(1, s.env.Queue.Stats(ctx).Total)
 	s.Require().True(amboy.WaitInterval(ctx, s.env.Queue, 10*time.Millisecond))
 
-	num, err := addMigrationJobs(ctx, s.env.Queue, false, 2)
+	num, err := addMigrationJobs(ctx, s.env, s.env.Queue, 2)
 	s.Require().NoError(err)
 	s.Require().True(amboy.WaitInterval(ctx, s.env.Queue, 100*time.Millisecond))
 
@@ -125,3 +183,325 @@ func (s *ApplicationSuite) TestLimitIsRespected() {
 	s.Equal(3, s.env.Queue.Stats(ctx).Total)
 
 }
+
+func (s *ApplicationSuite) TestVerificationDependsOnAddedJobs() {
+	opts := model.GeneratorOptions{
+		JobID:  "first",
+		NS:     model.Namespace{DB: "foo", Collection: "bar"},
+		Verify: &model.VerifyOptions{Query: map[string]interface{}{"a": map[string]interface{}{"$exists": false}}},
+	}
+	job := NewSimpleMigrationGenerator(s.env, opts, map[string]interface{}{"$set": map[string]interface{}{"a": 1}}).(*simpleMigrationGenerator)
+	s.app.Generators = []Generator{job}
+	s.Require().NoError(s.app.Setup(s.env))
+	s.Contains(s.env.Network.Graph["first"], "first.verify")
+
+	for idx := 0; idx < 2; idx++ {
+		m := NewSimpleMigration(s.env, model.Simple{ID: idx, Migration: "first", Namespace: opts.NS}).(*simpleMigrationJob)
+		m.SetID(fmt.Sprintf("first.%d.%d", idx, idx))
+		job.Migrations = append(job.Migrations, m)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the mock network returns every group for every generator
+	s.env.Network = mock.NewDependencyNetwork()
+	s.env.Network.Groups = map[string][]string{"first.0.0": nil, "first.1.1": nil, "first.verify": nil}
+
+	s.NoError(s.env.Queue.Start(ctx))
+	s.NoError(s.env.Queue.Put(ctx, job))
+	s.Require().True(amboy.WaitInterval(ctx, s.env.Queue, 10*time.Millisecond))
+
+	num, err := addMigrationJobs(ctx, s.env, s.env.Queue, 1)
+	s.Require().NoError(err)
+	s.Equal(1, num)
+
+	verify, ok := s.env.Queue.Get(ctx, "first.verify")
+	s.Require().True(ok)
+	s.Equal([]string{"first.0.0"}, verify.Dependency().Edges())
+	s.True(verify.(*verifyMigrationJob).Definition.Partial)
+	s.Equal(opts.Verify.Query, verify.(*verifyMigrationJob).Definition.Query)
+}
+
+func (s *ApplicationSuite) TestRollbackRequiresSetup() {
+	err := s.app.Rollback(context.Background())
+	s.Error(err)
+	s.Contains(err.Error(), "not been set up")
+}
+
+func (s *ApplicationSuite) TestRollbackErrorsIfQueueHasError() {
+	s.env.QueueError = errors.New("problem")
+	s.NoError(s.app.Setup(s.env))
+
+	err := s.app.Rollback(context.Background())
+	s.Error(err)
+	s.Equal(errors.Cause(err), s.env.QueueError)
+}
+
+func (s *ApplicationSuite) TestRollbackWithoutCompletedMigrations() {
+	ns := model.Namespace{DB: "foo", Collection: "bar"}
+	s.app.Generators = []Generator{
+		NewSimpleMigrationGenerator(s.env, model.GeneratorOptions{
+			JobID:    "first",
+			NS:       ns,
+			Rollback: &model.RollbackOptions{Update: map[string]interface{}{"$unset": map[string]interface{}{"a": 1}}},
+		}, map[string]interface{}{"$set": map[string]interface{}{"a": 1}}),
+	}
+	s.Require().NoError(s.app.Setup(s.env))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.NoError(s.env.Queue.Start(ctx))
+
+	s.NoError(s.app.Rollback(ctx))
+	s.Equal(0, s.env.Queue.Stats(ctx).Total)
+}
+
+func (s *ApplicationSuite) TestRollbackRunsInverseOperations() {
+	ns := model.Namespace{DB: "foo", Collection: "bar"}
+	s.env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+	s.env.Client = mock.NewClient()
+	s.env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{
+		"bar": {UpdateResult: client.UpdateResult{MatchedCount: 1}},
+	}}
+	s.env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{
+		"migrations.metadata": {UpdateResult: client.UpdateResult{UpsertedCount: 1}, FindCursor: &mock.Cursor{
+			ShouldIter:   true,
+			MaxNextCalls: 3,
+			Results: []interface{}{
+				&model.MigrationMetadata{ID: "first.one.0", Migration: "first", Target: "one", Completed: true},
+				&model.MigrationMetadata{ID: "first.two.1", Migration: "first", Target: "two", Completed: true},
+			},
+		}},
+	}}
+
+	s.app.Generators = []Generator{
+		NewSimpleMigrationGenerator(s.env, model.GeneratorOptions{
+			JobID:    "first",
+			NS:       ns,
+			Rollback: &model.RollbackOptions{Update: map[string]interface{}{"$unset": map[string]interface{}{"a": 1}}},
+		}, map[string]interface{}{"$set": map[string]interface{}{"a": 1}}),
+	}
+	s.Require().NoError(s.app.Setup(s.env))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.NoError(s.env.Queue.Start(ctx))
+
+	s.NoError(s.app.Rollback(ctx))
+	stats := s.env.Queue.Stats(ctx)
+	s.Equal(2, stats.Total)
+	s.Equal(2, stats.Completed)
+
+	// the generator's metadata blocks the migrations that depend on
+	// it once all of its migrations are rolled back.
+	meta := s.env.Client.Databases["anser"].Collections["migrations.metadata"]
+	s.Require().NotEmpty(meta.Updates)
+	s.Equal(bson.M{"$set": bson.M{"rolled_back": true}}, meta.Updates[len(meta.Updates)-1])
+}
+
+func (s *ApplicationSuite) TestRollbackAfterRerun() {
+	ns := model.Namespace{DB: "foo", Collection: "bar"}
+	events := func() *mock.Cursor {
+		return &mock.Cursor{
+			ShouldIter:   true,
+			MaxNextCalls: 3,
+			Results: []interface{}{
+				&model.MigrationMetadata{ID: "first.one.0", Migration: "first", Target: "one", Completed: true},
+				&model.MigrationMetadata{ID: "first.two.1", Migration: "first", Target: "two", Completed: true},
+			},
+		}
+	}
+	s.env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+	s.env.Client = mock.NewClient()
+	s.env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{
+		"bar": {UpdateResult: client.UpdateResult{MatchedCount: 1}},
+	}}
+	meta := &mock.Collection{UpdateResult: client.UpdateResult{UpsertedCount: 1}, FindCursor: events()}
+	s.env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{
+		"migrations.metadata": meta,
+	}}
+
+	s.app.Generators = []Generator{
+		NewSimpleMigrationGenerator(s.env, model.GeneratorOptions{
+			JobID:    "first",
+			NS:       ns,
+			Rollback: &model.RollbackOptions{Update: map[string]interface{}{"$unset": map[string]interface{}{"a": 1}}},
+		}, map[string]interface{}{"$set": map[string]interface{}{"a": 1}}),
+	}
+	s.Require().NoError(s.app.Setup(s.env))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.NoError(s.env.Queue.Start(ctx))
+
+	s.NoError(s.app.Rollback(ctx))
+	s.Equal(2, s.env.Queue.Stats(ctx).Completed)
+
+	// running the migration again completes the same migration
+	// operations, which the next rollback must undo again.
+	meta.FindCursor = events()
+	s.NoError(s.app.Rollback(ctx))
+	stats := s.env.Queue.Stats(ctx)
+	s.Equal(4, stats.Total)
+	s.Equal(4, stats.Completed)
+}
+
+func (s *ApplicationSuite) TestRollbackDryRun() {
+	s.env.Client = mock.NewClient()
+	s.env.Client.Databases[""] = &mock.Database{Collections: map[string]*mock.Collection{
+		"": {FindCursor: &mock.Cursor{
+			ShouldIter:   true,
+			MaxNextCalls: 2,
+			Results: []interface{}{
+				&model.MigrationMetadata{ID: "first.0", Migration: "first", Completed: true},
+			},
+		}},
+	}}
+	s.Require().NoError(s.env.RegisterDocumentProcessor("inverse", &mock.Processor{}))
+
+	s.app.Options.DryRun = true
+	s.app.Generators = []Generator{
+		NewStreamMigrationGenerator(s.env, model.GeneratorOptions{
+			JobID:    "first",
+			NS:       model.Namespace{DB: "foo", Collection: "bar"},
+			Rollback: &model.RollbackOptions{Name: "inverse"},
+		}, "forward"),
+	}
+	s.Require().NoError(s.app.Setup(s.env))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.NoError(s.env.Queue.Start(ctx))
+
+	s.NoError(s.app.Rollback(ctx))
+	s.Equal(0, s.env.Queue.Stats(ctx).Total)
+}
+func (s *ApplicationSuite) TestStatusRequiresSetup() {
+	out, err := s.app.Status(context.Background())
+	s.Error(err)
+	s.Nil(out)
+	s.Contains(err.Error(), "not been set up")
+}
+func (s *ApplicationSuite) TestStatusSummarizesMigrationEvents() {
+	start := time.Now().Add(-time.Hour).Round(time.Second)
+	end := start.Add(time.Minute)
+
+	s.env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+	s.env.Client = mock.NewClient()
+	s.env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{
+		"migrations.metadata": {FindCursor: &mock.Cursor{
+			ShouldIter:   true,
+			MaxNextCalls: 6,
+			Results: []interface{}{
+				&model.MigrationMetadata{ID: "first", Migration: "first", Completed: true, Generated: 4, StartedAt: start, CompletedAt: start.Add(time.Second)},
+				&model.MigrationMetadata{ID: "first.verify", Migration: "first", Completed: true, Verification: true, HasErrors: true, Errors: []string{"1 documents match the verification query"}},
+				&model.MigrationMetadata{ID: "first.one.0", Migration: "first", Completed: true, StartedAt: start.Add(time.Second), CompletedAt: end},
+				&model.MigrationMetadata{ID: "first.two.1", Migration: "first", Completed: true, RolledBack: true},
+				&model.MigrationMetadata{ID: "first.three.2", Migration: "first", Completed: true, HasErrors: true, Errors: []string{"could not update"}},
+			},
+		}},
+	}}
+
+	s.app.Generators = []Generator{
+		NewSimpleMigrationGenerator(s.env, model.GeneratorOptions{
+			JobID: "first",
+			NS:    model.Namespace{DB: "foo", Collection: "bar"},
+		}, map[string]interface{}{"$set": map[string]interface{}{"a": 1}}),
+	}
+	s.Require().NoError(s.app.Setup(s.env))
+
+	out, err := s.app.Status(context.Background())
+	s.Require().NoError(err)
+	s.Require().Len(out, 1)
+
+	status := out[0]
+	s.Equal("first", status.Migration)
+	s.True(status.GeneratorCompleted)
+	s.Equal(4, status.Generated)
+	s.Equal(2, status.Completed)
+	s.Equal(1, status.RolledBack)
+	s.Equal(1, status.Failed)
+	s.Equal(1, status.Pending)
+	s.Equal(model.VerificationFailed, status.Verification)
+	s.Equal([]string{"first.verify: 1 documents match the verification query", "first.three.2: could not update"}, status.Errors)
+	s.True(start.Equal(status.StartedAt))
+	s.True(status.CompletedAt.IsZero())
+}
+func (s *ApplicationSuite) TestResetMigrationRemovesMetadata() {
+	coll := &mock.Collection{}
+	s.env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+	s.env.Client = mock.NewClient()
+	s.env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{
+		"migrations.metadata": coll,
+	}}
+
+	s.Error(ResetMigration(context.Background(), s.env, ""))
+	s.Empty(coll.Deletes)
+
+	s.Require().NoError(ResetMigration(context.Background(), s.env, "first"))
+	s.Require().Len(coll.Deletes, 1)
+	s.Equal(bson.M{"$or": []bson.M{{"migration": "first"}, {"generator": "first"}}}, coll.Deletes[0])
+
+	coll.DeleteError = errors.New("problem")
+	err := ResetMigration(context.Background(), s.env, "first")
+	s.Require().Error(err)
+	s.Contains(err.Error(), "removing metadata for migration 'first'")
+}
+func (s *ApplicationSuite) TestPendingRequiresSetup() {
+	out, err := s.app.Pending(context.Background())
+	s.Error(err)
+	s.Nil(out)
+}
+func (s *ApplicationSuite) TestPendingCountsMatchingDocuments() {
+	s.env.Client = mock.NewClient()
+	s.env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{
+		"bar": {CountResult: 7},
+	}}
+	s.app.Generators = []Generator{
+		NewSimpleMigrationGenerator(s.env, model.GeneratorOptions{
+			JobID: "first",
+			NS:    model.Namespace{DB: "foo", Collection: "bar"},
+			Query: map[string]interface{}{"a": map[string]interface{}{"$exists": false}},
+		}, map[string]interface{}{"$set": map[string]interface{}{"a": 1}}),
+	}
+	s.Require().NoError(s.app.Setup(s.env))
+
+	pending, err := s.app.Pending(context.Background())
+	s.Require().NoError(err)
+	s.Equal(map[string]int{"first": 7}, pending)
+
+	s.env.Client.Databases["foo"].Collections["bar"].CountError = errors.New("problem")
+	pending, err = s.app.Pending(context.Background())
+	s.Error(err)
+	s.Nil(pending)
+}
+func (s *ApplicationSuite) TestRunVerifiesPendingDocuments() {
+	s.env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+	s.env.Client = mock.NewClient()
+	s.env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{
+		"bar": {CountResult: 3},
+	}}
+	s.env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{
+		"migrations.metadata": {UpdateResult: client.UpdateResult{UpsertedCount: 1}},
+	}}
+	s.app.Options.VerifyPending = true
+	s.app.Generators = []Generator{
+		NewSimpleMigrationGenerator(s.env, model.GeneratorOptions{
+			JobID: "first",
+			NS:    model.Namespace{DB: "foo", Collection: "bar"},
+		}, map[string]interface{}{"$set": map[string]interface{}{"a": 1}}),
+	}
+	s.Require().NoError(s.app.Setup(s.env))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.NoError(s.env.Queue.Start(ctx))
+
+	err := s.app.Run(ctx)
+	s.Require().Error(err)
+	s.Contains(err.Error(), "migration 'first' is incomplete: 3 documents")
+
+	s.env.Client.Databases["foo"].Collections["bar"].CountResult = 0
+	s.NoError(s.app.verifyPending(ctx))
+}
@@ -0,0 +1,106 @@
+package anser
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// backpressureInterval is the minimum time between checks of the
+// cluster load, and the time that paused operations wait before they
+// check again.
+var backpressureInterval = time.Second
+
+// backpressureMonitor pauses a migration's operations while the
+// cluster load exceeds the migration's backpressure limits. A nil
+// backpressureMonitor, or one without a load source, never pauses.
+type backpressureMonitor struct {
+	opts      model.Backpressure
+	migration string
+	source    client.LoadSource
+
+	mu       sync.Mutex
+	checked  time.Time
+	exceeded []string
+}
+
+func newBackpressureMonitor(env Environment, migration string, opts model.Backpressure) *backpressureMonitor {
+	m := &backpressureMonitor{opts: opts, migration: migration}
+	if env == nil {
+		return m
+	}
+
+	src, err := getLoadSource(env)
+	grip.Warning(message.WrapError(err, message.Fields{
+		"message":   "migration will run without backpressure",
+		"migration": migration,
+	}))
+	m.source = src
+
+	return m
+}
+
+// wait blocks until the cluster load is within the backpressure
+// limits.
+func (m *backpressureMonitor) wait(ctx context.Context) error {
+	if m == nil || m.source == nil {
+		return nil
+	}
+
+	for {
+		if len(m.check(ctx)) == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(backpressureInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrap(ctx.Err(), "waiting for cluster load to subside")
+		case <-timer.C:
+		}
+	}
+}
+
+// check returns the backpressure limits that the cluster load
+// exceeds, reading the load from the source at most once per
+// interval. Migrations continue if the source cannot report the load.
+func (m *backpressureMonitor) check(ctx context.Context) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Since(m.checked) < backpressureInterval {
+		return m.exceeded
+	}
+	m.checked = time.Now()
+
+	load, err := m.source.ClusterLoad(ctx)
+	if err != nil {
+		grip.Warning(message.WrapError(err, message.Fields{
+			"message":   "could not get cluster load",
+			"migration": m.migration,
+		}))
+		m.exceeded = nil
+		return nil
+	}
+
+	exceeded := m.opts.Exceeded(load)
+	grip.InfoWhen(len(exceeded) > 0 && len(m.exceeded) == 0, message.Fields{
+		"message":   "pausing migration while the cluster is under stress",
+		"migration": m.migration,
+		"reasons":   exceeded,
+	})
+	grip.InfoWhen(len(exceeded) == 0 && len(m.exceeded) > 0, message.Fields{
+		"message":   "resuming migration",
+		"migration": m.migration,
+	})
+	m.exceeded = exceeded
+
+	return exceeded
+}
@@ -0,0 +1,209 @@
+package anser
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/evergreen-ci/birch"
+	"github.com/mongodb/anser/apm"
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBackpressureMonitor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interval := backpressureInterval
+	backpressureInterval = 5 * time.Millisecond
+	defer func() { backpressureInterval = interval }()
+
+	opts := model.Backpressure{MaxReplicationLagSeconds: 10}
+	stressed := model.ClusterLoad{ReplicationLag: time.Minute}
+
+	t.Run("NoSource", func(t *testing.T) {
+		env := mock.NewEnvironment()
+		m := newBackpressureMonitor(env, "none", opts)
+		assert.Nil(t, m.source)
+		assert.NoError(t, m.wait(ctx))
+
+		var nilMonitor *backpressureMonitor
+		assert.NoError(t, nilMonitor.wait(ctx))
+	})
+	t.Run("WithinLimits", func(t *testing.T) {
+		env := mock.NewEnvironment()
+		src := &mock.LoadSource{Load: model.ClusterLoad{ReplicationLag: time.Second}}
+		env.LoadSource = src
+
+		m := newBackpressureMonitor(env, "ok", opts)
+		assert.NoError(t, m.wait(ctx))
+		assert.NoError(t, m.wait(ctx))
+		assert.Equal(t, 1, src.NumCalls())
+	})
+	t.Run("PausesUntilLoadSubsides", func(t *testing.T) {
+		env := mock.NewEnvironment()
+		src := &mock.LoadSource{Load: stressed}
+		env.LoadSource = src
+
+		m := newBackpressureMonitor(env, "paused", opts)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			src.SetLoad(model.ClusterLoad{})
+		}()
+
+		start := time.Now()
+		assert.NoError(t, m.wait(ctx))
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+		assert.True(t, src.NumCalls() > 1)
+	})
+	t.Run("Canceled", func(t *testing.T) {
+		env := mock.NewEnvironment()
+		env.LoadSource = &mock.LoadSource{Load: stressed}
+
+		m := newBackpressureMonitor(env, "canceled", opts)
+		tctx, tcancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer tcancel()
+		assert.Error(t, m.wait(tctx))
+	})
+	t.Run("SourceError", func(t *testing.T) {
+		env := mock.NewEnvironment()
+		env.LoadSource = &mock.LoadSource{Load: stressed, Error: errors.New("no status")}
+
+		m := newBackpressureMonitor(env, "error", opts)
+		assert.NoError(t, m.wait(ctx))
+	})
+	t.Run("Limiter", func(t *testing.T) {
+		env := mock.NewEnvironment()
+		env.LoadSource = &mock.LoadSource{Load: stressed}
+
+		limiter := getMigrationLimiter(env, "backpressure", &model.RateLimit{Backpressure: opts})
+		require.NotNil(t, limiter)
+		require.NotNil(t, limiter.backpressure)
+
+		_, ok := limiter.client(mock.NewClient()).(*rateLimitedClient)
+		assert.True(t, ok)
+
+		tctx, tcancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer tcancel()
+		assert.Error(t, limiter.start(tctx))
+		assert.Error(t, limiter.waitDocuments(tctx, 1))
+		assert.Error(t, limiter.waitWrites(tctx, 1))
+	})
+}
+
+func TestServerStatusLoadSource(t *testing.T) {
+	ctx := context.Background()
+
+	command := func(t *testing.T, doc interface{}) *mock.SingleResult {
+		raw, err := bson.Marshal(doc)
+		require.NoError(t, err)
+		return &mock.SingleResult{DecodeBytesValue: raw}
+	}
+
+	now := time.Now().Truncate(time.Millisecond)
+	replStatus := bson.M{"members": bson.A{
+		bson.M{"stateStr": "PRIMARY", "optimeDate": now},
+		bson.M{"stateStr": "SECONDARY", "optimeDate": now.Add(-5 * time.Second)},
+		bson.M{"stateStr": "SECONDARY", "optimeDate": now.Add(-time.Second)},
+		bson.M{"stateStr": "ARBITER"},
+	}}
+	serverStatus := bson.M{"wiredTiger": bson.M{"cache": bson.M{
+		"maximum bytes configured":         int64(1000),
+		"bytes currently in the cache":     int32(800),
+		"tracked dirty bytes in the cache": 50.0,
+	}}}
+
+	t.Run("ReplicaSet", func(t *testing.T) {
+		cl := mock.NewClient()
+		cl.Databases["admin"] = &mock.Database{DBName: "admin", Commands: map[string]*mock.SingleResult{
+			"replSetGetStatus": command(t, replStatus),
+			"serverStatus":     command(t, serverStatus),
+		}}
+
+		load, err := client.NewServerStatusLoadSource(cl).ClusterLoad(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 5*time.Second, load.ReplicationLag)
+		assert.Equal(t, 0.8, load.CacheUsedRatio)
+		assert.Equal(t, 0.05, load.CacheDirtyRatio)
+	})
+	t.Run("Standalone", func(t *testing.T) {
+		cl := mock.NewClient()
+		cl.Databases["admin"] = &mock.Database{DBName: "admin", Commands: map[string]*mock.SingleResult{
+			"replSetGetStatus": {ErrorValue: mongo.CommandError{Code: 76, Message: "not running with --replSet"}},
+		}}
+
+		load, err := client.NewServerStatusLoadSource(cl).ClusterLoad(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, model.ClusterLoad{}, load)
+	})
+	t.Run("CommandError", func(t *testing.T) {
+		cl := mock.NewClient()
+		cl.Databases["admin"] = &mock.Database{DBName: "admin", Commands: map[string]*mock.SingleResult{
+			"serverStatus": {ErrorValue: errors.New("unauthorized")},
+		}}
+
+		_, err := client.NewServerStatusLoadSource(cl).ClusterLoad(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unauthorized")
+	})
+}
+
+type mockMonitor struct {
+	doc *birch.Document
+}
+
+func (m *mockMonitor) DriverAPM() *event.CommandMonitor { return nil }
+func (m *mockMonitor) Rotate() apm.Event                { return m }
+func (m *mockMonitor) Message() message.Composer        { return message.NewString("") }
+func (m *mockMonitor) Document() *birch.Document        { return m.doc }
+
+func TestMonitorLoadSource(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Empty", func(t *testing.T) {
+		src := client.NewMonitorLoadSource(&mockMonitor{doc: birch.DC.Elements(birch.EC.SubDocument("events", birch.DC.Make(0)))})
+		load, err := src.ClusterLoad(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, model.ClusterLoad{}, load)
+	})
+	t.Run("Events", func(t *testing.T) {
+		doc := birch.DC.Elements(birch.EC.SubDocument("events", birch.DC.Elements(
+			birch.EC.SubDocument("foo.bar.find", birch.DC.Elements(
+				birch.EC.Int64("failed", 1),
+				birch.EC.Int64("success", 2),
+				birch.EC.Duration("duration", 30*time.Millisecond),
+			)),
+			birch.EC.SubDocument("foo.bar.update", birch.DC.Elements(
+				birch.EC.Int64("failed", 0),
+				birch.EC.Int64("success", 1),
+				birch.EC.Duration("duration", 10*time.Millisecond),
+			)),
+		)))
+
+		load, err := client.NewMonitorLoadSource(&mockMonitor{doc: doc}).ClusterLoad(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0.25, load.FailureRate)
+		assert.Equal(t, 10*time.Millisecond, load.Latency)
+	})
+	t.Run("Merged", func(t *testing.T) {
+		src := client.MergeLoadSources(
+			&mock.LoadSource{Load: model.ClusterLoad{ReplicationLag: time.Second, FailureRate: 0.5}},
+			&mock.LoadSource{Load: model.ClusterLoad{ReplicationLag: time.Minute}},
+		)
+		load, err := src.ClusterLoad(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, model.ClusterLoad{ReplicationLag: time.Minute, FailureRate: 0.5}, load)
+
+		_, err = client.MergeLoadSources(&mock.LoadSource{Error: errors.New("failed")}).ClusterLoad(ctx)
+		assert.Error(t, err)
+	})
+}
@@ -1,7 +1,10 @@
 package backup
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"path/filepath"
 	"time"
@@ -11,6 +14,7 @@ import (
 	"github.com/mongodb/grip"
 	"github.com/mongodb/grip/message"
 	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -22,35 +26,95 @@ type WriterCreator func(context.Context, string) (io.WriteCloser, error)
 
 // Options describes the configuration of the backup, for a single
 // collection. Query, Sort, and Limit are optional, but allow you to
-// constrain the backup.
+// constrain the backup. When Compress is set, the backup's files are
+// compressed with gzip and have a ".gz" suffix, as with mongodump's
+// --gzip option. When Incremental is set, the backup only holds the
+// documents after its high-water mark; see IncrementalOptions.
 type Options struct {
-	NS            model.Namespace `bson:"ns" json:"ns" yaml:"ns"`
-	Target        WriterCreator   `bson:"-" json:"-" yaml:"-"`
-	Query         interface{}     `bson:"query" json:"query" yaml:"query"`
-	Sort          interface{}     `bson:"sort" json:"sort" yaml:"sort"`
-	Limit         int64           `bson:"limit" json:"limit" yaml:"limit"`
-	IndexesOnly   bool            `bson:"indexes_only" json:"indexes_only" yaml:"indexes_only"`
-	EnableLogging bool            `bson:"enable_logging" json:"enable_logging" yaml:"enable_logging"`
+	NS            model.Namespace     `bson:"ns" json:"ns" yaml:"ns"`
+	Target        WriterCreator       `bson:"-" json:"-" yaml:"-"`
+	Query         interface{}         `bson:"query" json:"query" yaml:"query"`
+	Sort          interface{}         `bson:"sort" json:"sort" yaml:"sort"`
+	Limit         int64               `bson:"limit" json:"limit" yaml:"limit"`
+	IndexesOnly   bool                `bson:"indexes_only" json:"indexes_only" yaml:"indexes_only"`
+	Compress      bool                `bson:"compress" json:"compress" yaml:"compress"`
+	Incremental   *IncrementalOptions `bson:"incremental,omitempty" json:"incremental,omitempty" yaml:"incremental,omitempty"`
+	EnableLogging bool                `bson:"enable_logging" json:"enable_logging" yaml:"enable_logging"`
+
+	// session, if set, is the snapshot session that the backup
+	// reads the documents in.
+	session mongo.Session
 }
 
 // Collection creates a backup of a collection using the options to
 // describe how to filter or constrain the backup. The option's Target
 // value allows you to produce a writer where the backup will be collected.
 func Collection(ctx context.Context, client *mongo.Client, opts Options) error {
-	if err := opts.flushData(ctx, client); err != nil {
-		return errors.WithStack(err)
+	_, err := opts.backup(ctx, client)
+	return err
+}
+
+func (opts *Options) backup(ctx context.Context, client *mongo.Client) (*ManifestEntry, error) {
+	if opts.Incremental != nil {
+		if err := opts.Incremental.apply(opts); err != nil {
+			return nil, errors.Wrap(err, "invalid incremental backup")
+		}
+	}
+
+	entry, err := opts.flushData(ctx, client)
+	if err != nil {
+		return nil, errors.WithStack(err)
 	}
 
 	idxes, err := opts.getIndexData(ctx, client)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 
 	if err := opts.writeIndexData(ctx, idxes); err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 
-	return nil
+	return entry, nil
+}
+
+// fileName returns the name of one of the files of a namespace's
+// backup.
+func fileName(ns model.Namespace, ext string, compress bool) string {
+	name := filepath.Join(ns.DB, ns.Collection) + ext
+	if compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// target opens the named file of the backup, compressing what is
+// written to it if the backup is compressed.
+func (opts *Options) target(ctx context.Context, ext string) (io.WriteCloser, error) {
+	target, err := opts.Target(ctx, fileName(opts.NS, ext, opts.Compress))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if !opts.Compress {
+		return target, nil
+	}
+
+	return &gzipWriter{Writer: gzip.NewWriter(target), target: target}, nil
+}
+
+// gzipWriter closes the underlying writer after it flushes the
+// compressed stream.
+type gzipWriter struct {
+	*gzip.Writer
+	target io.WriteCloser
+}
+
+func (w *gzipWriter) Close() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(w.Writer.Close())
+	catcher.Add(w.target.Close())
+	return catcher.Resolve()
 }
 
 func (opts *Options) getQueryOpts() *options.FindOptions {
@@ -68,6 +132,10 @@ func (opts *Options) getQueryOpts() *options.FindOptions {
 }
 
 func (opts *Options) getCursor(ctx context.Context, client *mongo.Client) (*mongo.Cursor, error) {
+	if opts.session != nil {
+		ctx = mongo.NewSessionContext(ctx, opts.session)
+	}
+
 	cursor, err := client.Database(opts.NS.DB).Collection(opts.NS.Collection).Find(ctx, opts.Query, opts.getQueryOpts())
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -76,13 +144,15 @@ func (opts *Options) getCursor(ctx context.Context, client *mongo.Client) (*mong
 	return cursor, nil
 }
 
-func (opts *Options) flushData(ctx context.Context, client *mongo.Client) error {
+func (opts *Options) flushData(ctx context.Context, client *mongo.Client) (*ManifestEntry, error) {
+	entry := &ManifestEntry{NS: opts.NS, Compressed: opts.Compress}
 	if opts.IndexesOnly {
-		return nil
+		return entry, nil
 	}
 	var (
 		count int64
 		seen  int64
+		mark  bson.RawValue
 		err   error
 	)
 
@@ -90,12 +160,12 @@ func (opts *Options) flushData(ctx context.Context, client *mongo.Client) error
 		if opts.Query == nil {
 			count, err = client.Database(opts.NS.DB).Collection(opts.NS.Collection).EstimatedDocumentCount(ctx)
 			if err != nil {
-				return errors.WithStack(err)
+				return nil, errors.WithStack(err)
 			}
 		} else {
 			count, err = client.Database(opts.NS.DB).Collection(opts.NS.Collection).CountDocuments(ctx, opts.Query)
 			if err != nil {
-				return errors.WithStack(err)
+				return nil, errors.WithStack(err)
 			}
 		}
 	}
@@ -103,15 +173,18 @@ func (opts *Options) flushData(ctx context.Context, client *mongo.Client) error
 	catcher := grip.NewCatcher()
 	cursor, err := opts.getCursor(ctx, client)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 	defer func() { catcher.Add(cursor.Close(ctx)) }()
 
-	target, err := opts.Target(ctx, filepath.Join(opts.NS.DB, opts.NS.Collection)+".bson")
+	target, err := opts.target(ctx, ".bson")
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
-	defer func() { catcher.Add(target.Close()) }()
+	// the checksum covers the uncompressed documents, so that it
+	// doesn't depend on whether the backup is compressed.
+	checksum := sha256.New()
+	out := io.MultiWriter(target, checksum)
 
 	grip.InfoWhen(opts.EnableLogging, message.Fields{
 		"ns":       opts.NS.String(),
@@ -121,13 +194,21 @@ func (opts *Options) flushData(ctx context.Context, client *mongo.Client) error
 	})
 
 	for cursor.Next(ctx) {
-		_, err := target.Write(cursor.Current)
+		_, err := out.Write(cursor.Current)
 		if err != nil {
 			catcher.Add(err)
 			break
 		}
 
 		seen++
+		if opts.Incremental != nil {
+			// documents are in order of the field, so the last
+			// document with the field has the greatest value.
+			if val := cursor.Current.Lookup(opts.Incremental.path()...); val.Type != 0 {
+				mark = val
+			}
+		}
+
 		if opts.EnableLogging && seen%1000 == 0 {
 			grip.Info(message.Fields{
 				"ns":       opts.NS.String(),
@@ -146,7 +227,16 @@ func (opts *Options) flushData(ctx context.Context, client *mongo.Client) error
 	})
 
 	catcher.Add(cursor.Err())
-	return catcher.Resolve()
+	// closing the target flushes compressed backups, so the error
+	// must be part of the result.
+	catcher.Add(target.Close())
+	entry.Documents = seen
+	entry.Checksum = hex.EncodeToString(checksum.Sum(nil))
+	if opts.Incremental != nil {
+		entry.Increment = opts.Incremental.increment(mark)
+	}
+
+	return entry, catcher.Resolve()
 }
 
 func (opts *Options) getIndexData(ctx context.Context, client *mongo.Client) (*birch.Array, error) {
@@ -183,18 +273,15 @@ func (opts *Options) writeIndexData(ctx context.Context, indexes *birch.Array) e
 		return errors.WithStack(err)
 	}
 
-	target, err := opts.Target(ctx, filepath.Join(opts.NS.DB, opts.NS.Collection)+".metadata.json")
+	target, err := opts.target(ctx, ".metadata.json")
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
 	catcher := grip.NewCatcher()
-	defer func() { catcher.Add(target.Close()) }()
 	_, err = target.Write(out)
-	if err != nil {
-		catcher.Add(err)
-		return catcher.Resolve()
-	}
+	catcher.Add(err)
+	catcher.Add(target.Close())
 
 	return catcher.Resolve()
 }
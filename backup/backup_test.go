@@ -41,6 +41,15 @@ func (mf fileCache) TargetErrors(context.Context, string) (io.WriteCloser, error
 	return nil, errors.New("always")
 }
 
+func (mf fileCache) Source(ctx context.Context, name string) (io.ReadCloser, error) {
+	buf, ok := mf[name]
+	if !ok {
+		return nil, errors.Errorf("no file named '%s'", name)
+	}
+
+	return &closableBuffer{Buffer: *bytes.NewBuffer(buf.Bytes())}, nil
+}
+
 func newDocument(doc *birch.Document, numKeys, otherNum int) *birch.Document {
 	if doc == nil {
 		doc = birch.DC.Make(numKeys * 3)
@@ -233,6 +242,123 @@ func TestBackup(t *testing.T) {
 		require.NotContains(t, files, "foo/noop.bson")
 		require.NotContains(t, files, "foo/noop.metadata.json")
 	})
+	t.Run("RestoreRoundTrip", func(t *testing.T) {
+		defer func() { require.NoError(t, client.Database("foo").Collection("bak").Drop(ctx)) }()
+		defer func() { require.NoError(t, client.Database("foo").Collection("rst").Drop(ctx)) }()
+
+		coll := client.Database("foo").Collection("bak")
+		_, err = coll.InsertMany(ctx, produceDocuments(nil, 10))
+		require.NoError(t, err)
+		_, err = coll.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: birch.DC.Elements(birch.EC.Int("a", 1))})
+		require.NoError(t, err)
+
+		err = Collection(ctx, client, Options{
+			NS:     model.Namespace{DB: "foo", Collection: "bak"},
+			Target: files.Target,
+		})
+		require.NoError(t, err)
+
+		opts := RestoreOptions{
+			NS:        model.Namespace{DB: "foo", Collection: "bak"},
+			Into:      model.Namespace{DB: "foo", Collection: "rst"},
+			Source:    files.Source,
+			BatchSize: 3,
+		}
+		require.NoError(t, Restore(ctx, client, opts))
+
+		var count int64
+		count, err = client.Database("foo").Collection("rst").CountDocuments(ctx, struct{}{})
+		require.NoError(t, err)
+		assert.EqualValues(t, 10, count)
+
+		specs, err := client.Database("foo").Collection("rst").Indexes().ListSpecifications(ctx)
+		require.NoError(t, err)
+		assert.Len(t, specs, 2)
+
+		assert.Error(t, Restore(ctx, client, opts))
+		opts.Upsert = true
+		assert.NoError(t, Restore(ctx, client, opts))
+	})
+	t.Run("Collections", func(t *testing.T) {
+		defer func() { require.NoError(t, client.Database("multi").Drop(ctx)) }()
+
+		for _, name := range []string{"one", "two", "skip"} {
+			_, err = client.Database("multi").Collection(name).InsertMany(ctx, produceDocuments(nil, 5))
+			require.NoError(t, err)
+		}
+
+		multiFiles := fileCache{}
+		var manifest *Manifest
+		manifest, err = Collections(ctx, client, CollectionsOptions{
+			DB:       "multi",
+			Exclude:  []string{"skip"},
+			Target:   multiFiles.Target,
+			Workers:  2,
+			Compress: true,
+		})
+		require.NoError(t, err)
+		require.Len(t, manifest.Collections, 2)
+		for _, entry := range manifest.Collections {
+			assert.EqualValues(t, 5, entry.Documents)
+			assert.NotEmpty(t, entry.Checksum)
+			assert.True(t, entry.Compressed)
+			assert.Contains(t, multiFiles, fileName(entry.NS, ".bson", true))
+		}
+		assert.Contains(t, multiFiles, ManifestFileName)
+		assert.NotContains(t, multiFiles, "multi/skip.bson.gz")
+
+		require.NoError(t, Restore(ctx, client, RestoreOptions{
+			NS:       model.Namespace{DB: "multi", Collection: "one"},
+			Into:     model.Namespace{DB: "multi", Collection: "restored"},
+			Source:   multiFiles.Source,
+			Compress: true,
+		}))
+		var count int64
+		count, err = client.Database("multi").Collection("restored").CountDocuments(ctx, struct{}{})
+		require.NoError(t, err)
+		assert.EqualValues(t, 5, count)
+	})
+	t.Run("IncrementalLayers", func(t *testing.T) {
+		defer func() { require.NoError(t, client.Database("incr").Drop(ctx)) }()
+
+		coll := client.Database("incr").Collection("docs")
+		for i := 0; i < 5; i++ {
+			_, err = coll.InsertOne(ctx, birch.DC.Elements(birch.EC.Int("_id", i), birch.EC.Int("v", 0)))
+			require.NoError(t, err)
+		}
+
+		base := fileCache{}
+		var manifest *Manifest
+		manifest, err = Collections(ctx, client, CollectionsOptions{DB: "incr", Target: base.Target, IncrementalField: "_id"})
+		require.NoError(t, err)
+		entry := manifest.Entry(model.Namespace{DB: "incr", Collection: "docs"})
+		require.NotNil(t, entry)
+		require.NotNil(t, entry.Increment)
+		assert.EqualValues(t, 5, entry.Documents)
+
+		for i := 5; i < 8; i++ {
+			_, err = coll.InsertOne(ctx, birch.DC.Elements(birch.EC.Int("_id", i), birch.EC.Int("v", 1)))
+			require.NoError(t, err)
+		}
+
+		layer := fileCache{}
+		manifest, err = Collections(ctx, client, CollectionsOptions{DB: "incr", Target: layer.Target, IncrementalField: "_id", Since: manifest})
+		require.NoError(t, err)
+		entry = manifest.Entry(model.Namespace{DB: "incr", Collection: "docs"})
+		require.NotNil(t, entry)
+		assert.EqualValues(t, 3, entry.Documents)
+
+		require.NoError(t, Restore(ctx, client, RestoreOptions{
+			NS:     model.Namespace{DB: "incr", Collection: "docs"},
+			Into:   model.Namespace{DB: "incr", Collection: "restored"},
+			Source: base.Source,
+			Layers: []ReaderCreator{layer.Source},
+		}))
+		var count int64
+		count, err = client.Database("incr").Collection("restored").CountDocuments(ctx, struct{}{})
+		require.NoError(t, err)
+		assert.EqualValues(t, 8, count)
+	})
 	t.Run("QueryOptions", func(t *testing.T) {
 		opts := &Options{
 			Sort:  birch.DC.Elements(birch.EC.Int("a", 1)),
@@ -0,0 +1,325 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ManifestFileName is the name of the file that Collections writes
+// its manifest to.
+const ManifestFileName = "manifest.json"
+
+// Manifest describes the contents of a backup of several namespaces.
+// ClusterTime is the cluster time that the documents of a snapshot
+// backup were read at, and otherwise the cluster time from before the
+// backup read any documents, so that changes made during the backup
+// can be found in the oplog. ClusterTime is zero for deployments that
+// do not report cluster times, such as standalone servers.
+type Manifest struct {
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at" yaml:"created_at"`
+	ClusterTime primitive.Timestamp `bson:"cluster_time" json:"cluster_time" yaml:"cluster_time"`
+	Snapshot    bool                `bson:"snapshot" json:"snapshot" yaml:"snapshot"`
+	Collections []ManifestEntry     `bson:"collections" json:"collections" yaml:"collections"`
+}
+
+// ManifestEntry describes the backup of one namespace. The checksum
+// is the hex-encoded SHA-256 sum of the namespace's documents, as
+// they are before compression. Increment is only set for incremental
+// backups.
+type ManifestEntry struct {
+	NS         model.Namespace `bson:"ns" json:"ns" yaml:"ns"`
+	Documents  int64           `bson:"documents" json:"documents" yaml:"documents"`
+	Checksum   string          `bson:"checksum,omitempty" json:"checksum,omitempty" yaml:"checksum,omitempty"`
+	Compressed bool            `bson:"compressed" json:"compressed" yaml:"compressed"`
+	Increment  *Increment      `bson:"increment,omitempty" json:"increment,omitempty" yaml:"increment,omitempty"`
+}
+
+// Entry returns the manifest's entry for the namespace, or nil if the
+// backup does not include the namespace.
+func (m *Manifest) Entry(ns model.Namespace) *ManifestEntry {
+	for idx := range m.Collections {
+		if m.Collections[idx].NS == ns {
+			return &m.Collections[idx]
+		}
+	}
+
+	return nil
+}
+
+// CollectionsOptions describes a backup of several namespaces: either
+// the namespaces in Namespaces, or the collections in DB whose names
+// match one of the Include patterns (or any name, if there are none)
+// and none of the Exclude patterns. Patterns use the syntax of
+// path.Match. Query, Sort, and Limit, if set, constrain the documents
+// of every namespace in the backup, as they do for Collection. Workers
+// sets the number of namespaces that are backed up at once, and
+// defaults to the number of CPUs.
+//
+// When Snapshot is set, the backup reads the documents of every
+// namespace in one session with the snapshot read concern, so that the
+// backup holds the namespaces as they were at a single point in time.
+// Snapshot reads require a replica set or sharded cluster, and must
+// finish within the server's snapshot history window. Because a
+// session cannot be used concurrently, snapshot backups read one
+// namespace at a time.
+//
+// When IncrementalField is set, the backup is incremental, and holds
+// the documents with greater values of the field than the high-water
+// marks that the Since manifest recorded for each namespace, or, for
+// namespaces that Since does not include, every document with the
+// field.
+type CollectionsOptions struct {
+	Namespaces       []model.Namespace `bson:"namespaces" json:"namespaces" yaml:"namespaces"`
+	DB               string            `bson:"db" json:"db" yaml:"db"`
+	Include          []string          `bson:"include" json:"include" yaml:"include"`
+	Exclude          []string          `bson:"exclude" json:"exclude" yaml:"exclude"`
+	Query            interface{}       `bson:"query,omitempty" json:"query,omitempty" yaml:"query,omitempty"`
+	Sort             interface{}       `bson:"sort,omitempty" json:"sort,omitempty" yaml:"sort,omitempty"`
+	Limit            int64             `bson:"limit,omitempty" json:"limit,omitempty" yaml:"limit,omitempty"`
+	Target           WriterCreator     `bson:"-" json:"-" yaml:"-"`
+	Workers          int               `bson:"workers" json:"workers" yaml:"workers"`
+	IndexesOnly      bool              `bson:"indexes_only" json:"indexes_only" yaml:"indexes_only"`
+	Compress         bool              `bson:"compress" json:"compress" yaml:"compress"`
+	Snapshot         bool              `bson:"snapshot" json:"snapshot" yaml:"snapshot"`
+	IncrementalField string            `bson:"incremental_field" json:"incremental_field" yaml:"incremental_field"`
+	Since            *Manifest         `bson:"since,omitempty" json:"since,omitempty" yaml:"since,omitempty"`
+	EnableLogging    bool              `bson:"enable_logging" json:"enable_logging" yaml:"enable_logging"`
+}
+
+// Validate checks that the options describe a backup, and sets the
+// defaults of unset options.
+func (opts *CollectionsOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(len(opts.Namespaces) == 0 && opts.DB == "", "must specify namespaces or a database")
+	catcher.NewWhen(len(opts.Namespaces) > 0 && opts.DB != "", "cannot specify both namespaces and a database")
+	catcher.NewWhen(len(opts.Namespaces) > 0 && len(opts.Include)+len(opts.Exclude) > 0, "can only filter the collections of a database")
+	catcher.NewWhen(opts.Target == nil, "must specify a target for the backup")
+	catcher.NewWhen(opts.Workers < 0, "cannot have a negative number of workers")
+	catcher.NewWhen(opts.Limit < 0, "cannot have a negative limit")
+	catcher.NewWhen(opts.Snapshot && opts.Workers > 1, "snapshot backups can only use one worker")
+	catcher.NewWhen(opts.Since != nil && opts.IncrementalField == "", "must specify the field of an incremental backup")
+	for _, ns := range opts.Namespaces {
+		catcher.ErrorfWhen(!ns.IsValid(), "namespace '%s' is not valid", ns)
+	}
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		_, err := path.Match(pattern, "")
+		catcher.Wrapf(err, "invalid pattern '%s'", pattern)
+	}
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	if opts.Workers == 0 {
+		opts.Workers = runtime.NumCPU()
+		if opts.Snapshot {
+			opts.Workers = 1
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether the backup includes the collection of the
+// database.
+func (opts *CollectionsOptions) matches(collection string) bool {
+	if strings.HasPrefix(collection, "system.") {
+		return false
+	}
+
+	included := len(opts.Include) == 0
+	for _, pattern := range opts.Include {
+		if ok, _ := path.Match(pattern, collection); ok {
+			included = true
+			break
+		}
+	}
+
+	for _, pattern := range opts.Exclude {
+		if ok, _ := path.Match(pattern, collection); ok {
+			return false
+		}
+	}
+
+	return included
+}
+
+// incremental returns the options of the namespace's incremental
+// backup, which continues from the mark of the previous backup.
+func (opts *CollectionsOptions) incremental(ns model.Namespace) *IncrementalOptions {
+	if opts.IncrementalField == "" {
+		return nil
+	}
+
+	out := &IncrementalOptions{Field: opts.IncrementalField}
+	if opts.Since == nil {
+		return out
+	}
+
+	if entry := opts.Since.Entry(ns); entry != nil && entry.Increment != nil && entry.Increment.Field == opts.IncrementalField {
+		out.After = entry.Increment.Mark
+	}
+
+	return out
+}
+
+func (opts *CollectionsOptions) getNamespaces(ctx context.Context, client *mongo.Client) ([]model.Namespace, error) {
+	if len(opts.Namespaces) > 0 {
+		return opts.Namespaces, nil
+	}
+
+	names, err := client.Database(opts.DB).ListCollectionNames(ctx, bson.M{"type": "collection"})
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing collections of '%s'", opts.DB)
+	}
+	sort.Strings(names)
+
+	out := []model.Namespace{}
+	for _, name := range names {
+		if opts.matches(name) {
+			out = append(out, model.Namespace{DB: opts.DB, Collection: name})
+		}
+	}
+
+	return out, nil
+}
+
+// Collections creates backups of several namespaces at once, in the
+// same layout as Collection, and then writes a manifest of the
+// backup, with the number of documents and checksum of each
+// namespace, to ManifestFileName. Collections does not write the
+// manifest if the backup of any namespace fails.
+func Collections(ctx context.Context, client *mongo.Client, opts CollectionsOptions) (*Manifest, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid backup options")
+	}
+
+	namespaces, err := opts.getNamespaces(ctx, client)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	manifest := &Manifest{
+		CreatedAt:   time.Now(),
+		Snapshot:    opts.Snapshot,
+		Collections: make([]ManifestEntry, len(namespaces)),
+	}
+
+	manifest.ClusterTime, err = clusterTime(ctx, client)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var session mongo.Session
+	if opts.Snapshot {
+		session, err = client.StartSession(options.Session().SetSnapshot(true))
+		if err != nil {
+			return nil, errors.Wrap(err, "starting snapshot session")
+		}
+		defer session.EndSession(ctx)
+	}
+
+	work := make(chan int)
+	catcher := grip.NewCatcher()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range work {
+				nsOpts := Options{
+					NS:            namespaces[idx],
+					Target:        opts.Target,
+					Query:         opts.Query,
+					Sort:          opts.Sort,
+					Limit:         opts.Limit,
+					IndexesOnly:   opts.IndexesOnly,
+					Compress:      opts.Compress,
+					EnableLogging: opts.EnableLogging,
+					Incremental:   opts.incremental(namespaces[idx]),
+					session:       session,
+				}
+
+				entry, err := nsOpts.backup(ctx, client)
+				if err != nil {
+					catcher.Wrapf(err, "backing up '%s'", namespaces[idx])
+					continue
+				}
+				manifest.Collections[idx] = *entry
+			}
+		}()
+	}
+
+	for idx := range namespaces {
+		work <- idx
+	}
+	close(work)
+	wg.Wait()
+
+	if catcher.HasErrors() {
+		return nil, catcher.Resolve()
+	}
+
+	// the operation time of a snapshot session is the time of its
+	// snapshot, once the session has read any documents.
+	if session != nil && session.OperationTime() != nil {
+		manifest.ClusterTime = *session.OperationTime()
+	}
+
+	if err = writeManifest(ctx, opts.Target, manifest); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	grip.InfoWhen(opts.EnableLogging, message.Fields{
+		"message":    "completed backup",
+		"namespaces": len(namespaces),
+		"snapshot":   opts.Snapshot,
+		"dur_secs":   time.Since(manifest.CreatedAt).Seconds(),
+	})
+
+	return manifest, nil
+}
+
+// clusterTime returns the current cluster time of the deployment, or
+// a zero timestamp if the deployment does not report cluster times.
+func clusterTime(ctx context.Context, client *mongo.Client) (primitive.Timestamp, error) {
+	res := struct {
+		OperationTime primitive.Timestamp `bson:"operationTime"`
+	}{}
+
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "ping", Value: 1}}).Decode(&res)
+	return res.OperationTime, errors.Wrap(err, "finding cluster time")
+}
+
+func writeManifest(ctx context.Context, target WriterCreator, manifest *Manifest) error {
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding manifest")
+	}
+
+	w, err := target(ctx, ManifestFileName)
+	if err != nil {
+		return errors.Wrap(err, "opening manifest")
+	}
+
+	catcher := grip.NewBasicCatcher()
+	_, err = w.Write(out)
+	catcher.Wrap(err, "writing manifest")
+	catcher.Wrap(w.Close(), "closing manifest")
+
+	return catcher.Resolve()
+}
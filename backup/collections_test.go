@@ -0,0 +1,90 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/evergreen-ci/birch"
+	"github.com/mongodb/anser/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCollections(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ns := model.Namespace{DB: "foo", Collection: "bar"}
+
+	t.Run("Validate", func(t *testing.T) {
+		files := fileCache{}
+		opts := CollectionsOptions{DB: "foo", Include: []string{"ba*"}, Target: files.Target}
+		require.NoError(t, opts.Validate())
+		assert.True(t, opts.Workers > 0)
+
+		assert.NoError(t, (&CollectionsOptions{Namespaces: []model.Namespace{ns}, Target: files.Target}).Validate())
+		assert.Error(t, (&CollectionsOptions{Target: files.Target}).Validate())
+		assert.Error(t, (&CollectionsOptions{DB: "foo"}).Validate())
+		assert.Error(t, (&CollectionsOptions{DB: "foo", Namespaces: []model.Namespace{ns}, Target: files.Target}).Validate())
+		assert.Error(t, (&CollectionsOptions{Namespaces: []model.Namespace{ns}, Exclude: []string{"bar"}, Target: files.Target}).Validate())
+		assert.Error(t, (&CollectionsOptions{Namespaces: []model.Namespace{{DB: "foo"}}, Target: files.Target}).Validate())
+		assert.Error(t, (&CollectionsOptions{DB: "foo", Include: []string{"["}, Target: files.Target}).Validate())
+		assert.Error(t, (&CollectionsOptions{DB: "foo", Workers: -1, Target: files.Target}).Validate())
+		assert.Error(t, (&CollectionsOptions{DB: "foo", Limit: -1, Target: files.Target}).Validate())
+
+		opts = CollectionsOptions{DB: "foo", Snapshot: true, Target: files.Target}
+		require.NoError(t, opts.Validate())
+		assert.Equal(t, 1, opts.Workers)
+		assert.Error(t, (&CollectionsOptions{DB: "foo", Snapshot: true, Workers: 2, Target: files.Target}).Validate())
+	})
+	t.Run("Matches", func(t *testing.T) {
+		opts := CollectionsOptions{}
+		assert.True(t, opts.matches("bar"))
+		assert.False(t, opts.matches("system.views"))
+
+		opts.Include = []string{"ba*", "qux"}
+		opts.Exclude = []string{"baz"}
+		assert.True(t, opts.matches("bar"))
+		assert.True(t, opts.matches("qux"))
+		assert.False(t, opts.matches("baz"))
+		assert.False(t, opts.matches("foo"))
+	})
+	t.Run("Manifest", func(t *testing.T) {
+		files := fileCache{}
+		manifest := &Manifest{ClusterTime: primitive.Timestamp{T: 10, I: 2}, Snapshot: true, Collections: []ManifestEntry{{NS: ns, Documents: 2, Checksum: "abc", Compressed: true}}}
+		require.NoError(t, writeManifest(ctx, files.Target, manifest))
+		require.Contains(t, files, ManifestFileName)
+
+		out := &Manifest{}
+		require.NoError(t, json.Unmarshal(files[ManifestFileName].Bytes(), out))
+		assert.Equal(t, manifest.Collections, out.Collections)
+		assert.Equal(t, manifest.ClusterTime, out.ClusterTime)
+		assert.True(t, out.Snapshot)
+
+		assert.Error(t, writeManifest(ctx, files.TargetErrors, manifest))
+	})
+	t.Run("Compressed", func(t *testing.T) {
+		files := fileCache{}
+		opts := Options{NS: ns, Target: files.Target, Compress: true}
+		require.NoError(t, opts.writeIndexData(ctx, birch.NewArray()))
+		require.Contains(t, files, "foo/bar.metadata.json.gz")
+		require.NotContains(t, files, "foo/bar.metadata.json")
+
+		source, err := (&RestoreOptions{NS: ns, Compress: true}).source(ctx, files.Source, ".metadata.json")
+		require.NoError(t, err)
+		data, err := io.ReadAll(source)
+		require.NoError(t, err)
+		require.NoError(t, source.Close())
+		assert.Contains(t, string(data), `"indexes"`)
+
+		_, err = (&RestoreOptions{NS: ns}).source(ctx, files.Source, ".metadata.json")
+		assert.Error(t, err)
+
+		files["foo/bar.bson.gz"] = &closableBuffer{}
+		_, err = (&RestoreOptions{NS: ns, Compress: true}).source(ctx, files.Source, ".bson")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,34 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DirectoryTarget returns a WriterCreator that writes the files of a
+// backup within the directory, creating directories as needed.
+func DirectoryTarget(dir string) WriterCreator {
+	return func(_ context.Context, name string) (io.WriteCloser, error) {
+		fn := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			return nil, errors.Wrapf(err, "creating directory for '%s'", fn)
+		}
+
+		f, err := os.Create(fn)
+		return f, errors.Wrapf(err, "creating '%s'", fn)
+	}
+}
+
+// DirectorySource returns a ReaderCreator that opens the files of a
+// backup that DirectoryTarget wrote to the directory.
+func DirectorySource(dir string) ReaderCreator {
+	return func(_ context.Context, name string) (io.ReadCloser, error) {
+		fn := filepath.Join(dir, name)
+		f, err := os.Open(fn)
+		return f, errors.Wrapf(err, "opening '%s'", fn)
+	}
+}
@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// IncrementalOptions describe an incremental backup, which only holds
+// the documents whose value of Field is greater than After, or all
+// documents with the field if After is nil. The field should only
+// ever increase, such as an _id or the time that a document was last
+// updated, and a backup of documents ordered by the field must be
+// possible, so the field should be indexed. Because incremental
+// backups only hold new and changed documents, restoring them does
+// not remove documents that were removed after the base backup.
+type IncrementalOptions struct {
+	Field string      `bson:"field" json:"field" yaml:"field"`
+	After interface{} `bson:"after,omitempty" json:"after,omitempty" yaml:"after,omitempty"`
+}
+
+// Increment records the range of an incremental backup. Mark is the
+// greatest value of the field in the backup, which later backups can
+// use as their After value. If the backup holds no documents, Mark is
+// the same as After.
+type Increment struct {
+	Field string      `bson:"field" json:"field" yaml:"field"`
+	After interface{} `bson:"after,omitempty" json:"after,omitempty" yaml:"after,omitempty"`
+	Mark  interface{} `bson:"mark,omitempty" json:"mark,omitempty" yaml:"mark,omitempty"`
+}
+
+type incrementDoc Increment
+
+// MarshalJSON encodes the increment as extended JSON, so that the
+// types of the values of the field, such as ObjectIDs and dates,
+// remain the same when the manifest is read again.
+func (i Increment) MarshalJSON() ([]byte, error) {
+	out, err := bson.MarshalExtJSON(incrementDoc(i), true, false)
+	return out, errors.Wrap(err, "encoding increment")
+}
+
+// UnmarshalJSON decodes increments that MarshalJSON encoded.
+func (i *Increment) UnmarshalJSON(data []byte) error {
+	doc := incrementDoc{}
+	if err := bson.UnmarshalExtJSON(data, true, &doc); err != nil {
+		return errors.Wrap(err, "decoding increment")
+	}
+
+	*i = Increment(doc)
+	return nil
+}
+
+// path returns the path of the field within documents.
+func (opts *IncrementalOptions) path() []string { return strings.Split(opts.Field, ".") }
+
+// apply constrains the backup to the documents after the mark, in
+// order of the field.
+func (opts *IncrementalOptions) apply(backup *Options) error {
+	if opts.Field == "" {
+		return errors.New("must specify the field of an incremental backup")
+	}
+	if backup.Sort != nil {
+		return errors.New("cannot sort incremental backups")
+	}
+
+	backup.Sort = bson.D{{Key: opts.Field, Value: 1}}
+
+	after := bson.M{opts.Field: bson.M{"$exists": true}}
+	if opts.After != nil {
+		after = bson.M{opts.Field: bson.M{"$gt": opts.After}}
+	}
+
+	if backup.Query == nil {
+		backup.Query = after
+	} else {
+		backup.Query = bson.M{"$and": []interface{}{backup.Query, after}}
+	}
+
+	return nil
+}
+
+// increment returns the record of a backup whose greatest value of
+// the field was mark.
+func (opts *IncrementalOptions) increment(mark bson.RawValue) *Increment {
+	out := &Increment{Field: opts.Field, After: opts.After, Mark: opts.After}
+	if mark.Type != 0 {
+		out.Mark = mark
+	}
+
+	return out
+}
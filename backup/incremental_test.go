@@ -0,0 +1,78 @@
+package backup
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mongodb/anser/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIncremental(t *testing.T) {
+	ns := model.Namespace{DB: "foo", Collection: "bar"}
+	oid := primitive.NewObjectID()
+
+	t.Run("Apply", func(t *testing.T) {
+		opts := &Options{}
+		require.NoError(t, (&IncrementalOptions{Field: "_id"}).apply(opts))
+		assert.Equal(t, bson.D{{Key: "_id", Value: 1}}, opts.Sort)
+		assert.Equal(t, bson.M{"_id": bson.M{"$exists": true}}, opts.Query)
+
+		opts = &Options{Query: bson.M{"a": 1}}
+		require.NoError(t, (&IncrementalOptions{Field: "meta.updated"}).apply(opts))
+		assert.Equal(t, bson.M{"$and": []interface{}{bson.M{"a": 1}, bson.M{"meta.updated": bson.M{"$exists": true}}}}, opts.Query)
+
+		opts = &Options{}
+		require.NoError(t, (&IncrementalOptions{Field: "_id", After: oid}).apply(opts))
+		assert.Equal(t, bson.M{"_id": bson.M{"$gt": oid}}, opts.Query)
+
+		opts = &Options{Query: bson.M{"a": 1}}
+		require.NoError(t, (&IncrementalOptions{Field: "_id", After: oid}).apply(opts))
+		assert.Equal(t, bson.M{"$and": []interface{}{bson.M{"a": 1}, bson.M{"_id": bson.M{"$gt": oid}}}}, opts.Query)
+
+		assert.Error(t, (&IncrementalOptions{}).apply(&Options{}))
+		assert.Error(t, (&IncrementalOptions{Field: "_id"}).apply(&Options{Sort: bson.M{"a": 1}}))
+	})
+	t.Run("Increment", func(t *testing.T) {
+		opts := &IncrementalOptions{Field: "meta.updated", After: 1}
+		assert.Equal(t, []string{"meta", "updated"}, opts.path())
+		assert.Equal(t, &Increment{Field: "meta.updated", After: 1, Mark: 1}, opts.increment(bson.RawValue{}))
+
+		doc, err := bson.Marshal(bson.M{"meta": bson.M{"updated": oid}})
+		require.NoError(t, err)
+		inc := opts.increment(bson.Raw(doc).Lookup(opts.path()...))
+		assert.Equal(t, 1, inc.After)
+
+		out, err := json.Marshal(inc)
+		require.NoError(t, err)
+		decoded := &Increment{}
+		require.NoError(t, json.Unmarshal(out, decoded))
+		assert.Equal(t, "meta.updated", decoded.Field)
+		assert.Equal(t, int32(1), decoded.After)
+		assert.Equal(t, oid, decoded.Mark)
+	})
+	t.Run("Since", func(t *testing.T) {
+		opts := &CollectionsOptions{}
+		assert.Nil(t, opts.incremental(ns))
+
+		opts.IncrementalField = "_id"
+		assert.Equal(t, &IncrementalOptions{Field: "_id"}, opts.incremental(ns))
+
+		opts.Since = &Manifest{Collections: []ManifestEntry{
+			{NS: model.Namespace{DB: "foo", Collection: "baz"}, Increment: &Increment{Field: "_id", Mark: 4}},
+			{NS: ns, Increment: &Increment{Field: "_id", Mark: oid}},
+		}}
+		assert.Equal(t, &IncrementalOptions{Field: "_id", After: oid}, opts.incremental(ns))
+		assert.Equal(t, &IncrementalOptions{Field: "_id"}, opts.incremental(model.Namespace{DB: "foo", Collection: "qux"}))
+
+		opts.IncrementalField = "updated"
+		assert.Equal(t, &IncrementalOptions{Field: "updated"}, opts.incremental(ns))
+
+		assert.Nil(t, opts.Since.Entry(model.Namespace{DB: "foo", Collection: "qux"}))
+		assert.Error(t, (&CollectionsOptions{DB: "foo", Since: opts.Since, Target: fileCache{}.Target}).Validate())
+		assert.Error(t, (&RestoreOptions{NS: ns, Source: fileCache{}.Source, Layers: []ReaderCreator{nil}}).Validate())
+	})
+}
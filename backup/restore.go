@@ -0,0 +1,336 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"time"
+
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultRestoreBatchSize = 1000
+
+// ReaderCreator provides a way to open readers (e.g. for files) for
+// the backup payloads that a WriterCreator produced.
+type ReaderCreator func(context.Context, string) (io.ReadCloser, error)
+
+// RestoreOptions describes how to restore the backup of a single
+// collection, which Source opens by the same names that Collection
+// wrote them with. The documents are restored into NS, unless Into is
+// set, and are written in batches of BatchSize documents (1000 by
+// default). Restores insert the documents unless Upsert is set, in
+// which case they replace documents with the same _id. IndexesOnly
+// and DocumentsOnly restrict the restore to the indexes in the
+// metadata file or to the documents. Compress must be set to restore
+// compressed backups.
+//
+// Layers are the incremental backups to apply on top of the backup in
+// Source, in the order that they were taken. The documents of each
+// layer replace the documents with the same _id, and the indexes are
+// restored from the last layer.
+type RestoreOptions struct {
+	NS            model.Namespace `bson:"ns" json:"ns" yaml:"ns"`
+	Into          model.Namespace `bson:"into" json:"into" yaml:"into"`
+	Source        ReaderCreator   `bson:"-" json:"-" yaml:"-"`
+	Layers        []ReaderCreator `bson:"-" json:"-" yaml:"-"`
+	BatchSize     int             `bson:"batch_size" json:"batch_size" yaml:"batch_size"`
+	Upsert        bool            `bson:"upsert" json:"upsert" yaml:"upsert"`
+	IndexesOnly   bool            `bson:"indexes_only" json:"indexes_only" yaml:"indexes_only"`
+	DocumentsOnly bool            `bson:"documents_only" json:"documents_only" yaml:"documents_only"`
+	Compress      bool            `bson:"compress" json:"compress" yaml:"compress"`
+	EnableLogging bool            `bson:"enable_logging" json:"enable_logging" yaml:"enable_logging"`
+}
+
+// Validate checks that the options describe a restore, and sets the
+// defaults of unset options.
+func (opts *RestoreOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(!opts.NS.IsValid(), "must specify the namespace of the backup")
+	catcher.NewWhen(opts.Source == nil, "must specify a source for the backup")
+	for idx, layer := range opts.Layers {
+		catcher.ErrorfWhen(layer == nil, "layer %d has no source", idx)
+	}
+	catcher.NewWhen(opts.Into != (model.Namespace{}) && !opts.Into.IsValid(), "must specify both the database and the collection to restore into")
+	catcher.NewWhen(opts.BatchSize < 0, "batch size cannot be negative")
+	catcher.NewWhen(opts.IndexesOnly && opts.DocumentsOnly, "cannot restore only indexes and only documents")
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	if !opts.Into.IsValid() {
+		opts.Into = opts.NS
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = defaultRestoreBatchSize
+	}
+
+	return nil
+}
+
+// Restore restores a backup that Collection produced: it writes the
+// documents from the backup into the collection, and then creates the
+// indexes from the backup's metadata, other than the _id index.
+// Restore does not remove documents from the collection.
+func Restore(ctx context.Context, client *mongo.Client, opts RestoreOptions) error {
+	if err := opts.Validate(); err != nil {
+		return errors.Wrap(err, "invalid restore options")
+	}
+
+	if !opts.IndexesOnly {
+		if err := opts.restoreData(ctx, client, opts.Source, opts.Upsert); err != nil {
+			return errors.Wrapf(err, "restoring documents into '%s'", opts.Into)
+		}
+
+		for idx, layer := range opts.Layers {
+			if err := opts.restoreData(ctx, client, layer, true); err != nil {
+				return errors.Wrapf(err, "restoring documents of layer %d into '%s'", idx, opts.Into)
+			}
+		}
+	}
+
+	if !opts.DocumentsOnly {
+		source := opts.Source
+		if len(opts.Layers) > 0 {
+			source = opts.Layers[len(opts.Layers)-1]
+		}
+
+		if err := opts.restoreIndexes(ctx, client, source); err != nil {
+			return errors.Wrapf(err, "restoring indexes of '%s'", opts.Into)
+		}
+	}
+
+	return nil
+}
+
+// source opens the named file of the backup, decompressing what is
+// read from it if the backup is compressed.
+func (opts *RestoreOptions) source(ctx context.Context, backup ReaderCreator, ext string) (io.ReadCloser, error) {
+	source, err := backup(ctx, fileName(opts.NS, ext, opts.Compress))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if !opts.Compress {
+		return source, nil
+	}
+
+	reader, err := gzip.NewReader(source)
+	if err != nil {
+		catcher := grip.NewBasicCatcher()
+		catcher.Wrap(err, "opening compressed backup")
+		catcher.Add(source.Close())
+		return nil, catcher.Resolve()
+	}
+
+	return &gzipReader{Reader: reader, source: source}, nil
+}
+
+// gzipReader closes the underlying reader along with the
+// decompressed stream.
+type gzipReader struct {
+	*gzip.Reader
+	source io.ReadCloser
+}
+
+func (r *gzipReader) Close() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(r.Reader.Close())
+	catcher.Add(r.source.Close())
+	return catcher.Resolve()
+}
+
+func (opts *RestoreOptions) restoreData(ctx context.Context, client *mongo.Client, backup ReaderCreator, upsert bool) error {
+	source, err := opts.source(ctx, backup, ".bson")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	catcher := grip.NewCatcher()
+	defer func() { catcher.Add(source.Close()) }()
+
+	coll := client.Database(opts.Into.DB).Collection(opts.Into.Collection)
+	startAt := time.Now()
+	count, err := readDocuments(source, opts.BatchSize, func(docs []bson.Raw) error {
+		if upsert {
+			models := make([]mongo.WriteModel, 0, len(docs))
+			for _, doc := range docs {
+				models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": doc.Lookup("_id")}).SetReplacement(doc).SetUpsert(true))
+			}
+			_, err := coll.BulkWrite(ctx, models)
+			return errors.WithStack(err)
+		}
+
+		batch := make([]interface{}, 0, len(docs))
+		for _, doc := range docs {
+			batch = append(batch, doc)
+		}
+		_, err := coll.InsertMany(ctx, batch)
+		return errors.WithStack(err)
+	})
+	catcher.Add(err)
+
+	grip.InfoWhen(opts.EnableLogging, message.Fields{
+		"ns":       opts.Into.String(),
+		"source":   opts.NS.String(),
+		"dur_secs": time.Since(startAt).Seconds(),
+		"restored": count,
+	})
+
+	return catcher.Resolve()
+}
+
+// Documents reads the documents of the backup of a collection, one at
+// a time, in the order that Collection wrote them.
+type Documents struct {
+	source io.ReadCloser
+	count  int
+}
+
+// OpenDocuments opens the documents of the backup of the namespace
+// that Collection wrote, which source opens by the same names that
+// Collection wrote them with. Compress must be set to read compressed
+// backups.
+func OpenDocuments(ctx context.Context, source ReaderCreator, ns model.Namespace, compress bool) (*Documents, error) {
+	opts := &RestoreOptions{NS: ns, Compress: compress}
+	r, err := opts.source(ctx, source, ".bson")
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening backup of '%s'", ns)
+	}
+
+	return &Documents{source: r}, nil
+}
+
+// Next returns the next document of the backup, or io.EOF after the
+// last document.
+func (d *Documents) Next() (bson.Raw, error) {
+	doc, err := bson.NewFromIOReader(d.source)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading document %d", d.count)
+	}
+
+	d.count++
+	return doc, nil
+}
+
+// Close closes the backup.
+func (d *Documents) Close() error { return errors.WithStack(d.source.Close()) }
+
+// readDocuments reads the BSON documents from the reader, and passes
+// them to the function in batches of batchSize. It returns the number
+// of documents that it passed to the function without error.
+func readDocuments(r io.Reader, batchSize int, fn func([]bson.Raw) error) (int, error) {
+	count := 0
+	batch := make([]bson.Raw, 0, batchSize)
+	for {
+		doc, err := bson.NewFromIOReader(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, errors.Wrapf(err, "reading document %d", count+len(batch))
+		}
+
+		batch = append(batch, doc)
+		if len(batch) < batchSize {
+			continue
+		}
+
+		if err = fn(batch); err != nil {
+			return count, errors.WithStack(err)
+		}
+		count += len(batch)
+		batch = make([]bson.Raw, 0, batchSize)
+	}
+
+	if len(batch) > 0 {
+		if err := fn(batch); err != nil {
+			return count, errors.WithStack(err)
+		}
+		count += len(batch)
+	}
+
+	return count, nil
+}
+
+func (opts *RestoreOptions) restoreIndexes(ctx context.Context, client *mongo.Client, backup ReaderCreator) error {
+	source, err := opts.source(ctx, backup, ".metadata.json")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	catcher := grip.NewCatcher()
+	defer func() { catcher.Add(source.Close()) }()
+
+	data, err := io.ReadAll(source)
+	if err != nil {
+		catcher.Wrap(err, "reading metadata")
+		return catcher.Resolve()
+	}
+
+	indexes, err := indexSpecs(data)
+	if err != nil {
+		catcher.Add(err)
+		return catcher.Resolve()
+	}
+
+	if len(indexes) == 0 {
+		return catcher.Resolve()
+	}
+
+	res := client.Database(opts.Into.DB).RunCommand(ctx, bson.D{
+		{Key: "createIndexes", Value: opts.Into.Collection},
+		{Key: "indexes", Value: indexes},
+	}, options.RunCmd())
+	catcher.Wrap(res.Err(), "creating indexes")
+
+	grip.InfoWhen(opts.EnableLogging && !catcher.HasErrors(), message.Fields{
+		"ns":      opts.Into.String(),
+		"indexes": len(indexes),
+	})
+
+	return catcher.Resolve()
+}
+
+// indexSpecs returns the specifications of the indexes in the
+// metadata that Collection writes, without the _id index and without
+// the fields that tie the indexes to the original collection, so that
+// the indexes can be created on any collection.
+func indexSpecs(data []byte) ([]bson.D, error) {
+	metadata := struct {
+		Indexes []bson.D `bson:"indexes"`
+	}{}
+	if err := bson.UnmarshalExtJSON(data, false, &metadata); err != nil {
+		return nil, errors.Wrap(err, "parsing metadata")
+	}
+
+	out := make([]bson.D, 0, len(metadata.Indexes))
+	for _, index := range metadata.Indexes {
+		spec := make(bson.D, 0, len(index))
+		isID := false
+		for _, elem := range index {
+			switch elem.Key {
+			case "v", "ns":
+				continue
+			case "name":
+				isID = elem.Value == "_id_"
+			}
+			spec = append(spec, elem)
+		}
+
+		if !isID {
+			out = append(out, spec)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/evergreen-ci/birch"
+	"github.com/mongodb/anser/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRestore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ns := model.Namespace{DB: "foo", Collection: "bar"}
+
+	t.Run("Validate", func(t *testing.T) {
+		files := fileCache{}
+		opts := RestoreOptions{NS: ns, Source: files.Source}
+		require.NoError(t, opts.Validate())
+		assert.Equal(t, ns, opts.Into)
+		assert.Equal(t, defaultRestoreBatchSize, opts.BatchSize)
+
+		assert.Error(t, (&RestoreOptions{Source: files.Source}).Validate())
+		assert.Error(t, (&RestoreOptions{NS: ns}).Validate())
+		assert.Error(t, (&RestoreOptions{NS: ns, Source: files.Source, Into: model.Namespace{DB: "foo"}}).Validate())
+		assert.Error(t, (&RestoreOptions{NS: ns, Source: files.Source, BatchSize: -1}).Validate())
+		assert.Error(t, (&RestoreOptions{NS: ns, Source: files.Source, IndexesOnly: true, DocumentsOnly: true}).Validate())
+	})
+	t.Run("ReadDocuments", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		for i := 0; i < 5; i++ {
+			doc, err := bson.Marshal(bson.M{"_id": i})
+			require.NoError(t, err)
+			buf.Write(doc)
+		}
+
+		sizes := []int{}
+		count, err := readDocuments(bytes.NewReader(buf.Bytes()), 2, func(docs []bson.Raw) error {
+			sizes = append(sizes, len(docs))
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 5, count)
+		assert.Equal(t, []int{2, 2, 1}, sizes)
+
+		count, err = readDocuments(bytes.NewReader(buf.Bytes()), 2, func(docs []bson.Raw) error {
+			if docs[0].Lookup("_id").Int32() == 2 {
+				return errors.New("write failed")
+			}
+			return nil
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "write failed")
+		assert.Equal(t, 2, count)
+
+		count, err = readDocuments(bytes.NewReader(buf.Bytes()[:buf.Len()-3]), 10, func([]bson.Raw) error { return nil })
+		assert.Error(t, err)
+		assert.Zero(t, count)
+	})
+	t.Run("IndexSpecs", func(t *testing.T) {
+		files := fileCache{}
+		indexes := birch.NewArray(
+			birch.VC.Document(birch.DC.Elements(
+				birch.EC.Int32("v", 2),
+				birch.EC.SubDocument("key", birch.DC.Elements(birch.EC.Int32("_id", 1))),
+				birch.EC.String("name", "_id_"),
+				birch.EC.String("ns", "foo.bar"),
+			)),
+			birch.VC.Document(birch.DC.Elements(
+				birch.EC.Int32("v", 2),
+				birch.EC.SubDocument("key", birch.DC.Elements(birch.EC.Int32("a", 1), birch.EC.Int32("b", -1))),
+				birch.EC.String("name", "a_1_b_-1"),
+				birch.EC.Boolean("unique", true),
+			)),
+		)
+		require.NoError(t, (&Options{NS: ns, Target: files.Target}).writeIndexData(ctx, indexes))
+
+		specs, err := indexSpecs(files["foo/bar.metadata.json"].Bytes())
+		require.NoError(t, err)
+		require.Len(t, specs, 1)
+		assert.Equal(t, bson.D{
+			{Key: "key", Value: bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(-1)}}},
+			{Key: "name", Value: "a_1_b_-1"},
+			{Key: "unique", Value: true},
+		}, specs[0])
+
+		_, err = indexSpecs([]byte("{"))
+		assert.Error(t, err)
+	})
+	t.Run("Documents", func(t *testing.T) {
+		for _, compress := range []bool{false, true} {
+			files := fileCache{}
+			w, err := (&Options{NS: ns, Target: files.Target, Compress: compress}).target(ctx, ".bson")
+			require.NoError(t, err)
+			for _, id := range []string{"one", "two"} {
+				doc, err := bson.Marshal(bson.M{"_id": id})
+				require.NoError(t, err)
+				_, err = w.Write(doc)
+				require.NoError(t, err)
+			}
+			require.NoError(t, w.Close())
+
+			docs, err := OpenDocuments(ctx, files.Source, ns, compress)
+			require.NoError(t, err)
+			ids := []string{}
+			for {
+				doc, err := docs.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				ids = append(ids, doc.Lookup("_id").StringValue())
+			}
+			assert.NoError(t, docs.Close())
+			assert.Equal(t, []string{"one", "two"}, ids)
+		}
+
+		_, err := OpenDocuments(ctx, fileCache{}.Source, ns, false)
+		assert.Error(t, err)
+	})
+	t.Run("MissingSource", func(t *testing.T) {
+		err := Restore(ctx, nil, RestoreOptions{NS: ns, Source: fileCache{}.Source})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no file named 'foo/bar.bson'")
+
+		err = Restore(ctx, nil, RestoreOptions{NS: ns, Source: fileCache{}.Source, IndexesOnly: true})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no file named 'foo/bar.metadata.json'")
+	})
+}
@@ -0,0 +1,342 @@
+package anser
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// canaryBuckets is the number of buckets that hashed canaries divide
+// the documents' _id values into.
+const canaryBuckets = 10000
+
+// generatorCursor returns a cursor of the _id values of the documents
+// that a generator migrates: a sample of the documents that match the
+// query if the generator has a canary, and otherwise the matching
+// documents after the checkpoint, up to the limit.
+func generatorCursor(ctx context.Context, coll client.Collection, query map[string]interface{}, limit int, cp *model.GeneratorCheckpoint, canary *model.Canary) (client.Cursor, error) {
+	if canary != nil {
+		return canaryCursor(ctx, coll, query, limit, *canary)
+	}
+
+	query, opts := generatorFind(query, limit, cp)
+	return coll.Find(ctx, query, opts)
+}
+
+// canaryCursor returns a cursor of the _id values of the canary's
+// sample of the documents that match the query, which has at most
+// limit documents if limit is greater than 0.
+func canaryCursor(ctx context.Context, coll client.Collection, query map[string]interface{}, limit int, canary model.Canary) (client.Cursor, error) {
+	if query == nil {
+		query = map[string]interface{}{}
+	}
+
+	total := 0
+	if canary.Percent > 0 || canary.Method == model.CanaryMethodHashed {
+		count, err := coll.CountDocuments(ctx, query)
+		if err != nil {
+			return nil, errors.Wrap(err, "counting documents for canary")
+		}
+		total = int(count)
+	}
+
+	size := canary.Size(total)
+	if limit > 0 && limit < size {
+		size = limit
+	}
+	if size == 0 {
+		size = 1
+	}
+
+	if canary.Method == model.CanaryMethodHashed {
+		cursor, err := coll.Find(ctx, query, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		threshold := uint64(canaryBuckets)
+		if total > size {
+			threshold = uint64(math.Ceil(float64(size) / float64(total) * canaryBuckets))
+		}
+
+		return &hashedCanaryCursor{Cursor: cursor, threshold: threshold, remaining: size}, nil
+	}
+
+	cursor, err := coll.Aggregate(ctx, []bson.M{
+		{"$match": query},
+		{"$sample": bson.M{"size": size}},
+		{"$project": bson.M{"_id": 1}},
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &sampleCanaryCursor{Cursor: cursor, seen: map[string]struct{}{}}, nil
+}
+
+// sampleCanaryCursor iterates the documents of a $sample, skipping the
+// documents that it has already iterated, because $sample can return
+// the same document more than once. The sample may therefore have
+// fewer documents than the canary's size.
+type sampleCanaryCursor struct {
+	client.Cursor
+	seen    map[string]struct{}
+	current bson.Raw
+	err     error
+}
+
+func (c *sampleCanaryCursor) Next(ctx context.Context) bool {
+	for c.err == nil && c.Cursor.Next(ctx) {
+		doc := bson.Raw{}
+		if err := c.Cursor.Decode(&doc); err != nil {
+			c.err = errors.Wrap(err, "decoding canary document")
+			return false
+		}
+
+		key, err := documentKey(doc)
+		if err != nil {
+			c.err = errors.Wrap(err, "reading canary document")
+			return false
+		}
+		if _, ok := c.seen[key]; ok {
+			continue
+		}
+		c.seen[key] = struct{}{}
+
+		c.current = doc
+		return true
+	}
+
+	return false
+}
+
+func (c *sampleCanaryCursor) Current() []byte             { return c.current }
+func (c *sampleCanaryCursor) Decode(in interface{}) error { return bson.Unmarshal(c.current, in) }
+
+func (c *sampleCanaryCursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+
+	return c.Cursor.Err()
+}
+
+func (c *sampleCanaryCursor) All(ctx context.Context, in interface{}) error {
+	return decodeAll(ctx, c, in)
+}
+
+// canaryBucket returns the bucket of the _id value for hashed
+// canaries.
+func canaryBucket(id bson.RawValue) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte{byte(id.Type)})
+	_, _ = h.Write(id.Value)
+	return h.Sum64() % canaryBuckets
+}
+
+// hashedCanaryCursor iterates the documents of the cursor whose _id
+// falls in a bucket below the threshold, until it has iterated the
+// remaining number of documents.
+type hashedCanaryCursor struct {
+	client.Cursor
+	threshold uint64
+	remaining int
+	current   bson.Raw
+	err       error
+}
+
+func (c *hashedCanaryCursor) Next(ctx context.Context) bool {
+	for c.err == nil && c.remaining > 0 && c.Cursor.Next(ctx) {
+		doc := bson.Raw{}
+		if err := c.Cursor.Decode(&doc); err != nil {
+			c.err = errors.Wrap(err, "decoding canary document")
+			return false
+		}
+
+		if canaryBucket(doc.Lookup("_id")) < c.threshold {
+			c.current = doc
+			c.remaining--
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *hashedCanaryCursor) Current() []byte             { return c.current }
+func (c *hashedCanaryCursor) Decode(in interface{}) error { return bson.Unmarshal(c.current, in) }
+
+func (c *hashedCanaryCursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+
+	return c.Cursor.Err()
+}
+
+func (c *hashedCanaryCursor) All(ctx context.Context, in interface{}) error {
+	return decodeAll(ctx, c, in)
+}
+
+// decodeAll decodes the remaining documents of the cursor into the
+// slice that in points to, for cursors whose documents are not
+// batches from the server.
+func decodeAll(ctx context.Context, c client.Cursor, in interface{}) error {
+	docs := []bson.Raw{}
+	for c.Next(ctx) {
+		docs = append(docs, c.Current())
+	}
+	if err := c.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	raw, err := bson.Marshal(bson.M{"docs": docs})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(bson.Raw(raw).Lookup("docs").Unmarshal(in))
+}
+
+// canaryGenerator is implemented by generators that can limit their
+// migrations to a sample of the documents.
+type canaryGenerator interface {
+	sourceGenerator
+	canary() *model.Canary
+}
+
+// CanarySummary describes the result of a canary migration. Sampled
+// is the number of migration operations that the generator produced
+// for its sample, of which Completed succeeded and Failed failed with
+// the Errors. Remaining counts the migrated documents that still match
+// the generator's query, which indicates an incomplete migration for
+// migrations that modify documents so that they no longer match.
+type CanarySummary struct {
+	Migration string   `bson:"migration" json:"migration" yaml:"migration"`
+	Sampled   int      `bson:"sampled" json:"sampled" yaml:"sampled"`
+	Completed int      `bson:"completed" json:"completed" yaml:"completed"`
+	Failed    int      `bson:"failed" json:"failed" yaml:"failed"`
+	Remaining int      `bson:"remaining" json:"remaining" yaml:"remaining"`
+	Errors    []string `bson:"errors,omitempty" json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// Canaries summarizes the results of the application's generators
+// that have canaries, from the metadata of their migration
+// operations.
+func (a *Application) Canaries(ctx context.Context) ([]CanarySummary, error) {
+	if !a.hasSetup {
+		return nil, errors.New("cannot summarize the canaries of an application that has not been set up")
+	}
+
+	cl, err := a.env.GetClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting database client")
+	}
+
+	helper := NewMigrationHelper(a.env)
+	out := []CanarySummary{}
+	for _, gen := range a.Generators {
+		cg, ok := gen.(canaryGenerator)
+		if !ok || cg.canary() == nil {
+			continue
+		}
+
+		status, err := getMigrationStatus(ctx, helper, gen.ID())
+		if err != nil {
+			return nil, errors.Wrapf(err, "finding status of migration '%s'", gen.ID())
+		}
+
+		summary := CanarySummary{
+			Migration: gen.ID(),
+			Sampled:   status.Generated,
+			Completed: status.Completed,
+			Failed:    status.Failed,
+			Errors:    status.Errors,
+		}
+
+		targets, err := getMigrationTargets(ctx, helper, gen.ID())
+		if err != nil {
+			return nil, errors.Wrapf(err, "finding documents of migration '%s'", gen.ID())
+		}
+
+		if len(targets) > 0 {
+			ns, query := cg.source()
+			filter := bson.M{"_id": bson.M{"$in": targets}}
+			if len(query) > 0 {
+				filter = bson.M{"$and": []interface{}{query, filter}}
+			}
+
+			remaining, err := cl.Database(ns.DB).Collection(ns.Collection).CountDocuments(ctx, filter)
+			if err != nil {
+				return nil, errors.Wrapf(err, "counting remaining documents of migration '%s'", gen.ID())
+			}
+			summary.Remaining = int(remaining)
+		}
+
+		out = append(out, summary)
+	}
+
+	return out, nil
+}
+
+// getMigrationTargets returns the _id values of the documents that
+// the migration's completed operations migrated.
+func getMigrationTargets(ctx context.Context, helper MigrationHelper, migration string) ([]interface{}, error) {
+	events, err := getRollbackEvents(ctx, helper, migration)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out := []interface{}{}
+	for _, meta := range events {
+		if meta.Target != nil {
+			out = append(out, meta.Target)
+		}
+		out = append(out, meta.Targets...)
+	}
+
+	return out, nil
+}
+
+// hasCanaries reports if any of the application's generators have
+// canaries.
+func (a *Application) hasCanaries() bool {
+	for _, gen := range a.Generators {
+		if cg, ok := gen.(canaryGenerator); ok && cg.canary() != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reportCanaries logs the summary of each of the application's
+// canaries.
+func (a *Application) reportCanaries(ctx context.Context) error {
+	summaries, err := a.Canaries(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, summary := range summaries {
+		grip.Notice(message.Fields{
+			"message":   "canary migration summary",
+			"migration": summary.Migration,
+			"sampled":   summary.Sampled,
+			"completed": summary.Completed,
+			"failed":    summary.Failed,
+			"remaining": summary.Remaining,
+			"errors":    summary.Errors,
+		})
+	}
+
+	return nil
+}
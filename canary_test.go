@@ -0,0 +1,179 @@
+package anser
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCanary(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	query := map[string]interface{}{"a": map[string]interface{}{"$exists": false}}
+
+	docs := make([]interface{}, 0, 100)
+	for i := 0; i < 100; i++ {
+		raw, err := bson.Marshal(bson.M{"_id": i})
+		require.NoError(t, err)
+		doc := bson.Raw(raw)
+		docs = append(docs, &doc)
+	}
+
+	t.Run("WithoutCanary", func(t *testing.T) {
+		coll := &mock.Collection{}
+		_, err := generatorCursor(ctx, coll, query, 10, nil, nil)
+		require.NoError(t, err)
+		assert.Empty(t, coll.Pipelines)
+	})
+	t.Run("Sample", func(t *testing.T) {
+		coll := &mock.Collection{CountResult: 1000}
+		_, err := generatorCursor(ctx, coll, query, 0, nil, &model.Canary{Percent: 2})
+		require.NoError(t, err)
+		require.Len(t, coll.Pipelines, 1)
+		assert.Equal(t, []bson.M{
+			{"$match": query},
+			{"$sample": bson.M{"size": 20}},
+			{"$project": bson.M{"_id": 1}},
+		}, coll.Pipelines[0])
+
+		_, err = generatorCursor(ctx, coll, nil, 5, nil, &model.Canary{Count: 10})
+		require.NoError(t, err)
+		require.Len(t, coll.Pipelines, 2)
+		assert.Equal(t, bson.M{"$sample": bson.M{"size": 5}}, coll.Pipelines[1].([]bson.M)[1])
+	})
+	t.Run("SampleDuplicates", func(t *testing.T) {
+		sample := []interface{}{docs[3], docs[1], docs[3], docs[2], docs[1]}
+		coll := &mock.Collection{
+			CountResult:     100,
+			AggregateCursor: &mock.Cursor{ShouldIter: true, MaxNextCalls: len(sample) + 1, Results: sample},
+		}
+		cursor, err := generatorCursor(ctx, coll, query, 0, nil, &model.Canary{Count: 5})
+		require.NoError(t, err)
+
+		selected := []int{}
+		doc := struct {
+			ID int `bson:"_id"`
+		}{}
+		for cursor.Next(ctx) {
+			require.NoError(t, cursor.Decode(&doc))
+			selected = append(selected, doc.ID)
+		}
+		assert.NoError(t, cursor.Err())
+		assert.Equal(t, []int{3, 1, 2}, selected)
+	})
+	t.Run("DecodeError", func(t *testing.T) {
+		bad := func() *mock.Cursor {
+			return &mock.Cursor{ShouldIter: true, MaxNextCalls: 2, Results: docs, DecodeError: errors.New("bad document")}
+		}
+
+		for name, test := range map[string]struct {
+			coll   *mock.Collection
+			method model.CanaryMethod
+		}{
+			"Sample": {coll: &mock.Collection{CountResult: 100, AggregateCursor: bad()}, method: model.CanaryMethodSample},
+			"Hashed": {coll: &mock.Collection{CountResult: 100, FindCursor: bad()}, method: model.CanaryMethodHashed},
+		} {
+			t.Run(name, func(t *testing.T) {
+				cursor, err := generatorCursor(ctx, test.coll, query, 0, nil, &model.Canary{Count: 5, Method: test.method})
+				require.NoError(t, err)
+				assert.False(t, cursor.Next(ctx))
+				require.Error(t, cursor.Err())
+				assert.Contains(t, cursor.Err().Error(), "bad document")
+			})
+		}
+	})
+	t.Run("Hashed", func(t *testing.T) {
+		coll := &mock.Collection{
+			CountResult: 100,
+			FindCursor:  &mock.Cursor{ShouldIter: true, MaxNextCalls: len(docs) + 1, Results: docs},
+		}
+		cursor, err := generatorCursor(ctx, coll, query, 0, nil, &model.Canary{Percent: 50, Method: model.CanaryMethodHashed})
+		require.NoError(t, err)
+		assert.Empty(t, coll.Pipelines)
+
+		expected := []int{}
+		for _, doc := range docs {
+			if canaryBucket(doc.(*bson.Raw).Lookup("_id")) < canaryBuckets/2 && len(expected) < 50 {
+				expected = append(expected, int(doc.(*bson.Raw).Lookup("_id").Int32()))
+			}
+		}
+		require.NotEmpty(t, expected)
+
+		selected := []int{}
+		doc := struct {
+			ID int `bson:"_id"`
+		}{}
+		for cursor.Next(ctx) {
+			require.NoError(t, cursor.Decode(&doc))
+			selected = append(selected, doc.ID)
+		}
+		assert.Equal(t, expected, selected)
+	})
+	t.Run("HashedAll", func(t *testing.T) {
+		coll := &mock.Collection{
+			FindCursor: &mock.Cursor{ShouldIter: true, MaxNextCalls: len(docs) + 1, Results: docs},
+		}
+		cursor, err := generatorCursor(ctx, coll, nil, 0, nil, &model.Canary{Count: 3, Method: model.CanaryMethodHashed})
+		require.NoError(t, err)
+
+		out := []bson.M{}
+		require.NoError(t, cursor.All(ctx, &out))
+		assert.Len(t, out, 3)
+	})
+	t.Run("Summary", func(t *testing.T) {
+		env := mock.NewEnvironment()
+		env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+		env.Client = mock.NewClient()
+		meta := &mock.Collection{FindCursor: &mock.Cursor{
+			ShouldIter:   true,
+			MaxNextCalls: 4,
+			Results: []interface{}{
+				&model.MigrationMetadata{ID: "canary", Migration: "canary", Completed: true, Generated: 3},
+				&model.MigrationMetadata{ID: "canary.1.0", Migration: "canary", Target: 1, Completed: true},
+				&model.MigrationMetadata{ID: "canary.2.1", Migration: "canary", Target: 2, Completed: true, HasErrors: true, Errors: []string{"failed"}},
+			},
+		}}
+		env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{"migrations.metadata": meta}}
+
+		ns := model.Namespace{DB: "foo", Collection: "bar"}
+		update := map[string]interface{}{"$set": map[string]interface{}{"a": 1}}
+		app := &Application{Generators: []Generator{
+			NewSimpleMigrationGenerator(env, model.GeneratorOptions{JobID: "canary", NS: ns, Canary: &model.Canary{Count: 3}}, update),
+			NewSimpleMigrationGenerator(env, model.GeneratorOptions{JobID: "full", NS: ns}, update),
+		}}
+
+		_, err := app.Canaries(ctx)
+		assert.Error(t, err)
+
+		require.NoError(t, app.Setup(env))
+		assert.True(t, app.hasCanaries())
+
+		out, err := app.Canaries(ctx)
+		require.NoError(t, err)
+		require.Len(t, out, 1)
+		assert.Equal(t, "canary", out[0].Migration)
+		assert.Equal(t, 3, out[0].Sampled)
+		assert.Equal(t, 1, out[0].Completed)
+		assert.Equal(t, 1, out[0].Failed)
+		assert.Equal(t, []string{"canary.2.1: failed"}, out[0].Errors)
+
+		meta.FindCursor = &mock.Cursor{
+			ShouldIter:   true,
+			MaxNextCalls: 3,
+			Results: []interface{}{
+				&model.MigrationMetadata{ID: "canary.1.0", Migration: "canary", Target: 1, Completed: true},
+				&model.MigrationMetadata{ID: "canary.batch.1", Migration: "canary", Targets: []interface{}{2, 3}, Completed: true},
+			},
+		}
+		targets, err := getMigrationTargets(ctx, NewMigrationHelper(env), "canary")
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{1, 2, 3}, targets)
+	})
+}
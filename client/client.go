@@ -25,6 +25,9 @@ type Database interface {
 
 type Collection interface {
 	Aggregate(context.Context, interface{}, ...*options.AggregateOptions) (Cursor, error)
+	BulkWrite(context.Context, []WriteModel, ...*options.BulkWriteOptions) (*BulkWriteResult, error)
+	CountDocuments(context.Context, interface{}, ...*options.CountOptions) (int64, error)
+	DeleteMany(context.Context, interface{}, ...*options.DeleteOptions) (*DeleteResult, error)
 	Find(context.Context, interface{}, ...*options.FindOptions) (Cursor, error)
 	FindOne(context.Context, interface{}, ...*options.FindOneOptions) SingleResult
 	Name() string
@@ -33,6 +36,7 @@ type Collection interface {
 	UpdateMany(context.Context, interface{}, interface{}, ...*options.UpdateOptions) (*UpdateResult, error)
 	InsertOne(context.Context, interface{}) (*InsertOneResult, error)
 	InsertMany(context.Context, []interface{}) (*InsertManyResult, error)
+	Watch(context.Context, interface{}, ...*options.ChangeStreamOptions) (ChangeStream, error)
 }
 
 type SingleResult interface {
@@ -51,6 +55,21 @@ type Cursor interface {
 	Next(context.Context) bool
 }
 
+// ChangeStream iterates over the change events of a collection.
+// TryNext returns false without waiting for events when there are
+// none, so that callers can stop watching without an event.
+type ChangeStream interface {
+	Close(context.Context) error
+	Decode(interface{}) error
+	Err() error
+	ID() int64
+	Next(context.Context) bool
+	TryNext(context.Context) bool
+}
+
 type InsertOneResult = mongo.InsertOneResult
 type InsertManyResult = mongo.InsertManyResult
 type UpdateResult = mongo.UpdateResult
+type DeleteResult = mongo.DeleteResult
+type BulkWriteResult = mongo.BulkWriteResult
+type WriteModel = mongo.WriteModel
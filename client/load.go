@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mongodb/anser/apm"
+	"github.com/mongodb/anser/model"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// LoadSource reports the current load on a cluster, so that
+// migrations can pause while the cluster is under stress.
+type LoadSource interface {
+	ClusterLoad(context.Context) (model.ClusterLoad, error)
+}
+
+// the server returns this code for replSetGetStatus on servers that
+// are not members of a replica set.
+const noReplicationEnabledCode = 76
+
+type serverStatusLoadSource struct {
+	client Client
+}
+
+// NewServerStatusLoadSource returns a LoadSource that reports the
+// replication lag of the cluster's secondaries, from
+// replSetGetStatus, and the use of the WiredTiger cache, from
+// serverStatus. Servers that are not members of a replica set have
+// no replication lag.
+func NewServerStatusLoadSource(cl Client) LoadSource {
+	return &serverStatusLoadSource{client: cl}
+}
+
+func (s *serverStatusLoadSource) ClusterLoad(ctx context.Context) (model.ClusterLoad, error) {
+	out := model.ClusterLoad{}
+	admin := s.client.Database("admin")
+
+	lag, err := replicationLag(ctx, admin)
+	if err != nil {
+		return out, errors.Wrap(err, "getting replication lag")
+	}
+	out.ReplicationLag = lag
+
+	res := admin.RunCommand(ctx, bson.D{{Key: "serverStatus", Value: 1}})
+	if err = res.Err(); err != nil {
+		return out, errors.Wrap(err, "running serverStatus")
+	}
+	raw, err := res.Raw()
+	if err != nil {
+		return out, errors.Wrap(err, "reading serverStatus")
+	}
+
+	cache := bson.Raw(raw).Lookup("wiredTiger", "cache")
+	if doc, ok := cache.DocumentOK(); ok {
+		if max := rawNumber(doc.Lookup("maximum bytes configured")); max > 0 {
+			out.CacheUsedRatio = rawNumber(doc.Lookup("bytes currently in the cache")) / max
+			out.CacheDirtyRatio = rawNumber(doc.Lookup("tracked dirty bytes in the cache")) / max
+		}
+	}
+
+	return out, nil
+}
+
+// replicationLag returns the largest lag between the optime of the
+// primary and the optime of a secondary.
+func replicationLag(ctx context.Context, admin Database) (time.Duration, error) {
+	res := admin.RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}})
+	if err := res.Err(); err != nil {
+		if cerr, ok := errors.Cause(err).(mongo.CommandError); ok && cerr.Code == noReplicationEnabledCode {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "running replSetGetStatus")
+	}
+	raw, err := res.Raw()
+	if err != nil {
+		return 0, errors.Wrap(err, "reading replSetGetStatus")
+	}
+
+	members, ok := bson.Raw(raw).Lookup("members").ArrayOK()
+	if !ok {
+		return 0, nil
+	}
+	values, err := members.Values()
+	if err != nil {
+		return 0, errors.Wrap(err, "reading replica set members")
+	}
+
+	var primary time.Time
+	secondaries := []time.Time{}
+	for _, val := range values {
+		member, ok := val.DocumentOK()
+		if !ok {
+			continue
+		}
+		optime, ok := member.Lookup("optimeDate").TimeOK()
+		if !ok {
+			continue
+		}
+
+		switch member.Lookup("stateStr").StringValue() {
+		case "PRIMARY":
+			primary = optime
+		case "SECONDARY":
+			secondaries = append(secondaries, optime)
+		}
+	}
+
+	var lag time.Duration
+	if primary.IsZero() {
+		return lag, nil
+	}
+	for _, optime := range secondaries {
+		if l := primary.Sub(optime); l > lag {
+			lag = l
+		}
+	}
+
+	return lag, nil
+}
+
+func rawNumber(val bson.RawValue) float64 {
+	switch val.Type {
+	case bsontype.Double:
+		return val.Double()
+	case bsontype.Int32:
+		return float64(val.Int32())
+	case bsontype.Int64:
+		return float64(val.Int64())
+	default:
+		return 0
+	}
+}
+
+type monitorLoadSource struct {
+	mu      sync.Mutex
+	monitor apm.Monitor
+}
+
+// NewMonitorLoadSource returns a LoadSource that reports the failure
+// rate and average latency of the operations that the monitor
+// observed since the previous call to ClusterLoad. The source rotates
+// the monitor's event window, so the monitor should not be used for
+// anything else.
+func NewMonitorLoadSource(m apm.Monitor) LoadSource {
+	return &monitorLoadSource{monitor: m}
+}
+
+func (s *monitorLoadSource) ClusterLoad(_ context.Context) (model.ClusterLoad, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := model.ClusterLoad{}
+	raw, err := s.monitor.Rotate().Document().MarshalBSON()
+	if err != nil {
+		return out, errors.Wrap(err, "reading monitor events")
+	}
+
+	events, ok := bson.Raw(raw).Lookup("events").DocumentOK()
+	if !ok {
+		return out, nil
+	}
+	elems, err := events.Elements()
+	if err != nil {
+		return out, errors.Wrap(err, "reading monitor events")
+	}
+
+	var failed, total float64
+	var duration time.Duration
+	for _, elem := range elems {
+		event, ok := elem.Value().DocumentOK()
+		if !ok {
+			continue
+		}
+		f := rawNumber(event.Lookup("failed"))
+		failed += f
+		total += f + rawNumber(event.Lookup("success"))
+		duration += time.Duration(rawNumber(event.Lookup("duration")))
+	}
+
+	if total > 0 {
+		out.FailureRate = failed / total
+		out.Latency = time.Duration(float64(duration) / total)
+	}
+
+	return out, nil
+}
+
+type mergedLoadSource []LoadSource
+
+// MergeLoadSources returns a LoadSource that reports the largest of
+// each signal from all of the sources.
+func MergeLoadSources(sources ...LoadSource) LoadSource { return mergedLoadSource(sources) }
+
+func (s mergedLoadSource) ClusterLoad(ctx context.Context) (model.ClusterLoad, error) {
+	out := model.ClusterLoad{}
+	for _, src := range s {
+		load, err := src.ClusterLoad(ctx)
+		if err != nil {
+			return out, err
+		}
+		out = out.Max(load)
+	}
+
+	return out, nil
+}
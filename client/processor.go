@@ -1,6 +1,8 @@
 package client
 
 import (
+	"context"
+
 	"github.com/evergreen-ci/birch"
 	"github.com/mongodb/anser/model"
 )
@@ -19,3 +21,26 @@ type Processor interface {
 // Implementors of MigrationOperations are responsible for
 // implementing idempotent operations.
 type MigrationOperation func(Client, *birch.Document) error
+
+// ParameterizedMigrationOperation is a MigrationOperation that also
+// receives the params of the migration that runs it, so that one
+// operation can be reused with different settings. Register these
+// functions using RegisterParameterizedMigrationOperation.
+type ParameterizedMigrationOperation func(Client, *birch.Document, map[string]string) error
+
+// ParameterizedProcessor is a Processor that can be configured with
+// the params of the migration that runs it. Before a migration uses
+// the processor, it calls WithParams and uses the returned processor
+// instead, so implementations should not modify the registered
+// processor.
+type ParameterizedProcessor interface {
+	Processor
+	WithParams(map[string]string) (Processor, error)
+}
+
+// Verification checks that a migration left the documents in the
+// namespace as intended, and returns an error if it did not. When the
+// migration only modified some of the documents, ids holds the _id
+// fields of the documents that it modified; otherwise ids is nil.
+// Register these functions using RegisterVerification.
+type Verification func(ctx context.Context, cl Client, ns model.Namespace, ids []interface{}) error
@@ -22,6 +22,16 @@ func (c *clientWrapper) ListDatabaseNames(ctx context.Context, filter interface{
 	return c.cl.ListDatabaseNames(ctx, filter)
 }
 
+// UnwrapClient returns the driver client of a client that WrapClient
+// produced, for operations that need the driver's client directly.
+func UnwrapClient(c Client) (*mongo.Client, bool) {
+	wrapper, ok := c.(*clientWrapper)
+	if !ok {
+		return nil, false
+	}
+	return wrapper.cl, true
+}
+
 type databaseWrapper struct {
 	db *mongo.Database
 }
@@ -49,6 +59,18 @@ func (c *collectionWrapper) Aggregate(ctx context.Context, pipe interface{}, opt
 	return &cursorWrapper{cur}, errors.WithStack(err)
 }
 
+func (c *collectionWrapper) BulkWrite(ctx context.Context, models []WriteModel, opts ...*options.BulkWriteOptions) (*BulkWriteResult, error) {
+	return c.Collection.BulkWrite(ctx, models, opts...)
+}
+
+func (c *collectionWrapper) CountDocuments(ctx context.Context, query interface{}, opts ...*options.CountOptions) (int64, error) {
+	return c.Collection.CountDocuments(ctx, query, opts...)
+}
+
+func (c *collectionWrapper) DeleteMany(ctx context.Context, query interface{}, opts ...*options.DeleteOptions) (*DeleteResult, error) {
+	return c.Collection.DeleteMany(ctx, query, opts...)
+}
+
 func (c *collectionWrapper) Find(ctx context.Context, query interface{}, opts ...*options.FindOptions) (Cursor, error) {
 	cur, err := c.Collection.Find(ctx, query, opts...)
 	return &cursorWrapper{cur}, errors.WithStack(err)
@@ -76,6 +98,14 @@ func (c *collectionWrapper) UpdateOne(ctx context.Context, query, update interfa
 	return c.Collection.UpdateOne(ctx, query, update, opts...)
 }
 
+func (c *collectionWrapper) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (ChangeStream, error) {
+	stream, err := c.Collection.Watch(ctx, pipeline, opts...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return stream, nil
+}
+
 type singleResultWrapper struct {
 	*mongo.SingleResult
 }
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/evergreen-ci/utility"
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/anser"
+	"github.com/mongodb/anser/backup"
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/db"
+	"github.com/mongodb/anser/model"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	queueLocal   = "local"
+	queueMongoDB = "mongodb"
+)
+
+type command struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"plan":           {usage: "plan --config <path>", help: "print the order in which the migrations run", run: plan},
+	"run":            {usage: "run --config <path> [--dry-run] [--dry-run-report <file>] [--limit <n>]", help: "run the migrations", run: run},
+	"status":         {usage: "status --config <path> [--json]", help: "report the progress of the migrations", run: status},
+	"reset":          {usage: "reset <migration>...", help: "remove the metadata of migrations so that they run again", run: reset},
+	"stop":           {usage: "stop <migration>...", help: "stop continuous migrations from watching for changes", run: stop},
+	"backup":         {usage: "backup --db <db> [--collection <collection>] [--out <dir>] [--gzip]", help: "back up a collection, or a database's collections, to BSON files", run: backupCollection},
+	"restore":        {usage: "restore [--db <db> --collection <collection>] [--ids <json>] <migration>", help: "restore documents from a migration's snapshots", run: restore},
+	"restore-backup": {usage: "restore-backup --db <db> --collection <collection> [--in <dir>] [--layer <dir>]...", help: "restore a collection from the files of a backup", run: restoreBackup},
+}
+
+// anser runs and inspects the migrations defined in configuration
+// files. Because the operations of manual and stream migrations are
+// registered by the programs that define them, the tool can only run
+// simple migrations, but can plan, report on, and reset any migration.
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage(os.Stdout)
+		return
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n", name)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := cmd.run(ctx, os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		cancel()
+		os.Exit(1)
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: anser <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, name := range []string{"plan", "run", "status", "reset", "stop", "backup", "restore-backup", "restore"} {
+		fmt.Fprintf(w, "  %-70s %s\n", commands[name].usage, commands[name].help)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "run 'anser <command> -h' for the flags of a command")
+}
+
+// stringList is a flag that can be set more than once.
+type stringList []string
+
+func (l *stringList) String() string       { return strings.Join(*l, ",") }
+func (l *stringList) Set(val string) error { *l = append(*l, val); return nil }
+
+// connectionFlags are the flags of the commands that connect to the
+// database.
+type connectionFlags struct {
+	uri             string
+	queue           string
+	queueDB         string
+	queueCollection string
+	workers         int
+	capacity        int
+}
+
+func (f *connectionFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.uri, "uri", "mongodb://localhost:27017", "the URI of the database to migrate")
+	fs.StringVar(&f.queue, "queue", queueLocal, "the queue that runs the migrations, either 'local' (in memory) or 'mongodb'")
+	fs.StringVar(&f.queueDB, "queue-db", "amboy", "the database of the 'mongodb' queue")
+	fs.StringVar(&f.queueCollection, "queue-collection", "anser.jobs", "the collection of the 'mongodb' queue")
+	fs.IntVar(&f.workers, "workers", 2, "the number of workers that run migrations")
+	fs.IntVar(&f.capacity, "queue-capacity", 100000, "the number of jobs that the 'local' queue holds; runs that may add more jobs fail before they start")
+}
+
+func (f *connectionFlags) connect(ctx context.Context) (*mongo.Client, error) {
+	cl, err := mongo.Connect(ctx, options.Client().ApplyURI(f.uri))
+	if err != nil {
+		return nil, errors.Wrapf(err, "connecting to '%s'", f.uri)
+	}
+
+	return cl, nil
+}
+
+func (f *connectionFlags) newQueue(ctx context.Context, cl *mongo.Client) (amboy.Queue, error) {
+	if f.workers < 1 {
+		return nil, errors.New("must use at least one worker")
+	}
+
+	switch f.queue {
+	case queueLocal:
+		if f.capacity < 1 {
+			return nil, errors.New("the local queue must hold at least one job")
+		}
+		return queue.NewLocalLimitedSize(f.workers, f.capacity), nil
+	case queueMongoDB:
+		opts := queue.DefaultMongoDBOptions()
+		opts.Client = cl
+		opts.DB = f.queueDB
+		opts.Collection = f.queueCollection
+
+		q, err := queue.NewMongoDBQueue(ctx, queue.MongoDBQueueOptions{
+			DB:         &opts,
+			NumWorkers: utility.ToIntPtr(f.workers),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "constructing MongoDB queue")
+		}
+		return q, nil
+	default:
+		return nil, errors.Errorf("unknown queue '%s'", f.queue)
+	}
+}
+
+// environment connects to the database and sets up the global anser
+// environment with a running queue. The returned function releases
+// the environment's resources.
+func (f *connectionFlags) environment(ctx context.Context) (anser.Environment, func(), error) {
+	cl, err := f.connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	closer := func() {
+		cancel()
+		_ = cl.Disconnect(context.Background())
+	}
+
+	q, err := f.newQueue(ctx, cl)
+	if err != nil {
+		closer()
+		return nil, nil, err
+	}
+	if err = q.Start(ctx); err != nil {
+		closer()
+		return nil, nil, errors.Wrap(err, "starting queue")
+	}
+
+	env := anser.GetEnvironment()
+	if err = env.Setup(q, client.WrapClient(cl), db.WrapClient(ctx, cl)); err != nil {
+		closer()
+		return nil, nil, errors.Wrap(err, "setting up environment")
+	}
+
+	return env, func() {
+		_ = env.Close()
+		q.Close(context.Background())
+		closer()
+	}, nil
+}
+
+func loadConfiguration(paths []string) (*model.Configuration, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("must specify at least one configuration with --config")
+	}
+
+	return anser.LoadConfiguration(paths...)
+}
+
+func plan(_ context.Context, args []string) error {
+	var paths stringList
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	fs.Var(&paths, "config", "a configuration file or directory (may be repeated)")
+	_ = fs.Parse(args)
+
+	conf, err := loadConfiguration(paths)
+	if err != nil {
+		return err
+	}
+
+	return writePlan(os.Stdout, conf)
+}
+
+// writePlan writes the IDs of the configuration's migrations, one per
+// line, in the order that they run.
+func writePlan(w io.Writer, conf *model.Configuration) error {
+	order, err := anser.PlanConfiguration(conf)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range order {
+		fmt.Fprintln(w, id)
+	}
+
+	return nil
+}
+
+func run(ctx context.Context, args []string) error {
+	var (
+		paths  stringList
+		conn   connectionFlags
+		dryRun bool
+		report string
+		limit  int
+	)
+
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.Var(&paths, "config", "a configuration file or directory (may be repeated)")
+	fs.BoolVar(&dryRun, "dry-run", false, "log the migrations without changing any documents (overrides the configuration)")
+	fs.StringVar(&report, "dry-run-report", "", "write the changes that a dry run would make to this file (overrides the configuration)")
+	fs.IntVar(&limit, "limit", 0, "the maximum number of migration operations to run (overrides the configuration)")
+	conn.register(fs)
+	_ = fs.Parse(args)
+
+	conf, err := loadConfiguration(paths)
+	if err != nil {
+		return err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "dry-run":
+			conf.Options.DryRun = dryRun
+		case "dry-run-report":
+			conf.Options.DryRunReport = report
+		case "limit":
+			conf.Options.Limit = limit
+		}
+	})
+
+	env, closer, err := conn.environment(ctx)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	app, err := anser.NewApplication(env, conf)
+	if err != nil {
+		return errors.Wrap(err, "constructing application")
+	}
+
+	if conn.queue == queueLocal {
+		if err = checkCapacity(ctx, app, conf, conn.capacity); err != nil {
+			return err
+		}
+	}
+
+	return app.Run(ctx)
+}
+
+// checkCapacity returns an error if the application may add more jobs
+// to the local queue than it holds. The local queue discards the
+// oldest completed jobs when it is full, which would lose the results
+// of migrations before the application reads them, so the application
+// must not run. The estimate counts the generators, the documents that
+// match each generator's query, up to its limit, each verification,
+// and the changed documents that continuous generators may migrate,
+// which must have a maximum.
+func checkCapacity(ctx context.Context, app *anser.Application, conf *model.Configuration, capacity int) error {
+	pending, err := app.Pending(ctx)
+	if err != nil {
+		return errors.Wrap(err, "estimating migration jobs")
+	}
+
+	opts := []model.GeneratorOptions{}
+	for _, g := range conf.SimpleMigrations {
+		opts = append(opts, g.Options)
+	}
+	for _, g := range conf.ManualMigrations {
+		opts = append(opts, g.Options)
+	}
+	for _, g := range conf.StreamMigrations {
+		opts = append(opts, g.Options)
+	}
+
+	jobs := 0
+	for _, o := range opts {
+		num := pending[o.JobID]
+		for _, limit := range []int{o.Limit, conf.Options.Limit} {
+			if limit > 0 && num > limit {
+				num = limit
+			}
+		}
+
+		if o.Continuous != nil {
+			if o.Continuous.MaxDocuments == 0 {
+				return errors.Errorf("cannot run continuous migration '%s' on the local queue without a maximum number of documents", o.JobID)
+			}
+			num += o.Continuous.MaxDocuments
+		}
+
+		if o.Verify != nil {
+			num++
+		}
+
+		jobs += num + 1
+	}
+
+	if jobs > capacity {
+		return errors.Errorf("the migrations may add %d jobs, but the local queue only holds %d; increase --queue-capacity or use the 'mongodb' queue", jobs, capacity)
+	}
+
+	return nil
+}
+
+func status(ctx context.Context, args []string) error {
+	var (
+		paths  stringList
+		conn   connectionFlags
+		asJSON bool
+	)
+
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	fs.Var(&paths, "config", "a configuration file or directory (may be repeated)")
+	fs.BoolVar(&asJSON, "json", false, "print the status as JSON")
+	conn.register(fs)
+	_ = fs.Parse(args)
+
+	conf, err := loadConfiguration(paths)
+	if err != nil {
+		return err
+	}
+
+	order, err := anser.PlanConfiguration(conf)
+	if err != nil {
+		return err
+	}
+
+	env, closer, err := conn.environment(ctx)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	return writeStatus(ctx, os.Stdout, os.Stderr, env, order, asJSON)
+}
+
+// writeStatus writes the status of the migrations to out, as a table
+// or as JSON, and the migrations' errors to errOut.
+func writeStatus(ctx context.Context, out, errOut io.Writer, env anser.Environment, order []string, asJSON bool) error {
+	statuses, err := anser.GetMigrationStatus(ctx, env, order...)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return errors.WithStack(enc.Encode(statuses))
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tSTATE\tGENERATED\tCOMPLETED\tFAILED\tPENDING\tVERIFIED")
+	for _, s := range statuses {
+		verified := string(s.Verification)
+		if verified == "" {
+			verified = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%s\n", s.Migration, s.State(), s.Generated, s.Completed, s.Failed, s.Pending, verified)
+	}
+	if err = w.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, s := range statuses {
+		for _, e := range s.Errors {
+			fmt.Fprintf(errOut, "%s: %s\n", s.Migration, e)
+		}
+	}
+
+	return nil
+}
+
+func reset(ctx context.Context, args []string) error {
+	var conn connectionFlags
+	fs := flag.NewFlagSet("reset", flag.ExitOnError)
+	conn.register(fs)
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("must specify the migrations to reset")
+	}
+
+	env, closer, err := conn.environment(ctx)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	for _, migration := range fs.Args() {
+		if err = anser.ResetMigration(ctx, env, migration); err != nil {
+			return err
+		}
+		fmt.Printf("reset migration '%s'\n", migration)
+	}
+
+	return nil
+}
+
+func stop(ctx context.Context, args []string) error {
+	var conn connectionFlags
+	fs := flag.NewFlagSet("stop", flag.ExitOnError)
+	conn.register(fs)
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("must specify the migrations to stop")
+	}
+
+	env, closer, err := conn.environment(ctx)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	for _, migration := range fs.Args() {
+		if err = anser.StopContinuousMigration(ctx, env, migration); err != nil {
+			return err
+		}
+		fmt.Printf("asked migration '%s' to stop\n", migration)
+	}
+
+	return nil
+}
+
+func restore(ctx context.Context, args []string) error {
+	var (
+		conn connectionFlags
+		ns   model.Namespace
+		ids  string
+	)
+
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.StringVar(&ns.DB, "db", "", "only restore documents in this database's collection")
+	fs.StringVar(&ns.Collection, "collection", "", "only restore documents in this collection")
+	fs.StringVar(&ids, "ids", "", "only restore the documents with these _id values, as an extended JSON array")
+	conn.register(fs)
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("must specify one migration to restore")
+	}
+
+	if (ns.DB == "") != (ns.Collection == "") {
+		return errors.New("must specify both a database and a collection, or neither")
+	}
+
+	var docIDs []interface{}
+	if ids != "" {
+		wrapper := struct {
+			IDs []interface{} `bson:"ids"`
+		}{}
+		if err := bson.UnmarshalExtJSON([]byte(fmt.Sprintf(`{"ids": %s}`, ids)), false, &wrapper); err != nil {
+			return errors.Wrap(err, "parsing ids")
+		}
+		if len(wrapper.IDs) == 0 {
+			return errors.New("must specify at least one id with --ids")
+		}
+		docIDs = wrapper.IDs
+	}
+
+	env, closer, err := conn.environment(ctx)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	count, err := anser.RestoreSnapshots(ctx, env, fs.Arg(0), ns, docIDs...)
+	fmt.Printf("restored %d documents from migration '%s'\n", count, fs.Arg(0))
+	return err
+}
+
+func backupCollection(ctx context.Context, args []string) error {
+	var (
+		conn        connectionFlags
+		ns          model.Namespace
+		out         string
+		query       string
+		limit       int64
+		indexesOnly bool
+		compress    bool
+		snapshot    bool
+		incremental string
+		since       string
+		workers     int
+		include     stringList
+		exclude     stringList
+	)
+
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	fs.StringVar(&ns.DB, "db", "", "the database of the collection")
+	fs.StringVar(&ns.Collection, "collection", "", "the collection to back up; without it, back up the database's collections")
+	fs.StringVar(&out, "out", ".", "the directory to write the backup to")
+	fs.StringVar(&query, "query", "", "a query, as extended JSON, to limit the documents in the backup")
+	fs.Int64Var(&limit, "limit", 0, "the maximum number of documents in the backup")
+	fs.BoolVar(&indexesOnly, "indexes-only", false, "only back up the collection's indexes")
+	fs.BoolVar(&compress, "gzip", false, "compress the backup's files with gzip")
+	fs.BoolVar(&snapshot, "snapshot", false, "read the database's collections at a single point in time, one at a time")
+	fs.StringVar(&incremental, "incremental", "", "back up only documents with greater values of this field than the previous backup")
+	fs.StringVar(&since, "since", "", "the manifest of the previous backup of an incremental backup")
+	fs.IntVar(&workers, "workers", 0, "the number of collections of a database to back up at once")
+	fs.Var(&include, "include", "a pattern of the database's collections to back up (may be repeated)")
+	fs.Var(&exclude, "exclude", "a pattern of the database's collections not to back up (may be repeated)")
+	fs.StringVar(&conn.uri, "uri", "mongodb://localhost:27017", "the URI of the database")
+	_ = fs.Parse(args)
+
+	if ns.DB == "" {
+		return errors.New("must specify a database")
+	}
+
+	target := backup.DirectoryTarget(out)
+
+	if ns.Collection == "" || snapshot || incremental != "" {
+		if query != "" || limit > 0 {
+			return errors.New("cannot limit the documents of snapshot, incremental, or database backups")
+		}
+
+		opts := backup.CollectionsOptions{
+			DB:               ns.DB,
+			Include:          include,
+			Exclude:          exclude,
+			Target:           target,
+			Workers:          workers,
+			IndexesOnly:      indexesOnly,
+			Compress:         compress,
+			Snapshot:         snapshot,
+			IncrementalField: incremental,
+			EnableLogging:    true,
+		}
+		if ns.Collection != "" {
+			if len(include)+len(exclude) > 0 {
+				return errors.New("can only filter the collections of a database")
+			}
+			opts.DB = ""
+			opts.Namespaces = []model.Namespace{ns}
+		}
+
+		if since != "" {
+			data, err := os.ReadFile(since)
+			if err != nil {
+				return errors.Wrapf(err, "reading manifest '%s'", since)
+			}
+			opts.Since = &backup.Manifest{}
+			if err = json.Unmarshal(data, opts.Since); err != nil {
+				return errors.Wrapf(err, "parsing manifest '%s'", since)
+			}
+		}
+
+		cl, err := conn.connect(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = cl.Disconnect(context.Background()) }()
+
+		manifest, err := backup.Collections(ctx, cl, opts)
+		if err != nil {
+			return errors.Wrapf(err, "backing up '%s'", ns.DB)
+		}
+
+		fmt.Printf("backed up %d collections of '%s' at cluster time %d.%d\n", len(manifest.Collections), ns.DB, manifest.ClusterTime.T, manifest.ClusterTime.I)
+		return nil
+	}
+
+	if len(include)+len(exclude) > 0 {
+		return errors.New("can only filter the collections of a database")
+	}
+
+	opts := backup.Options{
+		NS:            ns,
+		Limit:         limit,
+		IndexesOnly:   indexesOnly,
+		Compress:      compress,
+		EnableLogging: true,
+		Target:        target,
+	}
+
+	if query != "" {
+		q := bson.M{}
+		if err := bson.UnmarshalExtJSON([]byte(query), false, &q); err != nil {
+			return errors.Wrap(err, "parsing query")
+		}
+		opts.Query = q
+	}
+
+	cl, err := conn.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cl.Disconnect(context.Background()) }()
+
+	return errors.Wrapf(backup.Collection(ctx, cl, opts), "backing up '%s'", ns)
+}
+
+func restoreBackup(ctx context.Context, args []string) error {
+	var (
+		conn   connectionFlags
+		opts   = backup.RestoreOptions{EnableLogging: true}
+		in     string
+		layers stringList
+	)
+
+	fs := flag.NewFlagSet("restore-backup", flag.ExitOnError)
+	fs.StringVar(&opts.NS.DB, "db", "", "the database of the backed up collection")
+	fs.StringVar(&opts.NS.Collection, "collection", "", "the backed up collection")
+	fs.StringVar(&opts.Into.DB, "into-db", "", "the database to restore into, if not the backed up database")
+	fs.StringVar(&opts.Into.Collection, "into-collection", "", "the collection to restore into, if not the backed up collection")
+	fs.StringVar(&in, "in", ".", "the directory to read the backup from")
+	fs.Var(&layers, "layer", "the directory of an incremental backup to apply, in order (may be repeated)")
+	fs.IntVar(&opts.BatchSize, "batch-size", 0, "the number of documents to write at a time")
+	fs.BoolVar(&opts.Upsert, "upsert", false, "replace documents that have the same _id as documents in the backup")
+	fs.BoolVar(&opts.IndexesOnly, "indexes-only", false, "only restore the collection's indexes")
+	fs.BoolVar(&opts.DocumentsOnly, "documents-only", false, "only restore the collection's documents")
+	fs.BoolVar(&opts.Compress, "gzip", false, "restore a backup whose files are compressed with gzip")
+	fs.StringVar(&conn.uri, "uri", "mongodb://localhost:27017", "the URI of the database")
+	_ = fs.Parse(args)
+
+	if !opts.NS.IsValid() {
+		return errors.New("must specify a database and a collection")
+	}
+	if opts.Into.DB == "" && opts.Into.Collection != "" {
+		opts.Into.DB = opts.NS.DB
+	}
+	if opts.Into.Collection == "" && opts.Into.DB != "" {
+		opts.Into.Collection = opts.NS.Collection
+	}
+
+	opts.Source = backup.DirectorySource(in)
+	for _, dir := range layers {
+		opts.Layers = append(opts.Layers, backup.DirectorySource(dir))
+	}
+
+	cl, err := conn.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cl.Disconnect(context.Background()) }()
+
+	return errors.Wrapf(backup.Restore(ctx, cl, opts), "restoring '%s'", opts.NS)
+}
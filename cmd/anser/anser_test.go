@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/anser"
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionFlags(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	parse := func(t *testing.T, args ...string) connectionFlags {
+		var f connectionFlags
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		f.register(fs)
+		require.NoError(t, fs.Parse(args))
+		return f
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		f := parse(t)
+		assert.Equal(t, "mongodb://localhost:27017", f.uri)
+		assert.Equal(t, queueLocal, f.queue)
+		assert.Equal(t, 2, f.workers)
+		assert.Equal(t, 100000, f.capacity)
+	})
+	t.Run("Values", func(t *testing.T) {
+		f := parse(t, "--uri", "mongodb://db:27018", "--queue", queueMongoDB, "--queue-db", "jobs", "--queue-collection", "migrations", "--workers", "8", "--queue-capacity", "10")
+		assert.Equal(t, "mongodb://db:27018", f.uri)
+		assert.Equal(t, queueMongoDB, f.queue)
+		assert.Equal(t, "jobs", f.queueDB)
+		assert.Equal(t, "migrations", f.queueCollection)
+		assert.Equal(t, 8, f.workers)
+		assert.Equal(t, 10, f.capacity)
+	})
+	t.Run("LocalQueue", func(t *testing.T) {
+		f := parse(t, "--queue-capacity", "10")
+		q, err := f.newQueue(ctx, nil)
+		require.NoError(t, err)
+		assert.NotNil(t, q)
+	})
+	t.Run("InvalidQueue", func(t *testing.T) {
+		f := parse(t, "--workers", "0")
+		_, err := f.newQueue(ctx, nil)
+		assert.Error(t, err)
+
+		f = parse(t, "--queue-capacity", "0")
+		_, err = f.newQueue(ctx, nil)
+		assert.Error(t, err)
+
+		f = parse(t, "--queue", "redis")
+		_, err = f.newQueue(ctx, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestPlan(t *testing.T) {
+	conf := &model.Configuration{
+		SimpleMigrations: []model.ConfigurationSimpleMigration{
+			{Options: model.GeneratorOptions{JobID: "second", DependsOn: []string{"first"}}},
+			{Options: model.GeneratorOptions{JobID: "first"}},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	require.NoError(t, writePlan(out, conf))
+	assert.Equal(t, "first\nsecond\n", out.String())
+
+	conf.SimpleMigrations[1].Options.DependsOn = []string{"second"}
+	assert.Error(t, writePlan(&bytes.Buffer{}, conf))
+}
+
+func TestStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	setup := func() *mock.Environment {
+		meta := &mock.Collection{FindCursor: &mock.Cursor{
+			ShouldIter:   true,
+			MaxNextCalls: 3,
+			Results: []interface{}{
+				&model.MigrationMetadata{ID: "first", Migration: "first", Completed: true, Generated: 2},
+				&model.MigrationMetadata{ID: "first.a.0", Migration: "first", Completed: true, HasErrors: true, Errors: []string{"failed"}},
+			},
+		}}
+
+		env := mock.NewEnvironment()
+		env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+		env.Client = mock.NewClient()
+		env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{"migrations.metadata": meta}}
+		return env
+	}
+
+	t.Run("Table", func(t *testing.T) {
+		out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+		require.NoError(t, writeStatus(ctx, out, errOut, setup(), []string{"first"}, false))
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		require.Len(t, lines, 2)
+		assert.True(t, strings.HasPrefix(lines[0], "MIGRATION"))
+		assert.Equal(t, []string{"first", string(model.MigrationStateFailed), "2", "0", "1", "1", "-"}, strings.Fields(lines[1]))
+		assert.Equal(t, "first: first.a.0: failed\n", errOut.String())
+	})
+	t.Run("JSON", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, writeStatus(ctx, out, &bytes.Buffer{}, setup(), []string{"first"}, true))
+
+		statuses := []model.MigrationStatus{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &statuses))
+		require.Len(t, statuses, 1)
+		assert.Equal(t, "first", statuses[0].Migration)
+		assert.Equal(t, 2, statuses[0].Generated)
+		assert.Equal(t, 1, statuses[0].Failed)
+	})
+}
+
+func TestCheckCapacity(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source := &mock.Collection{CountResult: 10}
+	env := mock.NewEnvironment()
+	env.Client = mock.NewClient()
+	env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": source}}
+
+	opts := model.GeneratorOptions{
+		JobID: "first",
+		NS:    model.Namespace{DB: "foo", Collection: "bar"},
+	}
+	conf := &model.Configuration{
+		SimpleMigrations: []model.ConfigurationSimpleMigration{
+			{Options: opts, Update: map[string]interface{}{"$set": map[string]interface{}{"a": 1}}},
+		},
+	}
+
+	app, err := anser.NewApplication(env, conf)
+	require.NoError(t, err)
+
+	// the generator and its ten migration operations
+	assert.NoError(t, checkCapacity(ctx, app, conf, 11))
+	assert.Error(t, checkCapacity(ctx, app, conf, 10))
+
+	conf.Options.Limit = 5
+	assert.NoError(t, checkCapacity(ctx, app, conf, 6))
+	assert.Error(t, checkCapacity(ctx, app, conf, 5))
+
+	conf.SimpleMigrations[0].Options.Continuous = &model.ContinuousOptions{IdleSeconds: 60}
+	assert.Error(t, checkCapacity(ctx, app, conf, 100))
+	conf.SimpleMigrations[0].Options.Continuous.MaxDocuments = 20
+	assert.NoError(t, checkCapacity(ctx, app, conf, 26))
+	assert.Error(t, checkCapacity(ctx, app, conf, 25))
+}
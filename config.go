@@ -8,7 +8,7 @@ import (
 
 // NewApplication constructs and sets up an application instance from
 // a configuration structure, presumably loaded from a configuration
-// file.
+// file with LoadConfiguration.
 //
 // You can construct an application instance using default
 // initializers, if you do not want to define the migrations using the
@@ -29,12 +29,39 @@ func NewApplication(env Environment, conf *model.Configuration) (*Application, e
 			continue
 		}
 
-		if g.Update == nil || len(g.Update) == 0 {
+		if len(g.Update) == 0 && len(g.Pipeline) == 0 {
 			catcher.Errorf("simple migration generator '%s' does not contain an update", g.Options.JobID)
 			continue
 		}
 
+		if len(g.Update) > 0 && len(g.Pipeline) > 0 {
+			catcher.Errorf("simple migration generator '%s' cannot contain both an update and an update pipeline", g.Options.JobID)
+			continue
+		}
+
+		if g.Options.Rollback != nil && g.Options.Rollback.Name != "" {
+			catcher.Errorf("simple migration generator '%s' must define its rollback as an update", g.Options.JobID)
+			continue
+		}
+
+		if g.Options.Snapshot != nil {
+			catcher.Errorf("simple migration generator '%s' cannot save snapshots", g.Options.JobID)
+			continue
+		}
+
+		if verify := g.Options.Verify; verify != nil && verify.Name != "" {
+			if _, ok := getVerification(env, verify.Name); !ok {
+				catcher.Errorf("simple migration verification '%s' is not defined", verify.Name)
+				continue
+			}
+		}
+
 		grip.Infof("registered simple migration '%s'", g.Options.JobID)
+		if len(g.Pipeline) > 0 {
+			app.Generators = append(app.Generators, NewSimplePipelineMigrationGenerator(env, g.Options, g.Pipeline))
+			continue
+		}
+
 		app.Generators = append(app.Generators, NewSimpleMigrationGenerator(env, g.Options, g.Update))
 	}
 
@@ -44,13 +71,37 @@ func NewApplication(env Environment, conf *model.Configuration) (*Application, e
 			continue
 		}
 
+		if g.Options.BulkWriteSize > 0 {
+			catcher.Errorf("manual migration generator '%s' cannot use bulk writes", g.Options.JobID)
+			continue
+		}
+
 		if _, ok := env.GetManualMigrationOperation(g.Name); !ok {
 			catcher.Errorf("manual migration operation '%s' is not defined ", g.Name)
 			continue
 		}
 
+		if rollback := g.Options.Rollback; rollback != nil {
+			if len(rollback.Update) > 0 {
+				catcher.Errorf("manual migration generator '%s' cannot define its rollback as an update", g.Options.JobID)
+				continue
+			}
+
+			if _, ok := env.GetManualMigrationOperation(rollback.Name); !ok {
+				catcher.Errorf("manual migration rollback operation '%s' is not defined", rollback.Name)
+				continue
+			}
+		}
+
+		if verify := g.Options.Verify; verify != nil && verify.Name != "" {
+			if _, ok := getVerification(env, verify.Name); !ok {
+				catcher.Errorf("manual migration verification '%s' is not defined", verify.Name)
+				continue
+			}
+		}
+
 		grip.Infof("registered manual migration '%s' (%s)", g.Options.JobID, g.Name)
-		app.Generators = append(app.Generators, NewManualMigrationGenerator(env, g.Options, g.Name))
+		app.Generators = append(app.Generators, NewManualMigrationGeneratorWithParams(env, g.Options, g.Name, g.Params))
 	}
 
 	for _, g := range conf.StreamMigrations {
@@ -59,13 +110,37 @@ func NewApplication(env Environment, conf *model.Configuration) (*Application, e
 			continue
 		}
 
+		if g.Options.BulkWriteSize > 0 {
+			catcher.Errorf("stream migration generator '%s' cannot use bulk writes", g.Options.JobID)
+			continue
+		}
+
 		if _, ok := env.GetDocumentProcessor(g.Name); !ok {
 			catcher.Errorf("stream migration operation '%s' is not defined", g.Name)
 			continue
 		}
 
+		if rollback := g.Options.Rollback; rollback != nil {
+			if len(rollback.Update) > 0 {
+				catcher.Errorf("stream migration generator '%s' cannot define its rollback as an update", g.Options.JobID)
+				continue
+			}
+
+			if _, ok := env.GetDocumentProcessor(rollback.Name); !ok {
+				catcher.Errorf("stream migration rollback operation '%s' is not defined", rollback.Name)
+				continue
+			}
+		}
+
+		if verify := g.Options.Verify; verify != nil && verify.Name != "" {
+			if _, ok := getVerification(env, verify.Name); !ok {
+				catcher.Errorf("stream migration verification '%s' is not defined", verify.Name)
+				continue
+			}
+		}
+
 		grip.Infof("registered stream migration '%s' (%s)", g.Options.JobID, g.Name)
-		app.Generators = append(app.Generators, NewStreamMigrationGenerator(env, g.Options, g.Name))
+		app.Generators = append(app.Generators, NewStreamMigrationGeneratorWithParams(env, g.Options, g.Name, g.Params))
 	}
 
 	if catcher.HasErrors() {
@@ -78,3 +153,42 @@ func NewApplication(env Environment, conf *model.Configuration) (*Application, e
 
 	return app, nil
 }
+
+// PlanConfiguration returns the IDs of the configuration's generators
+// in the order that their migrations run, like Plan, without
+// constructing an application. Because it only reads the generators'
+// options, PlanConfiguration does not need an environment or the
+// migration operations to be registered.
+func PlanConfiguration(conf *model.Configuration) ([]string, error) {
+	if conf == nil {
+		return nil, errors.New("cannot specify a nil configuration")
+	}
+
+	opts := []model.GeneratorOptions{}
+	for _, g := range conf.SimpleMigrations {
+		opts = append(opts, g.Options)
+	}
+	for _, g := range conf.ManualMigrations {
+		opts = append(opts, g.Options)
+	}
+	for _, g := range conf.StreamMigrations {
+		opts = append(opts, g.Options)
+	}
+
+	catcher := grip.NewBasicCatcher()
+	network := newDependencyNetwork()
+	seen := make(map[string]struct{}, len(opts))
+	for _, o := range opts {
+		if _, ok := seen[o.JobID]; ok {
+			catcher.Errorf("generator '%s' is defined more than once", o.JobID)
+			continue
+		}
+		seen[o.JobID] = struct{}{}
+		network.Add(o.JobID, o.DependsOn)
+	}
+	if catcher.HasErrors() {
+		return nil, catcher.Resolve()
+	}
+
+	return planNetwork(network)
+}
@@ -0,0 +1,245 @@
+package anser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// configurationFileExtensions are the extensions of the files that
+// LoadConfiguration reads from directories.
+var configurationFileExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// LoadConfiguration reads migration configurations from YAML or JSON
+// files, or from directories of them, and merges them into one
+// configuration that can be passed to NewApplication. Files in a
+// directory are read in order of their names, and only files with a
+// .yaml, .yml, or .json extension are read.
+//
+// Decoding is strict: fields that are not part of the configuration
+// are errors. The migrations of all files are combined, but only one
+// file may set the application options, and generator IDs must be
+// unique across all files. Errors for invalid generator options
+// include the file, line, and column of the option.
+func LoadConfiguration(paths ...string) (*model.Configuration, error) {
+	files, err := configurationFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &model.Configuration{}
+	optionsFile := ""
+	generators := map[string]string{}
+	catcher := grip.NewBasicCatcher()
+
+	for _, fn := range files {
+		fileConf, locations, err := loadConfigurationFile(fn)
+		if err != nil {
+			catcher.Add(err)
+			continue
+		}
+		if fileConf == nil {
+			continue
+		}
+
+		if !reflect.DeepEqual(fileConf.Options, model.ApplicationOptions{}) {
+			if optionsFile != "" {
+				catcher.Errorf("%s: application options are already set in '%s'", locations.options, optionsFile)
+			} else {
+				optionsFile = fn
+				conf.Options = fileConf.Options
+			}
+		}
+
+		for id, loc := range locations.generators {
+			if prev, ok := generators[id]; ok {
+				catcher.Errorf("%s: generator '%s' is already defined at %s", loc, id, prev)
+				continue
+			}
+			generators[id] = loc.String()
+		}
+		catcher.Extend(locations.errors)
+
+		conf.SimpleMigrations = append(conf.SimpleMigrations, fileConf.SimpleMigrations...)
+		conf.ManualMigrations = append(conf.ManualMigrations, fileConf.ManualMigrations...)
+		conf.StreamMigrations = append(conf.StreamMigrations, fileConf.StreamMigrations...)
+	}
+
+	if catcher.HasErrors() {
+		return nil, catcher.Resolve()
+	}
+
+	return conf, nil
+}
+
+// configurationFiles expands the directories in the paths into the
+// configuration files that they contain.
+func configurationFiles(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no configuration files specified")
+	}
+
+	out := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading configuration '%s'", path)
+		}
+
+		if !info.IsDir() {
+			out = append(out, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading configuration directory '%s'", path)
+		}
+
+		names := []string{}
+		for _, entry := range entries {
+			if !entry.IsDir() && configurationFileExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+				names = append(names, entry.Name())
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			out = append(out, filepath.Join(path, name))
+		}
+	}
+
+	return out, nil
+}
+
+// configurationLocation is a position in a configuration file.
+type configurationLocation struct {
+	file   string
+	line   int
+	column int
+}
+
+func (l configurationLocation) String() string {
+	return fmt.Sprintf("%s:%d:%d", l.file, l.line, l.column)
+}
+
+// configurationLocations holds the positions of the parts of a
+// configuration file, and the errors for its invalid generators.
+type configurationLocations struct {
+	options    configurationLocation
+	generators map[string]configurationLocation
+	errors     []error
+}
+
+// loadConfigurationFile strictly decodes the file, and returns a nil
+// configuration if the file is empty. JSON files are decoded with the
+// YAML decoder, so that the errors for both formats report the line
+// and column of the problem.
+func loadConfigurationFile(fn string) (*model.Configuration, *configurationLocations, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "reading configuration '%s'", fn)
+	}
+
+	conf := &model.Configuration{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err = dec.Decode(conf); err != nil {
+		if err == io.EOF {
+			return nil, nil, nil
+		}
+		return nil, nil, errors.Wrapf(err, "decoding configuration '%s'", fn)
+	}
+
+	root := &yaml.Node{}
+	if err = yaml.Unmarshal(data, root); err != nil {
+		return nil, nil, errors.Wrapf(err, "decoding configuration '%s'", fn)
+	}
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+
+	locations := &configurationLocations{
+		options:    nodeLocation(fn, root, "options"),
+		generators: map[string]configurationLocation{},
+	}
+
+	add := func(kind string, idx int, opts model.GeneratorOptions) {
+		item := sequenceItem(mappingValue(root, kind), idx)
+		optsNode := mappingValue(item, "options")
+		loc := nodeLocation(fn, item, "options")
+		if prev, ok := locations.generators[opts.JobID]; ok {
+			locations.errors = append(locations.errors, errors.Errorf("%s: generator '%s' is already defined at %s", loc, opts.JobID, prev))
+		} else if opts.JobID != "" {
+			locations.generators[opts.JobID] = loc
+		}
+
+		for _, problem := range opts.Problems() {
+			locations.errors = append(locations.errors, errors.Errorf("%s: %s generator '%s': '%s' %s",
+				nodeLocation(fn, optsNode, problem.Field), strings.TrimSuffix(kind, "_migrations"), opts.JobID, problem.Field, problem.Message))
+		}
+	}
+
+	for idx, g := range conf.SimpleMigrations {
+		add("simple_migrations", idx, g.Options)
+	}
+	for idx, g := range conf.ManualMigrations {
+		add("manual_migrations", idx, g.Options)
+	}
+	for idx, g := range conf.StreamMigrations {
+		add("stream_migrations", idx, g.Options)
+	}
+
+	return conf, locations, nil
+}
+
+// mappingValue returns the value of the key in the mapping node, or
+// nil if the node is not a mapping or does not have the key.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func sequenceItem(node *yaml.Node, idx int) *yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode || idx >= len(node.Content) {
+		return nil
+	}
+
+	return node.Content[idx]
+}
+
+// nodeLocation returns the location of the value of the key in the
+// mapping node, or of the node itself if it does not have the key.
+func nodeLocation(fn string, node *yaml.Node, key string) configurationLocation {
+	if value := mappingValue(node, key); value != nil {
+		node = value
+	}
+	if node == nil {
+		return configurationLocation{file: fn, line: 1, column: 1}
+	}
+
+	return configurationLocation{file: fn, line: node.Line, column: node.Column}
+}
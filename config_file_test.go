@@ -0,0 +1,252 @@
+package anser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadConfiguration(t *testing.T) {
+	write := func(t *testing.T, dir, name, content string) string {
+		fn := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(fn, []byte(content), 0600))
+		return fn
+	}
+
+	const simple = `options:
+  dry_run: true
+simple_migrations:
+  - options:
+      id: first
+      namespace:
+        db_name: foo
+        collection: bar
+      query:
+        a: 1
+    update:
+      $set:
+        b: 2
+`
+	const manual = `{
+  "manual_migrations": [
+    {
+      "options": {"id": "second", "namespace": {"db_name": "foo", "collection": "bar"}, "dependencies": ["first"]},
+      "name": "op",
+      "params": {"key": "value"}
+    }
+  ]
+}
+`
+
+	t.Run("NoPaths", func(t *testing.T) {
+		_, err := LoadConfiguration()
+		assert.Error(t, err)
+	})
+	t.Run("MissingFile", func(t *testing.T) {
+		_, err := LoadConfiguration(filepath.Join(t.TempDir(), "missing.yaml"))
+		assert.Error(t, err)
+	})
+	t.Run("Directory", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, "01-simple.yaml", simple)
+		write(t, dir, "02-manual.json", manual)
+		write(t, dir, "03-empty.yml", "")
+		write(t, dir, "README.md", "not a migration")
+
+		conf, err := LoadConfiguration(dir)
+		require.NoError(t, err)
+		assert.True(t, conf.Options.DryRun)
+		require.Len(t, conf.SimpleMigrations, 1)
+		assert.Equal(t, "first", conf.SimpleMigrations[0].Options.JobID)
+		assert.Equal(t, map[string]interface{}{"$set": map[string]interface{}{"b": 2}}, conf.SimpleMigrations[0].Update)
+		require.Len(t, conf.ManualMigrations, 1)
+		assert.Equal(t, []string{"first"}, conf.ManualMigrations[0].Options.DependsOn)
+		assert.Equal(t, map[string]string{"key": "value"}, conf.ManualMigrations[0].Params)
+
+		env := mock.NewEnvironment()
+		env.MigrationRegistry["op"] = nil
+		app, err := NewApplication(env, conf)
+		require.NoError(t, err)
+		assert.Len(t, app.Generators, 2)
+	})
+	t.Run("UnknownField", func(t *testing.T) {
+		fn := write(t, t.TempDir(), "conf.yaml", "simple_migrations:\n  - options:\n      id: first\n      limt: 1\n")
+
+		_, err := LoadConfiguration(fn)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "line 4: field limt not found")
+	})
+	t.Run("InvalidOptions", func(t *testing.T) {
+		fn := write(t, t.TempDir(), "conf.yaml", `simple_migrations:
+  - options:
+      id: first
+      limit: -1
+    update:
+      $set:
+        b: 2
+stream_migrations:
+  - options:
+      namespace: {db_name: foo, collection: bar}
+    name: op
+`)
+
+		_, err := LoadConfiguration(fn)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fn+":3:7: simple generator 'first': 'namespace' must have a database and a collection")
+		assert.Contains(t, err.Error(), fn+":4:14: simple generator 'first': 'limit' cannot be negative")
+		assert.Contains(t, err.Error(), fn+":10:7: stream generator '': 'id' must be set")
+	})
+	t.Run("InvalidCanary", func(t *testing.T) {
+		fn := write(t, t.TempDir(), "conf.yaml", `simple_migrations:
+  - options:
+      id: first
+      namespace: {db_name: foo, collection: bar}
+      checkpoint_interval: 10
+      canary: {count: 10, percent: 5}
+    update: {$set: {b: 2}}
+`)
+
+		_, err := LoadConfiguration(fn)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fn+":6:15: simple generator 'first': 'canary' must set either a count or a percent, and a known method")
+		assert.Contains(t, err.Error(), fn+":6:15: simple generator 'first': 'canary' cannot be used with checkpoints")
+	})
+	t.Run("InvalidVerify", func(t *testing.T) {
+		fn := write(t, t.TempDir(), "conf.yaml", `simple_migrations:
+  - options:
+      id: first
+      namespace: {db_name: foo, collection: bar}
+      verify: {}
+    update: {$set: {b: 2}}
+`)
+
+		_, err := LoadConfiguration(fn)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fn+":5:15: simple generator 'first': 'verify' must set a query or the name of a verification")
+	})
+	t.Run("InvalidSnapshot", func(t *testing.T) {
+		fn := write(t, t.TempDir(), "conf.yaml", `manual_migrations:
+  - options:
+      id: first
+      namespace: {db_name: foo, collection: bar}
+      snapshot: {ttl_secs: -1}
+    name: op
+`)
+
+		_, err := LoadConfiguration(fn)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fn+":5:17: manual generator 'first': 'snapshot' cannot have a negative ttl")
+	})
+	t.Run("InvalidBackup", func(t *testing.T) {
+		fn := write(t, t.TempDir(), "conf.yaml", `stream_migrations:
+  - options:
+      id: first
+      namespace: {db_name: foo, collection: bar}
+      backup: {compress: true}
+    name: proc
+`)
+
+		_, err := LoadConfiguration(fn)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fn+":5:15: stream generator 'first': 'backup' must set a path")
+	})
+	t.Run("InvalidContinuous", func(t *testing.T) {
+		fn := write(t, t.TempDir(), "conf.yaml", `manual_migrations:
+  - options:
+      id: first
+      namespace: {db_name: foo, collection: bar}
+      checkpoint_interval: 100
+      continuous: {idle_secs: 60}
+    name: proc
+`)
+
+		_, err := LoadConfiguration(fn)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fn+":6:19: manual generator 'first': 'continuous' cannot be used with canaries, checkpoints, or bulk writes")
+	})
+	t.Run("EveryProblemIsLocated", func(t *testing.T) {
+		fields := map[string]bool{}
+		optsType := reflect.TypeOf(model.GeneratorOptions{})
+		for i := 0; i < optsType.NumField(); i++ {
+			fields[strings.Split(optsType.Field(i).Tag.Get("yaml"), ",")[0]] = true
+		}
+
+		ns := model.Namespace{DB: "foo", Collection: "bar"}
+		for name, opts := range map[string]model.GeneratorOptions{
+			"ID":                 {NS: ns},
+			"Namespace":          {JobID: "first"},
+			"Limit":              {JobID: "first", NS: ns, Limit: -1},
+			"BatchSize":          {JobID: "first", NS: ns, BatchSize: -1},
+			"CheckpointInterval": {JobID: "first", NS: ns, CheckpointInterval: -1},
+			"BulkWriteSize":      {JobID: "first", NS: ns, BulkWriteSize: -1},
+			"RateLimit":          {JobID: "first", NS: ns, RateLimit: &model.RateLimit{MaxConcurrentJobs: -1}},
+			"Canary":             {JobID: "first", NS: ns, Canary: &model.Canary{}},
+			"CanaryCheckpoints":  {JobID: "first", NS: ns, CheckpointInterval: 10, Canary: &model.Canary{Count: 10}},
+			"Verify":             {JobID: "first", NS: ns, Verify: &model.VerifyOptions{}},
+			"Snapshot":           {JobID: "first", NS: ns, Snapshot: &model.SnapshotOptions{TTLSeconds: -1}},
+			"Backup":             {JobID: "first", NS: ns, Backup: &model.BackupOptions{}},
+			"Continuous":         {JobID: "first", NS: ns, Continuous: &model.ContinuousOptions{IdleSeconds: -1}},
+			"ContinuousBulk":     {JobID: "first", NS: ns, BulkWriteSize: 10, Continuous: &model.ContinuousOptions{}},
+		} {
+			t.Run(name, func(t *testing.T) {
+				require.False(t, opts.IsValid())
+				problems := opts.Problems()
+				require.NotEmpty(t, problems)
+
+				content, err := yaml.Marshal(map[string]interface{}{
+					"simple_migrations": []interface{}{
+						map[string]interface{}{"options": opts, "update": map[string]interface{}{"$set": map[string]interface{}{"b": 2}}},
+					},
+				})
+				require.NoError(t, err)
+				fn := write(t, t.TempDir(), "conf.yaml", string(content))
+
+				_, err = LoadConfiguration(fn)
+				require.Error(t, err)
+				for _, problem := range problems {
+					assert.True(t, fields[problem.Field], problem.Field)
+					assert.Contains(t, err.Error(), fmt.Sprintf("simple generator '%s': '%s' %s", opts.JobID, problem.Field, problem.Message))
+				}
+			})
+		}
+	})
+	t.Run("DuplicateGenerators", func(t *testing.T) {
+		dir := t.TempDir()
+		first := write(t, dir, "a.yaml", simple)
+		second := write(t, dir, "b.yaml", "simple_migrations:\n  - options:\n      id: first\n      namespace: {db_name: foo, collection: bar}\n    update: {$set: {b: 2}}\n")
+
+		_, err := LoadConfiguration(first, second)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), second+":3:7: generator 'first' is already defined at "+first+":5:7")
+	})
+	t.Run("DuplicateGeneratorsInFile", func(t *testing.T) {
+		fn := write(t, t.TempDir(), "a.yaml", simple+`manual_migrations:
+  - options:
+      id: first
+      namespace: {db_name: foo, collection: bar}
+    name: op
+`)
+
+		_, err := LoadConfiguration(fn)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fn+":16:7: generator 'first' is already defined at "+fn+":5:7")
+	})
+	t.Run("DuplicateOptions", func(t *testing.T) {
+		dir := t.TempDir()
+		first := write(t, dir, "a.yaml", "options: {limit: 10}\n")
+		second := write(t, dir, "b.yaml", "\noptions: {dry_run: true}\n")
+
+		_, err := LoadConfiguration(first, second)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), second+":2:10: application options are already set in '"+first+"'")
+	})
+}
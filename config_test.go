@@ -3,6 +3,8 @@ package anser
 import (
 	"testing"
 
+	"github.com/evergreen-ci/birch"
+	"github.com/mongodb/anser/client"
 	"github.com/mongodb/anser/mock"
 	"github.com/mongodb/anser/model"
 	"github.com/stretchr/testify/require"
@@ -59,6 +61,90 @@ func TestApplicationConstructor(t *testing.T) {
 	require.NotNil(app)
 	require.Len(app.Generators, 1)
 
+	///////////////////////////////////
+	//
+	// simple migrations may use an update pipeline instead of an update
+
+	conf.SimpleMigrations[0].Pipeline = []map[string]interface{}{{"$set": map[string]interface{}{"a": "$b"}}}
+	app, err = NewApplication(env, conf)
+	require.Error(err)
+	require.Nil(app)
+
+	conf.SimpleMigrations[0].Update = nil
+	app, err = NewApplication(env, conf)
+	require.NoError(err)
+	require.NotNil(app)
+	require.Len(app.Generators, 1)
+	require.Equal(conf.SimpleMigrations[0].Pipeline, app.Generators[0].(*simpleMigrationGenerator).Pipeline)
+
+	conf.SimpleMigrations[0].Update = map[string]interface{}{"$set": 1}
+	conf.SimpleMigrations[0].Pipeline = nil
+
+	///////////////////////////////////
+	//
+	// rollback operations must be of the right kind and be registered
+
+	conf.SimpleMigrations[0].Options.Rollback = &model.RollbackOptions{Name: "inverse"}
+	app, err = NewApplication(env, conf)
+	require.Error(err)
+	require.Nil(app)
+
+	conf.SimpleMigrations[0].Options.Rollback = &model.RollbackOptions{Update: map[string]interface{}{"$unset": 1}}
+	app, err = NewApplication(env, conf)
+	require.NoError(err)
+	require.NotNil(app)
+
+	require.NoError(env.RegisterManualMigrationOperation("manualOne", func(client.Client, *birch.Document) error { return nil }))
+	conf.ManualMigrations = []model.ConfigurationManualMigration{
+		{
+			Options: model.GeneratorOptions{
+				JobID:    "foo-1",
+				NS:       model.Namespace{DB: "db", Collection: "coll"},
+				Rollback: &model.RollbackOptions{Name: "manualInverse"},
+			},
+			Name: "manualOne",
+		},
+	}
+	app, err = NewApplication(env, conf)
+	require.Error(err)
+	require.Nil(app)
+
+	require.NoError(env.RegisterManualMigrationOperation("manualInverse", func(client.Client, *birch.Document) error { return nil }))
+	app, err = NewApplication(env, conf)
+	require.NoError(err)
+	require.NotNil(app)
+	require.Len(app.Generators, 2)
+
+	conf.ManualMigrations[0].Options.Rollback = &model.RollbackOptions{Update: map[string]interface{}{"$unset": 1}}
+	app, err = NewApplication(env, conf)
+	require.Error(err)
+	require.Nil(app)
+	conf.ManualMigrations = nil
+
+	///////////////////////////////////
+	//
+	// only simple migrations support bulk writes
+
+	conf.SimpleMigrations[0].Options.BulkWriteSize = 100
+	app, err = NewApplication(env, conf)
+	require.NoError(err)
+	require.NotNil(app)
+
+	conf.ManualMigrations = []model.ConfigurationManualMigration{
+		{
+			Options: model.GeneratorOptions{
+				JobID:         "foo-2",
+				NS:            model.Namespace{DB: "db", Collection: "coll"},
+				BulkWriteSize: 100,
+			},
+			Name: "manualOne",
+		},
+	}
+	app, err = NewApplication(env, conf)
+	require.Error(err)
+	require.Nil(app)
+	conf.ManualMigrations = nil
+
 	///////////////////////////////////
 	//
 	// construct invalid migrations, and ensure that it errors
@@ -120,3 +206,124 @@ func TestApplicationConstructor(t *testing.T) {
 	require.Error(err)
 	require.Nil(app)
 }
+
+func TestApplicationConstructorParams(t *testing.T) {
+	env := mock.NewEnvironment()
+	env.MigrationRegistry["manual"] = nil
+	env.ProcessorRegistry["stream"] = &mock.Processor{}
+
+	params := map[string]string{"field": "name"}
+	conf := &model.Configuration{
+		ManualMigrations: []model.ConfigurationManualMigration{
+			{
+				Options: model.GeneratorOptions{JobID: "manual-0", NS: model.Namespace{DB: "db", Collection: "coll"}},
+				Name:    "manual",
+				Params:  params,
+			},
+		},
+		StreamMigrations: []model.ConfigurationManualMigration{
+			{
+				Options: model.GeneratorOptions{JobID: "stream-0", NS: model.Namespace{DB: "db", Collection: "coll"}},
+				Name:    "stream",
+				Params:  params,
+			},
+		},
+	}
+
+	app, err := NewApplication(env, conf)
+	require.NoError(t, err)
+	require.Len(t, app.Generators, 2)
+	require.Equal(t, params, app.Generators[0].(*manualMigrationGenerator).Params)
+	require.Equal(t, params, app.Generators[1].(*streamMigrationGenerator).Params)
+}
+
+func TestApplicationConstructorVerify(t *testing.T) {
+	env := mock.NewEnvironment()
+	conf := &model.Configuration{
+		SimpleMigrations: []model.ConfigurationSimpleMigration{
+			{
+				Options: model.GeneratorOptions{
+					JobID:  "simple-0",
+					NS:     model.Namespace{DB: "db", Collection: "coll"},
+					Verify: &model.VerifyOptions{Name: "check"},
+				},
+				Update: map[string]interface{}{"$set": 1},
+			},
+		},
+	}
+
+	app, err := NewApplication(env, conf)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "verification 'check' is not defined")
+	require.Nil(t, app)
+
+	env.VerifyRegistry["check"] = nil
+	app, err = NewApplication(env, conf)
+	require.NoError(t, err)
+	require.Equal(t, conf.SimpleMigrations[0].Options.Verify, app.Generators[0].(*simpleMigrationGenerator).Verify)
+}
+
+func TestApplicationConstructorSnapshot(t *testing.T) {
+	env := mock.NewEnvironment()
+	env.MigrationRegistry["manual"] = nil
+	snapshot := &model.SnapshotOptions{TTLSeconds: 3600}
+	conf := &model.Configuration{
+		SimpleMigrations: []model.ConfigurationSimpleMigration{
+			{
+				Options: model.GeneratorOptions{JobID: "simple-0", NS: model.Namespace{DB: "db", Collection: "coll"}, Snapshot: snapshot},
+				Update:  map[string]interface{}{"$set": 1},
+			},
+		},
+	}
+
+	app, err := NewApplication(env, conf)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "simple migration generator 'simple-0' cannot save snapshots")
+	require.Nil(t, app)
+
+	conf.SimpleMigrations = nil
+	conf.ManualMigrations = []model.ConfigurationManualMigration{
+		{
+			Options: model.GeneratorOptions{JobID: "manual-0", NS: model.Namespace{DB: "db", Collection: "coll"}, Snapshot: snapshot},
+			Name:    "manual",
+		},
+	}
+	app, err = NewApplication(env, conf)
+	require.NoError(t, err)
+	require.Equal(t, snapshot, app.Generators[0].(*manualMigrationGenerator).Snapshot)
+}
+
+func TestPlanConfiguration(t *testing.T) {
+	ns := model.Namespace{DB: "db", Collection: "coll"}
+	conf := &model.Configuration{
+		SimpleMigrations: []model.ConfigurationSimpleMigration{
+			{Options: model.GeneratorOptions{JobID: "third", NS: ns, DependsOn: []string{"second"}}},
+		},
+		ManualMigrations: []model.ConfigurationManualMigration{
+			{Options: model.GeneratorOptions{JobID: "first", NS: ns}, Name: "unregistered"},
+		},
+		StreamMigrations: []model.ConfigurationManualMigration{
+			{Options: model.GeneratorOptions{JobID: "second", NS: ns, DependsOn: []string{"first"}}, Name: "unregistered"},
+		},
+	}
+
+	order, err := PlanConfiguration(conf)
+	require.NoError(t, err)
+	require.Equal(t, []string{"first", "second", "third"}, order)
+
+	conf.SimpleMigrations = append(conf.SimpleMigrations, model.ConfigurationSimpleMigration{
+		Options: model.GeneratorOptions{JobID: "first", NS: ns},
+	})
+	_, err = PlanConfiguration(conf)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "generator 'first' is defined more than once")
+
+	conf.SimpleMigrations = conf.SimpleMigrations[:1]
+	conf.SimpleMigrations[0].Options.DependsOn = []string{"missing"}
+	_, err = PlanConfiguration(conf)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "'third' depends on 'missing', which is not defined")
+
+	_, err = PlanConfiguration(nil)
+	require.Error(t, err)
+}
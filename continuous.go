@@ -0,0 +1,408 @@
+package anser
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// continuousStopInterval is how often continuous generators check
+// whether they have been asked to stop.
+const continuousStopInterval = time.Second
+
+// continuousStopID returns the ID of the document in the metadata
+// namespace that asks the continuous generator to stop.
+func continuousStopID(generator string) string { return fmt.Sprintf("%s.stop", generator) }
+
+// StopContinuousMigration asks the continuous generator of the
+// migration to stop watching for changes. The generator stops within
+// a few seconds, after it produces operations for the changes that it
+// has already seen, and then completes. Requests to stop a generator
+// that has not started to watch for changes have no effect.
+func StopContinuousMigration(ctx context.Context, env Environment, migration string) error {
+	if migration == "" {
+		return errors.New("cannot stop a migration without a name")
+	}
+
+	cl, err := env.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "getting database client")
+	}
+
+	ns := env.MetadataNamespace()
+	_, err = cl.Database(ns.DB).Collection(ns.Collection).UpdateOne(ctx,
+		bson.M{"_id": continuousStopID(migration)},
+		bson.M{"$set": bson.M{"generator": migration, "requested_at": time.Now()}},
+		options.Update().SetUpsert(true))
+
+	return errors.Wrapf(err, "stopping migration '%s'", migration)
+}
+
+// stopRequested reports whether the continuous generator has been
+// asked to stop.
+func stopRequested(ctx context.Context, env Environment, generator string) (bool, error) {
+	cl, err := env.GetClient()
+	if err != nil {
+		return false, errors.Wrap(err, "getting database client")
+	}
+
+	ns := env.MetadataNamespace()
+	res := cl.Database(ns.DB).Collection(ns.Collection).FindOne(ctx, bson.M{"_id": continuousStopID(generator)})
+	if err = res.Err(); err == mongo.ErrNoDocuments {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "finding stop request")
+	}
+
+	return true, nil
+}
+
+// clearStopRequest removes a request to stop the generator from a
+// previous run.
+func clearStopRequest(ctx context.Context, env Environment, generator string) error {
+	cl, err := env.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "getting database client")
+	}
+
+	ns := env.MetadataNamespace()
+	_, err = cl.Database(ns.DB).Collection(ns.Collection).DeleteMany(ctx, bson.M{"_id": continuousStopID(generator)})
+	return errors.Wrap(err, "clearing stop request")
+}
+
+// changeStreamFilter returns the filter of change events for the
+// documents that match the generator's query after the change. Change
+// events hold the document in the fullDocument field, so the filter
+// prefixes the query's fields; queries that use top level operators
+// other than $and, $or, and $nor cannot be used.
+func changeStreamFilter(query map[string]interface{}) (bson.M, error) {
+	filter, err := prefixQuery(query, "fullDocument")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	filter["operationType"] = bson.M{"$in": []string{"insert", "update", "replace"}}
+	return filter, nil
+}
+
+func prefixQuery(query map[string]interface{}, prefix string) (bson.M, error) {
+	out := bson.M{}
+	for key, value := range query {
+		if !strings.HasPrefix(key, "$") {
+			out[prefix+"."+key] = value
+			continue
+		}
+
+		switch key {
+		case "$and", "$or", "$nor":
+		default:
+			return nil, errors.Errorf("cannot watch for changes with the '%s' operator", key)
+		}
+
+		clauses, err := queryClauses(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid '%s' clause", key)
+		}
+
+		prefixed := make([]interface{}, 0, len(clauses))
+		for _, clause := range clauses {
+			p, err := prefixQuery(clause, prefix)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			prefixed = append(prefixed, p)
+		}
+		out[key] = prefixed
+	}
+
+	return out, nil
+}
+
+// queryClauses returns the queries of an $and, $or, or $nor operator.
+func queryClauses(value interface{}) ([]map[string]interface{}, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		items = v
+	case []map[string]interface{}:
+		return v, nil
+	case []bson.M:
+		out := make([]map[string]interface{}, 0, len(v))
+		for _, clause := range v {
+			out = append(out, clause)
+		}
+		return out, nil
+	default:
+		return nil, errors.Errorf("clauses must be a list, not %T", value)
+	}
+
+	out := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		switch clause := item.(type) {
+		case map[string]interface{}:
+			out = append(out, clause)
+		case bson.M:
+			out = append(out, clause)
+		default:
+			return nil, errors.Errorf("clauses must be documents, not %T", item)
+		}
+	}
+
+	return out, nil
+}
+
+// watchGenerator opens a change stream of the documents that match
+// the query, for continuous generators, which must open the stream
+// before they find the documents that already match, so that they
+// see every change made after they start. watchGenerator returns nil
+// for generators that are not continuous, and during dry runs, which
+// only report on the documents that already match.
+func watchGenerator(ctx context.Context, env Environment, generator string, coll client.Collection, query map[string]interface{}, opts *model.ContinuousOptions, dryRun bool) (client.ChangeStream, error) {
+	if opts == nil || dryRun {
+		return nil, nil
+	}
+
+	filter, err := changeStreamFilter(query)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err = clearStopRequest(ctx, env, generator); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stream, err := coll.Watch(ctx, []bson.M{{"$match": filter}},
+		options.ChangeStream().SetFullDocument(options.UpdateLookup).SetMaxAwaitTime(continuousStopInterval))
+	if err != nil {
+		return nil, errors.Wrapf(err, "watching for changes for migration '%s'", generator)
+	}
+
+	return stream, nil
+}
+
+// changeEvent holds the fields of change events that continuous
+// generators use.
+type changeEvent struct {
+	DocumentKey bson.Raw `bson:"documentKey"`
+}
+
+// continuousCursor returns the documents of the generator's cursor,
+// and then the keys of the documents from the change stream, until
+// the generator reaches its cutover or is asked to stop. The cursor
+// skips changes to documents that it returned since the generator
+// last added its jobs to the queue, so that the generator does not
+// hold two operations for the same document. Later changes to a
+// document produce another operation, which repeats the migration's
+// update. The generator that opened the stream closes it.
+type continuousCursor struct {
+	client.Cursor
+	stream    client.ChangeStream
+	env       Environment
+	generator string
+	opts      model.ContinuousOptions
+
+	// seen holds the _id values of the documents that the cursor
+	// returned since the generator last added its jobs to the
+	// queue, as the raw BSON type and value.
+	seen map[string]struct{}
+
+	watching   bool
+	current    bson.Raw
+	changes    int
+	startedAt  time.Time
+	lastChange time.Time
+	lastCheck  time.Time
+	err        error
+}
+
+// newContinuousCursor wraps the generator's cursor so that it returns
+// the changed documents from the stream after the cursor's documents,
+// or returns the cursor if there is no stream.
+func newContinuousCursor(env Environment, generator string, cur client.Cursor, stream client.ChangeStream, opts *model.ContinuousOptions) client.Cursor {
+	if stream == nil || opts == nil {
+		return cur
+	}
+
+	return &continuousCursor{
+		Cursor:    cur,
+		stream:    stream,
+		env:       env,
+		generator: generator,
+		opts:      *opts,
+		seen:      map[string]struct{}{},
+	}
+}
+
+// documentKey returns the key of the document's _id value in the set
+// of documents that the cursor returned.
+func documentKey(doc bson.Raw) (string, error) {
+	id, err := doc.LookupErr("_id")
+	if err != nil {
+		return "", errors.Wrap(err, "finding document _id")
+	}
+
+	return string(rune(id.Type)) + string(id.Value), nil
+}
+
+func (c *continuousCursor) Next(ctx context.Context) bool {
+	if c.err != nil {
+		return false
+	}
+
+	if !c.watching {
+		if c.Cursor.Next(ctx) {
+			return true
+		}
+		if err := c.Cursor.Err(); err != nil {
+			c.stop(errors.WithStack(err))
+			return false
+		}
+
+		c.watching = true
+		c.startedAt = time.Now()
+		c.lastChange = c.startedAt
+		grip.Info(message.Fields{
+			"message":   "watching for changes",
+			"migration": c.generator,
+			"cutover":   c.opts,
+		})
+	}
+
+	for !c.cutover(ctx) {
+		if !c.stream.TryNext(ctx) {
+			if err := c.stream.Err(); err != nil {
+				c.stop(errors.Wrap(err, "watching for changes"))
+				return false
+			}
+			continue
+		}
+
+		event := changeEvent{}
+		if err := c.stream.Decode(&event); err != nil {
+			c.stop(errors.Wrap(err, "decoding change event"))
+			return false
+		}
+
+		key, err := documentKey(event.DocumentKey)
+		if err != nil {
+			c.stop(errors.Wrap(err, "reading change event"))
+			return false
+		}
+		if _, ok := c.seen[key]; ok {
+			continue
+		}
+		c.seen[key] = struct{}{}
+
+		c.current = event.DocumentKey
+		c.changes++
+		c.lastChange = time.Now()
+		return true
+	}
+
+	c.stop(nil)
+	return false
+}
+
+// cutover reports whether the generator should stop watching for
+// changes.
+func (c *continuousCursor) cutover(ctx context.Context) bool {
+	if c.err != nil || ctx.Err() != nil {
+		return true
+	}
+
+	if c.opts.MaxDocuments > 0 && c.changes >= c.opts.MaxDocuments {
+		return true
+	}
+
+	if c.opts.DurationSeconds > 0 && time.Since(c.startedAt) >= time.Duration(c.opts.DurationSeconds)*time.Second {
+		return true
+	}
+
+	if c.opts.IdleSeconds > 0 && time.Since(c.lastChange) >= time.Duration(c.opts.IdleSeconds)*time.Second {
+		return true
+	}
+
+	if time.Since(c.lastCheck) < continuousStopInterval {
+		return false
+	}
+	c.lastCheck = time.Now()
+
+	stopped, err := stopRequested(ctx, c.env, c.generator)
+	if err != nil {
+		c.err = errors.WithStack(err)
+		return true
+	}
+
+	return stopped
+}
+
+// stop records the error that stopped the generator, if any. The
+// cursor returns no more documents once it stops.
+func (c *continuousCursor) stop(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+
+	grip.Info(message.Fields{
+		"message":   "stopped watching for changes",
+		"migration": c.generator,
+		"changes":   c.changes,
+		"error":     c.err,
+	})
+}
+
+func (c *continuousCursor) Current() []byte {
+	if c.watching {
+		return c.current
+	}
+
+	return c.Cursor.Current()
+}
+
+// Decode decodes the current document, and, for the documents of the
+// generator's cursor, records that the cursor returned the document,
+// so that changes to it from the stream are skipped.
+func (c *continuousCursor) Decode(in interface{}) error {
+	if c.watching {
+		return errors.Wrap(bson.Unmarshal(c.current, in), "decoding changed document key")
+	}
+
+	if err := c.Cursor.Decode(in); err != nil {
+		return errors.WithStack(err)
+	}
+
+	doc, err := bson.Marshal(in)
+	if err != nil {
+		return errors.Wrap(err, "encoding document")
+	}
+
+	key, err := documentKey(doc)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.seen[key] = struct{}{}
+
+	return nil
+}
+
+func (c *continuousCursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+
+	return c.Cursor.Err()
+}
+
+// jobsQueued forgets the documents that the cursor returned, once
+// the generator adds their jobs to the queue.
+func (c *continuousCursor) jobsQueued() { c.seen = map[string]struct{}{} }
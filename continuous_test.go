@@ -0,0 +1,213 @@
+package anser
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestContinuous(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key := func(t *testing.T, id string) *changeEvent {
+		out, err := bson.Marshal(bson.M{"_id": id})
+		require.NoError(t, err)
+		return &changeEvent{DocumentKey: out}
+	}
+
+	setup := func(t *testing.T) (*mock.Environment, *mock.Collection, *mock.Collection) {
+		source := &mock.Collection{}
+		meta := &mock.Collection{SingleResult: &mock.SingleResult{ErrorValue: mongo.ErrNoDocuments}}
+
+		env := mock.NewEnvironment()
+		env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+		env.Client = mock.NewClient()
+		env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{"migrations.metadata": meta}}
+		env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": source}}
+		return env, source, meta
+	}
+
+	t.Run("Filter", func(t *testing.T) {
+		filter, err := changeStreamFilter(map[string]interface{}{
+			"a":   1,
+			"$or": []interface{}{map[string]interface{}{"b": 2}, bson.M{"c.d": bson.M{"$exists": false}}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, bson.M{
+			"operationType":  bson.M{"$in": []string{"insert", "update", "replace"}},
+			"fullDocument.a": 1,
+			"$or": []interface{}{
+				bson.M{"fullDocument.b": 2},
+				bson.M{"fullDocument.c.d": bson.M{"$exists": false}},
+			},
+		}, filter)
+
+		_, err = changeStreamFilter(map[string]interface{}{"$where": "this.a == 1"})
+		assert.Error(t, err)
+		_, err = changeStreamFilter(map[string]interface{}{"$and": bson.M{"a": 1}})
+		assert.Error(t, err)
+	})
+	t.Run("Watch", func(t *testing.T) {
+		env, source, meta := setup(t)
+		opts := &model.ContinuousOptions{IdleSeconds: 60}
+
+		stream, err := watchGenerator(ctx, env, "migration", source, nil, nil, false)
+		assert.NoError(t, err)
+		assert.Nil(t, stream)
+		stream, err = watchGenerator(ctx, env, "migration", source, nil, opts, true)
+		assert.NoError(t, err)
+		assert.Nil(t, stream)
+		assert.Empty(t, source.WatchPipelines)
+
+		stream, err = watchGenerator(ctx, env, "migration", source, map[string]interface{}{"a": 1}, opts, false)
+		require.NoError(t, err)
+		assert.NotNil(t, stream)
+		require.Len(t, source.WatchPipelines, 1)
+		assert.Equal(t, 1, source.WatchPipelines[0].([]bson.M)[0]["$match"].(bson.M)["fullDocument.a"])
+		require.Len(t, source.WatchOptions, 1)
+		assert.Equal(t, options.UpdateLookup, *source.WatchOptions[0].FullDocument)
+		assert.Equal(t, []interface{}{bson.M{"_id": "migration.stop"}}, meta.Deletes)
+
+		source.WatchError = errors.New("not a replica set")
+		_, err = watchGenerator(ctx, env, "migration", source, nil, opts, false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not a replica set")
+	})
+	t.Run("Cursor", func(t *testing.T) {
+		env, _, _ := setup(t)
+		cursor := &mock.Cursor{ShouldIter: true, MaxNextCalls: 2, Results: []interface{}{&doc{"one"}}}
+		stream := &mock.ChangeStream{Events: []interface{}{key(t, "two"), key(t, "three"), key(t, "four")}}
+
+		assert.Equal(t, cursor, newContinuousCursor(env, "migration", cursor, nil, &model.ContinuousOptions{}))
+
+		wrapped := newContinuousCursor(env, "migration", cursor, stream, &model.ContinuousOptions{MaxDocuments: 2})
+		ids := []interface{}{}
+		for wrapped.Next(ctx) {
+			out := doc{}
+			require.NoError(t, wrapped.Decode(&out))
+			ids = append(ids, out.ID)
+		}
+		assert.NoError(t, wrapped.Err())
+		assert.Equal(t, []interface{}{"one", "two", "three"}, ids)
+		assert.False(t, stream.Closed)
+	})
+	t.Run("Duplicates", func(t *testing.T) {
+		env, _, _ := setup(t)
+		cursor := &mock.Cursor{ShouldIter: true, MaxNextCalls: 2, Results: []interface{}{&doc{"one"}}}
+
+		// "one" changes between opening the stream and finding the
+		// documents, and the operation on "two" changes "two" again,
+		// so both appear in the stream twice.
+		stream := &mock.ChangeStream{Events: []interface{}{key(t, "one"), key(t, "two"), key(t, "two"), key(t, "three")}}
+
+		wrapped := newContinuousCursor(env, "migration", cursor, stream, &model.ContinuousOptions{MaxDocuments: 2})
+		ids := []interface{}{}
+		for wrapped.Next(ctx) {
+			out := doc{}
+			require.NoError(t, wrapped.Decode(&out))
+			ids = append(ids, out.ID)
+		}
+		assert.NoError(t, wrapped.Err())
+		assert.Equal(t, []interface{}{"one", "two", "three"}, ids)
+	})
+	t.Run("RepeatedChanges", func(t *testing.T) {
+		env, _, _ := setup(t)
+		cursor := &mock.Cursor{ShouldIter: true, MaxNextCalls: 2, Results: []interface{}{&doc{"one"}}}
+		stream := &mock.ChangeStream{Events: []interface{}{key(t, "one"), key(t, "two"), key(t, "two"), key(t, "three")}}
+
+		// once the generator adds the job for a document to the
+		// queue, later changes to the document produce another
+		// job.
+		wrapped := newContinuousCursor(env, "migration", cursor, stream, &model.ContinuousOptions{MaxDocuments: 4}).(*continuousCursor)
+		ids := []interface{}{}
+		for wrapped.Next(ctx) {
+			out := doc{}
+			require.NoError(t, wrapped.Decode(&out))
+			ids = append(ids, out.ID)
+			wrapped.jobsQueued()
+		}
+		assert.NoError(t, wrapped.Err())
+		assert.Equal(t, []interface{}{"one", "one", "two", "two", "three"}, ids)
+		assert.Empty(t, wrapped.seen)
+	})
+	t.Run("Generator", func(t *testing.T) {
+		env, _, _ := setup(t)
+		qctx, qcancel := context.WithCancel(ctx)
+		defer qcancel()
+		env.Queue = queue.NewLocalLimitedSize(2, 128)
+		require.NoError(t, env.Queue.Start(qctx))
+		env.Network = mock.NewDependencyNetwork()
+
+		opts := &model.ContinuousOptions{MaxDocuments: 2}
+		generator := NewSimpleMigrationGenerator(env, model.GeneratorOptions{
+			JobID:      "migration",
+			NS:         model.Namespace{DB: "foo", Collection: "bar"},
+			Continuous: opts,
+		}, map[string]interface{}{"$set": map[string]interface{}{"a": 1}}).(*simpleMigrationGenerator)
+
+		cursor := &mock.Cursor{ShouldIter: true, MaxNextCalls: 2, Results: []interface{}{&doc{"one"}}}
+		stream := &mock.ChangeStream{Events: []interface{}{key(t, "two"), key(t, "two")}}
+		wrapped := newContinuousCursor(env, "migration", cursor, stream, opts).(*continuousCursor)
+
+		ids := generator.generateJobs(qctx, env, wrapped)
+		require.NoError(t, generator.Error())
+		assert.Empty(t, ids)
+		assert.Len(t, env.Network.Network()["migration"], 3)
+		assert.Equal(t, 3, env.Queue.Stats(qctx).Total)
+		assert.Empty(t, wrapped.seen)
+	})
+	t.Run("Stop", func(t *testing.T) {
+		env, _, meta := setup(t)
+		assert.Error(t, StopContinuousMigration(ctx, env, ""))
+		require.NoError(t, StopContinuousMigration(ctx, env, "migration"))
+		require.Len(t, meta.Updates, 1)
+		assert.Equal(t, "migration", meta.Updates[0].(bson.M)["$set"].(bson.M)["generator"])
+
+		meta.SingleResult.ErrorValue = nil
+		stream := &mock.ChangeStream{Events: []interface{}{key(t, "two")}}
+		wrapped := newContinuousCursor(env, "migration", &mock.Cursor{}, stream, &model.ContinuousOptions{})
+		assert.False(t, wrapped.Next(ctx))
+		assert.NoError(t, wrapped.Err())
+		assert.False(t, stream.Closed)
+	})
+	t.Run("StreamError", func(t *testing.T) {
+		env, _, _ := setup(t)
+		stream := &mock.ChangeStream{ErrError: errors.New("stream failed")}
+		wrapped := newContinuousCursor(env, "migration", &mock.Cursor{}, stream, &model.ContinuousOptions{})
+		assert.False(t, wrapped.Next(ctx))
+		require.Error(t, wrapped.Err())
+		assert.Contains(t, wrapped.Err().Error(), "stream failed")
+		assert.False(t, stream.Closed)
+	})
+	t.Run("Generation", func(t *testing.T) {
+		env, _, _ := setup(t)
+		env.Queue = queue.NewLocalLimitedSize(2, 128)
+		require.NoError(t, env.Queue.Start(ctx))
+
+		job := NewManualMigrationGenerator(env, model.GeneratorOptions{
+			JobID:      "manual",
+			NS:         model.Namespace{DB: "foo", Collection: "bar"},
+			Continuous: &model.ContinuousOptions{MaxDocuments: 1},
+		}, "op").(*manualMigrationGenerator)
+
+		cursor := &mock.Cursor{ShouldIter: true, MaxNextCalls: 2, Results: []interface{}{&doc{"one"}}}
+		stream := &mock.ChangeStream{Events: []interface{}{key(t, "two")}}
+		ids := job.generateJobs(ctx, env, newContinuousCursor(env, job.ID(), cursor, stream, job.Continuous))
+
+		// continuous generators add each job to the queue as soon as
+		// they produce it.
+		assert.Empty(t, ids)
+		assert.False(t, job.HasErrors())
+		assert.Equal(t, 2, env.Queue.Stats(ctx).Total)
+	})
+}
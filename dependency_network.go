@@ -3,12 +3,14 @@ package anser
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/evergreen-ci/tarjan"
 	"github.com/mongodb/anser/model"
 	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
 )
 
 func newDependencyNetwork() model.DependencyNetworker {
@@ -92,35 +94,142 @@ func (n *dependencyNetwork) getNetworkUnsafe() map[string][]string {
 }
 
 func (n *dependencyNetwork) Validate() error {
-	dependencies := make(map[string]struct{})
 	catcher := grip.NewCatcher()
 
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 
 	graph := n.getNetworkUnsafe()
-	for _, edges := range graph {
-		for _, id := range edges {
-			dependencies[id] = struct{}{}
-		}
+	nodes := make([]string, 0, len(graph))
+	for node := range graph {
+		nodes = append(nodes, node)
 	}
+	sort.Strings(nodes)
 
-	for id := range dependencies {
-		if _, ok := n.network[id]; !ok {
-			catcher.Errorf("dependency '%s' is not defined", id)
+	for _, node := range nodes {
+		edges := graph[node]
+		sort.Strings(edges)
+		for _, id := range edges {
+			if _, ok := n.network[id]; !ok {
+				catcher.Errorf("'%s' depends on '%s', which is not defined", node, id)
+			}
+			if id == node {
+				catcher.Errorf("'%s' depends on itself", node)
+			}
 		}
 	}
 
-	for _, group := range tarjan.Connections(graph) {
+	groups := tarjan.Connections(graph)
+	cycles := make([]string, 0, len(groups))
+	for _, group := range groups {
 		if len(group) > 1 {
-			catcher.Add(fmt.Errorf("cycle detected between nodes: [%s]",
-				strings.Join(group, ", ")))
+			cycles = append(cycles, strings.Join(cyclePath(graph, group), " -> "))
 		}
 	}
+	sort.Strings(cycles)
+	for _, cycle := range cycles {
+		catcher.Errorf("cycle detected: %s", cycle)
+	}
 
 	return catcher.Resolve()
 }
 
+// cyclePath returns the shortest path through the strongly connected
+// group of nodes from its first node (by name) back to itself.
+func cyclePath(graph map[string][]string, group []string) []string {
+	members := make(map[string]struct{}, len(group))
+	for _, node := range group {
+		members[node] = struct{}{}
+	}
+	sorted := append([]string{}, group...)
+	sort.Strings(sorted)
+	start := sorted[0]
+
+	prev := map[string]string{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		edges := append([]string{}, graph[node]...)
+		sort.Strings(edges)
+		for _, edge := range edges {
+			if _, ok := members[edge]; !ok {
+				continue
+			}
+			if edge == start {
+				path := []string{start}
+				for cur := node; cur != start; cur = prev[cur] {
+					path = append(path, cur)
+				}
+				for i, j := 1, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				return append(path, start)
+			}
+			if _, ok := prev[edge]; ok {
+				continue
+			}
+			prev[edge] = node
+			queue = append(queue, edge)
+		}
+	}
+
+	return sorted
+}
+
+// sortDependencies returns the nodes of the graph in dependency order,
+// such that every node appears after all of its dependencies. Edges to
+// nodes that are not defined in the graph are ignored, and if the
+// graph has cycles, sortDependencies returns an error. Nodes that are
+// not ordered relative to each other are sorted by name, so the order
+// is stable.
+func sortDependencies(graph map[string][]string) ([]string, error) {
+	remaining := make(map[string]int, len(graph))
+	dependents := make(map[string][]string, len(graph))
+	for node, edges := range graph {
+		remaining[node] += 0
+		for _, edge := range edges {
+			if _, ok := graph[edge]; !ok {
+				continue
+			}
+			remaining[node]++
+			dependents[edge] = append(dependents[edge], node)
+		}
+	}
+
+	ready := []string{}
+	for node, count := range remaining {
+		if count == 0 {
+			ready = append(ready, node)
+		}
+	}
+	sort.Strings(ready)
+
+	out := make([]string, 0, len(graph))
+	for len(ready) > 0 {
+		node := ready[0]
+		ready = ready[1:]
+		out = append(out, node)
+
+		next := []string{}
+		for _, dep := range dependents[node] {
+			remaining[dep]--
+			if remaining[dep] == 0 {
+				next = append(next, dep)
+			}
+		}
+		ready = append(ready, next...)
+		sort.Strings(ready)
+	}
+
+	if len(out) != len(graph) {
+		return nil, errors.New("cannot sort dependencies of a network with cycles")
+	}
+
+	return out, nil
+}
+
 func (n *dependencyNetwork) AddGroup(name string, group []string) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
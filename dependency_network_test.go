@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -204,3 +206,61 @@ func (s *DependencyNetworkSuite) TestErrorsForMissingDependency() {
 
 	s.Error(s.dep.Validate())
 }
+
+func (s *DependencyNetworkSuite) TestValidationErrorsNameNodesAndEdges() {
+	s.dep.Add("foo", []string{"bar", "missing"})
+	s.dep.Add("bar", []string{"baz"})
+	s.dep.Add("baz", []string{"foo"})
+	s.dep.Add("qux", []string{"qux"})
+
+	err := s.dep.Validate()
+	s.Require().Error(err)
+	s.Contains(err.Error(), "'foo' depends on 'missing', which is not defined")
+	s.Contains(err.Error(), "'qux' depends on itself")
+	s.Contains(err.Error(), "cycle detected: bar -> baz -> foo -> bar")
+}
+
+func TestCyclePath(t *testing.T) {
+	graph := map[string][]string{
+		"a": {"b", "d"},
+		"b": {"c"},
+		"c": {"a"},
+		"d": {"a"},
+	}
+	assert.Equal(t, []string{"a", "d", "a"}, cyclePath(graph, []string{"c", "b", "a", "d"}))
+	assert.Equal(t, []string{"a", "b", "c", "a"}, cyclePath(graph, []string{"c", "b", "a"}))
+}
+
+func TestSortDependencies(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		order, err := sortDependencies(map[string][]string{})
+		assert.NoError(t, err)
+		assert.Len(t, order, 0)
+	})
+	t.Run("DependenciesFirst", func(t *testing.T) {
+		order, err := sortDependencies(map[string][]string{
+			"foo": {"bar", "baz"},
+			"bar": {"baz"},
+			"baz": {},
+			"qux": {},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"baz", "bar", "foo", "qux"}, order)
+	})
+	t.Run("IgnoresUndefinedDependencies", func(t *testing.T) {
+		order, err := sortDependencies(map[string][]string{
+			"foo": {"bar", "missing"},
+			"bar": {},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bar", "foo"}, order)
+	})
+	t.Run("Cycle", func(t *testing.T) {
+		order, err := sortDependencies(map[string][]string{
+			"foo": {"bar"},
+			"bar": {"foo"},
+		})
+		assert.Error(t, err)
+		assert.Nil(t, order)
+	})
+}
@@ -0,0 +1,294 @@
+package anser
+
+import (
+	"bytes"
+	"context"
+	"os"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DryRunReport describes the changes that an application's migrations
+// would make, grouped by migration in the order that the generators
+// completed.
+type DryRunReport struct {
+	Migrations []DryRunMigration `bson:"migrations" json:"migrations" yaml:"migrations"`
+}
+
+// DryRunMigration describes the changes that a migration would make.
+// Dry runs evaluate simple migrations with read-only aggregations, and
+// report the documents that they would change in Changes and count
+// the documents that they would leave as they are in Unchanged.
+// Missing counts documents that were deleted after the generator
+// found them. Dry runs cannot evaluate the operations of manual and
+// stream migrations without running them, so those are only counted
+// in Skipped.
+type DryRunMigration struct {
+	Migration string           `bson:"migration" json:"migration" yaml:"migration"`
+	Namespace model.Namespace  `bson:"namespace" json:"namespace" yaml:"namespace"`
+	Changes   []DocumentChange `bson:"changes" json:"changes" yaml:"changes"`
+	Unchanged int              `bson:"unchanged" json:"unchanged" yaml:"unchanged"`
+	Missing   int              `bson:"missing" json:"missing" yaml:"missing"`
+	Skipped   int              `bson:"skipped" json:"skipped" yaml:"skipped"`
+}
+
+// DocumentChange holds a document before and after a migration, and
+// the top-level fields that the migration would change. If the
+// migration's update fails for the document, Error holds the error
+// and After is empty.
+type DocumentChange struct {
+	ID     interface{} `bson:"id" json:"id" yaml:"id"`
+	Fields []string    `bson:"fields,omitempty" json:"fields,omitempty" yaml:"fields,omitempty"`
+	Before bson.Raw    `bson:"before" json:"before" yaml:"before"`
+	After  bson.Raw    `bson:"after,omitempty" json:"after,omitempty" yaml:"after,omitempty"`
+	Error  string      `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// WriteFile writes the report to the file as indented, relaxed
+// extended JSON, so that the documents keep their BSON types.
+func (r *DryRunReport) WriteFile(fn string) error {
+	out, err := bson.MarshalExtJSONIndent(r, false, false, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshaling dry run report")
+	}
+
+	return errors.Wrapf(os.WriteFile(fn, append(out, '\n'), 0644), "writing dry run report to '%s'", fn)
+}
+
+// DryRunReport returns the report of the application's last dry run,
+// or nil if the application has not completed a dry run.
+func (a *Application) DryRunReport() *DryRunReport { return a.report }
+
+// runDryRun evaluates the operations that the generators in the queue
+// produced, and writes the report to the file in the DryRunReport
+// option, if it is set.
+func (a *Application) runDryRun(ctx context.Context, q amboy.Queue) error {
+	d := newDryRun(a.env)
+	num, err := d.collect(ctx, q, a.Options.Limit)
+	if err != nil {
+		return errors.Wrap(err, "evaluating generated migration jobs")
+	}
+	a.report = d.report
+
+	grip.Noticef("ending dry run, evaluated %d jobs in %d migrations", num, len(a.Generators))
+	if a.Options.DryRunReport == "" {
+		return nil
+	}
+
+	return errors.WithStack(d.report.WriteFile(a.Options.DryRunReport))
+}
+
+// dryRun evaluates the migration operations that the generators
+// produce during a dry run, without writing to the database.
+type dryRun struct {
+	env        Environment
+	report     *DryRunReport
+	migrations map[string]int
+}
+
+func newDryRun(env Environment) *dryRun {
+	return &dryRun{
+		env:        env,
+		report:     &DryRunReport{Migrations: []DryRunMigration{}},
+		migrations: map[string]int{},
+	}
+}
+
+// collect evaluates the migration operations of the generators in
+// the queue's results, up to the limit if it is greater than 0, and
+// returns the number of operations.
+func (d *dryRun) collect(ctx context.Context, q amboy.Queue, limit int) (int, error) {
+	count := 0
+	for job := range q.Results(ctx) {
+		generator, ok := job.(Generator)
+		if !ok {
+			continue
+		}
+		grip.Infof("evaluating operations for %s", generator.ID())
+
+		for j := range generator.Jobs() {
+			if limit > 0 && count >= limit {
+				return count, nil
+			}
+
+			if err := d.add(ctx, j); err != nil {
+				return count, errors.Wrapf(err, "evaluating '%s'", j.ID())
+			}
+			count++
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return count, errors.WithStack(err)
+	}
+
+	for _, m := range d.report.Migrations {
+		grip.Info(message.Fields{
+			"message":   "dry-run: migration summary",
+			"migration": m.Migration,
+			"ns":        m.Namespace,
+			"changed":   len(m.Changes),
+			"unchanged": m.Unchanged,
+			"missing":   m.Missing,
+			"skipped":   m.Skipped,
+		})
+	}
+
+	return count, nil
+}
+
+func (d *dryRun) migration(id string, ns model.Namespace) *DryRunMigration {
+	idx, ok := d.migrations[id]
+	if !ok {
+		idx = len(d.report.Migrations)
+		d.migrations[id] = idx
+		d.report.Migrations = append(d.report.Migrations, DryRunMigration{
+			Migration: id,
+			Namespace: ns,
+			Changes:   []DocumentChange{},
+		})
+	}
+
+	return &d.report.Migrations[idx]
+}
+
+// add evaluates a migration operation, and adds its changes to the
+// report.
+func (d *dryRun) add(ctx context.Context, j amboy.Job) error {
+	switch m := j.(type) {
+	case *simpleMigrationJob:
+		def := m.Definition
+		return d.simple(ctx, d.migration(def.Migration, def.Namespace), []interface{}{def.ID}, simpleUpdate(def.Update, def.Pipeline))
+	case *simpleBatchMigrationJob:
+		def := m.Definition
+		return d.simple(ctx, d.migration(def.Migration, def.Namespace), def.IDs, simpleUpdate(def.Update, def.Pipeline))
+	case *manualMigrationJob:
+		d.migration(m.Definition.Migration, m.Definition.Namespace).Skipped++
+	case *streamMigrationJob:
+		d.migration(m.Definition.Migration, m.Definition.Namespace).Skipped++
+	default:
+		grip.Infof("dry-run: would have added %s", j.ID())
+	}
+
+	return nil
+}
+
+// simple evaluates the update for each of the documents, and
+// compares the result to the original document. Updates that the dry
+// run cannot evaluate are reported as errors for each document.
+func (d *dryRun) simple(ctx context.Context, m *DryRunMigration, ids []interface{}, update interface{}) error {
+	cl, err := d.env.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "getting database client")
+	}
+	source := cl.Database(m.Namespace.DB).Collection(m.Namespace.Collection)
+	stages, stagesErr := updatePipeline(update)
+
+	for _, id := range ids {
+		query := bson.M{"_id": id}
+
+		res := source.FindOne(ctx, query)
+		if err = res.Err(); err == mongo.ErrNoDocuments {
+			m.Missing++
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "finding document '%v'", id)
+		}
+		before, err := res.Raw()
+		if err != nil {
+			return errors.Wrapf(err, "reading document '%v'", id)
+		}
+
+		if stagesErr != nil {
+			m.Changes = append(m.Changes, DocumentChange{ID: id, Before: before, Error: stagesErr.Error()})
+			continue
+		}
+
+		after, err := evaluateUpdate(ctx, source, query, stages)
+		if err != nil {
+			m.Changes = append(m.Changes, DocumentChange{ID: id, Before: before, Error: err.Error()})
+			continue
+		}
+		if after == nil {
+			m.Missing++
+			continue
+		}
+
+		if bytes.Equal(before, after) {
+			m.Unchanged++
+			continue
+		}
+
+		m.Changes = append(m.Changes, DocumentChange{
+			ID:     id,
+			Fields: changedFields(before, after),
+			Before: before,
+			After:  after,
+		})
+	}
+
+	return nil
+}
+
+// evaluateUpdate runs the stages of an update on the document that
+// matches the query in an aggregation, which does not change the
+// document, and returns the result, or nil if no document matches.
+func evaluateUpdate(ctx context.Context, coll client.Collection, query bson.M, stages []interface{}) (after bson.Raw, err error) {
+	pipeline := append([]interface{}{bson.M{"$match": query}}, stages...)
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() {
+		if cerr := cursor.Close(ctx); cerr != nil && err == nil {
+			err = errors.Wrap(cerr, "closing cursor")
+		}
+	}()
+
+	if !cursor.Next(ctx) {
+		return nil, errors.WithStack(cursor.Err())
+	}
+
+	after = bson.Raw{}
+	if err = cursor.Decode(&after); err != nil {
+		return nil, errors.Wrap(err, "reading updated document")
+	}
+
+	return after, nil
+}
+
+// changedFields returns the top-level fields that differ between the
+// documents, in the order that they appear in the documents.
+func changedFields(before, after bson.Raw) []string {
+	beforeElems, _ := before.Elements()
+	afterElems, _ := after.Elements()
+
+	afterValues := make(map[string]bson.RawValue, len(afterElems))
+	for _, elem := range afterElems {
+		afterValues[elem.Key()] = elem.Value()
+	}
+
+	out := []string{}
+	seen := make(map[string]bool, len(beforeElems))
+	for _, elem := range beforeElems {
+		seen[elem.Key()] = true
+		value, ok := afterValues[elem.Key()]
+		if !ok || !elem.Value().Equal(value) {
+			out = append(out, elem.Key())
+		}
+	}
+	for _, elem := range afterElems {
+		if !seen[elem.Key()] {
+			out = append(out, elem.Key())
+		}
+	}
+
+	return out
+}
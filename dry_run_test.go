@@ -0,0 +1,157 @@
+package anser
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	marshal := func(t *testing.T, doc bson.D) bson.Raw {
+		out, err := bson.Marshal(doc)
+		require.NoError(t, err)
+		return out
+	}
+	before := marshal(t, bson.D{{Key: "_id", Value: "one"}, {Key: "a", Value: 1}, {Key: "b", Value: "keep"}, {Key: "c", Value: true}})
+	after := marshal(t, bson.D{{Key: "_id", Value: "one"}, {Key: "a", Value: 2}, {Key: "b", Value: "keep"}, {Key: "d", Value: "new"}})
+
+	ns := model.Namespace{DB: "foo", Collection: "bar"}
+	update := map[string]interface{}{"$set": map[string]interface{}{"a": 2}}
+
+	setup := func(t *testing.T) (*mock.Environment, *mock.Collection) {
+		updated := bson.Raw(after)
+		source := &mock.Collection{
+			SingleResult:    &mock.SingleResult{DecodeBytesValue: before},
+			AggregateCursor: &mock.Cursor{ShouldIter: true, MaxNextCalls: 2, Results: []interface{}{&updated}},
+		}
+
+		env := mock.NewEnvironment()
+		env.Client = mock.NewClient()
+		env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": source}}
+		return env, source
+	}
+
+	t.Run("ChangedFields", func(t *testing.T) {
+		assert.Equal(t, []string{"a", "c", "d"}, changedFields(before, after))
+		assert.Empty(t, changedFields(before, before))
+	})
+	t.Run("Changed", func(t *testing.T) {
+		env, source := setup(t)
+		d := newDryRun(env)
+
+		require.NoError(t, d.add(ctx, NewSimpleMigration(env, model.Simple{ID: "one", Update: update, Migration: "first", Namespace: ns})))
+		assert.Empty(t, source.Updates)
+		require.Len(t, source.Pipelines, 1)
+		assert.Equal(t, []interface{}{
+			bson.M{"$match": bson.M{"_id": "one"}},
+			bson.M{"$set": bson.D{{Key: "a", Value: bson.M{"$literal": 2}}}},
+		}, source.Pipelines[0])
+
+		require.Len(t, d.report.Migrations, 1)
+		m := d.report.Migrations[0]
+		assert.Equal(t, "first", m.Migration)
+		assert.Equal(t, ns, m.Namespace)
+		require.Len(t, m.Changes, 1)
+		assert.Equal(t, "one", m.Changes[0].ID)
+		assert.Equal(t, []string{"a", "c", "d"}, m.Changes[0].Fields)
+		assert.Equal(t, before, m.Changes[0].Before)
+		assert.Equal(t, after, m.Changes[0].After)
+	})
+	t.Run("Pipeline", func(t *testing.T) {
+		env, source := setup(t)
+		d := newDryRun(env)
+
+		pipeline := []map[string]interface{}{{"$set": map[string]interface{}{"a": 2}}}
+		require.NoError(t, d.add(ctx, NewSimpleMigration(env, model.Simple{ID: "one", Pipeline: pipeline, Migration: "first", Namespace: ns})))
+		require.Len(t, source.Pipelines, 1)
+		assert.Equal(t, []interface{}{bson.M{"$match": bson.M{"_id": "one"}}, pipeline[0]}, source.Pipelines[0])
+		assert.Len(t, d.report.Migrations[0].Changes, 1)
+	})
+	t.Run("Unchanged", func(t *testing.T) {
+		env, source := setup(t)
+		unchanged := bson.Raw(before)
+		source.AggregateCursor.Results = []interface{}{&unchanged}
+		d := newDryRun(env)
+
+		require.NoError(t, d.add(ctx, NewSimpleMigration(env, model.Simple{ID: "one", Update: update, Migration: "first", Namespace: ns})))
+		require.Len(t, d.report.Migrations, 1)
+		assert.Empty(t, d.report.Migrations[0].Changes)
+		assert.Equal(t, 1, d.report.Migrations[0].Unchanged)
+	})
+	t.Run("Missing", func(t *testing.T) {
+		env, source := setup(t)
+		source.SingleResult.ErrorValue = mongo.ErrNoDocuments
+		d := newDryRun(env)
+
+		require.NoError(t, d.add(ctx, NewSimpleBatchMigration(env, model.SimpleBatch{IDs: []interface{}{"one", "two"}, Update: update, Migration: "first", Namespace: ns})))
+		assert.Equal(t, 2, d.report.Migrations[0].Missing)
+		assert.Empty(t, source.Pipelines)
+	})
+	t.Run("RemovedBeforeEvaluation", func(t *testing.T) {
+		env, source := setup(t)
+		source.AggregateCursor.MaxNextCalls = 0
+		d := newDryRun(env)
+
+		require.NoError(t, d.add(ctx, NewSimpleMigration(env, model.Simple{ID: "one", Update: update, Migration: "first", Namespace: ns})))
+		assert.Equal(t, 1, d.report.Migrations[0].Missing)
+		assert.Empty(t, d.report.Migrations[0].Changes)
+	})
+	t.Run("UpdateError", func(t *testing.T) {
+		env, source := setup(t)
+		source.AggregateError = errors.New("bad update")
+		d := newDryRun(env)
+
+		require.NoError(t, d.add(ctx, NewSimpleMigration(env, model.Simple{ID: "one", Update: update, Migration: "first", Namespace: ns})))
+		require.Len(t, d.report.Migrations[0].Changes, 1)
+		assert.Contains(t, d.report.Migrations[0].Changes[0].Error, "bad update")
+		assert.Equal(t, before, d.report.Migrations[0].Changes[0].Before)
+		assert.Nil(t, d.report.Migrations[0].Changes[0].After)
+	})
+	t.Run("UnsupportedUpdate", func(t *testing.T) {
+		env, source := setup(t)
+		d := newDryRun(env)
+
+		pull := map[string]interface{}{"$pull": map[string]interface{}{"a": 1}}
+		require.NoError(t, d.add(ctx, NewSimpleMigration(env, model.Simple{ID: "one", Update: pull, Migration: "first", Namespace: ns})))
+		assert.Empty(t, source.Pipelines)
+		require.Len(t, d.report.Migrations[0].Changes, 1)
+		assert.Contains(t, d.report.Migrations[0].Changes[0].Error, "$pull")
+	})
+	t.Run("Skipped", func(t *testing.T) {
+		env, _ := setup(t)
+		d := newDryRun(env)
+
+		require.NoError(t, d.add(ctx, NewManualMigration(env, model.Manual{ID: "one", Migration: "manual", Namespace: ns})))
+		require.NoError(t, d.add(ctx, NewStreamMigration(env, model.Stream{Migration: "stream", Namespace: ns})))
+		require.Len(t, d.report.Migrations, 2)
+		assert.Equal(t, 1, d.report.Migrations[0].Skipped)
+		assert.Equal(t, 1, d.report.Migrations[1].Skipped)
+	})
+	t.Run("WriteFile", func(t *testing.T) {
+		report := &DryRunReport{Migrations: []DryRunMigration{{
+			Migration: "first",
+			Namespace: ns,
+			Changes:   []DocumentChange{{ID: "one", Fields: []string{"a"}, Before: before, After: after}},
+		}}}
+
+		fn := filepath.Join(t.TempDir(), "report.json")
+		require.NoError(t, report.WriteFile(fn))
+
+		out, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		assert.Contains(t, string(out), `"migration": "first"`)
+		assert.Contains(t, string(out), `"d": "new"`)
+	})
+}
@@ -0,0 +1,197 @@
+package anser
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// updatePipeline returns the aggregation stages that compute the
+// result of a simple migration's update, so that dry runs can evaluate
+// updates without writing to the database. Update pipelines are used
+// as they are. Update documents are translated into stages for the
+// $set, $unset, $inc, $mul, $min, $max, $rename, $currentDate, $push,
+// and $addToSet operators. $setOnInsert has no effect because
+// migrations do not upsert. Other operators, positional paths, and
+// modifiers other than $each cannot be evaluated. Dotted paths are
+// evaluated as paths through embedded documents, not arrays.
+func updatePipeline(update interface{}) ([]interface{}, error) {
+	switch u := update.(type) {
+	case []map[string]interface{}:
+		out := make([]interface{}, 0, len(u))
+		for _, stage := range u {
+			out = append(out, stage)
+		}
+		return out, nil
+	case map[string]interface{}:
+		return updateOperatorStages(u)
+	default:
+		return nil, errors.Errorf("dry runs cannot evaluate updates of type %T", update)
+	}
+}
+
+// updateOperatorStages translates each operator of the update
+// document into a stage. As in the database, the fields of each
+// operator are applied in lexicographic order.
+func updateOperatorStages(update map[string]interface{}) ([]interface{}, error) {
+	out := []interface{}{}
+	for _, op := range sortedKeys(update) {
+		if !strings.HasPrefix(op, "$") {
+			return nil, errors.Errorf("update field '%s' is not an operator", op)
+		}
+		if op == "$setOnInsert" {
+			continue
+		}
+
+		fields, ok := updateDocument(update[op])
+		if !ok {
+			return nil, errors.Errorf("the value of '%s' must be a document", op)
+		}
+
+		set := bson.D{}
+		unset := []string{}
+		for _, path := range sortedKeys(fields) {
+			if strings.Contains(path, "$") {
+				return nil, errors.Errorf("dry runs cannot evaluate the positional path '%s'", path)
+			}
+
+			field := "$" + path
+			value := fields[path]
+			switch op {
+			case "$set":
+				set = append(set, bson.E{Key: path, Value: bson.M{"$literal": value}})
+			case "$unset":
+				unset = append(unset, path)
+			case "$inc":
+				set = append(set, bson.E{Key: path, Value: bson.M{"$add": []interface{}{bson.M{"$ifNull": []interface{}{field, 0}}, bson.M{"$literal": value}}}})
+			case "$mul":
+				set = append(set, bson.E{Key: path, Value: bson.M{"$multiply": []interface{}{bson.M{"$ifNull": []interface{}{field, 0}}, bson.M{"$literal": value}}}})
+			case "$min", "$max":
+				set = append(set, bson.E{Key: path, Value: bson.M{"$cond": []interface{}{
+					bson.M{"$eq": []interface{}{bson.M{"$type": field}, "missing"}},
+					bson.M{"$literal": value},
+					bson.M{op: []interface{}{field, bson.M{"$literal": value}}},
+				}}})
+			case "$rename":
+				target, ok := value.(string)
+				if !ok || target == "" || strings.Contains(target, "$") {
+					return nil, errors.Errorf("cannot rename '%s' to '%v'", path, value)
+				}
+				out = append(out, bson.M{"$set": bson.M{target: field}}, bson.M{"$unset": []string{path}})
+			case "$currentDate":
+				now, err := currentDateVariable(value)
+				if err != nil {
+					return nil, errors.Wrapf(err, "evaluating '$currentDate' for '%s'", path)
+				}
+				set = append(set, bson.E{Key: path, Value: now})
+			case "$push", "$addToSet":
+				values, err := arrayUpdateValues(op, value)
+				if err != nil {
+					return nil, errors.Wrapf(err, "evaluating '%s' for '%s'", op, path)
+				}
+				current := bson.M{"$ifNull": []interface{}{field, []interface{}{}}}
+				if op == "$push" {
+					set = append(set, bson.E{Key: path, Value: bson.M{"$concatArrays": []interface{}{current, bson.M{"$literal": values}}}})
+					continue
+				}
+				set = append(set, bson.E{Key: path, Value: bson.M{"$reduce": bson.M{
+					"input":        bson.M{"$literal": values},
+					"initialValue": current,
+					"in": bson.M{"$cond": []interface{}{
+						bson.M{"$in": []interface{}{"$$this", "$$value"}},
+						"$$value",
+						bson.M{"$concatArrays": []interface{}{"$$value", []interface{}{"$$this"}}},
+					}},
+				}}})
+			default:
+				return nil, errors.Errorf("dry runs cannot evaluate the update operator '%s'", op)
+			}
+		}
+
+		if len(set) > 0 {
+			out = append(out, bson.M{"$set": set})
+		}
+		if len(unset) > 0 {
+			out = append(out, bson.M{"$unset": unset})
+		}
+	}
+
+	return out, nil
+}
+
+// currentDateVariable returns the aggregation variable that holds the
+// value that $currentDate would set.
+func currentDateVariable(value interface{}) (string, error) {
+	if value == true {
+		return "$$NOW", nil
+	}
+
+	spec, ok := updateDocument(value)
+	if !ok {
+		return "", errors.Errorf("invalid value '%v'", value)
+	}
+
+	switch spec["$type"] {
+	case "date":
+		return "$$NOW", nil
+	case "timestamp":
+		return "$$CLUSTER_TIME", nil
+	default:
+		return "", errors.Errorf("invalid type '%v'", spec["$type"])
+	}
+}
+
+// arrayUpdateValues returns the values that $push or $addToSet adds,
+// which is either the value itself or the values in its $each
+// modifier.
+func arrayUpdateValues(op string, value interface{}) ([]interface{}, error) {
+	spec, ok := updateDocument(value)
+	if !ok {
+		return []interface{}{value}, nil
+	}
+	if _, ok = spec["$each"]; !ok {
+		return []interface{}{value}, nil
+	}
+
+	for key := range spec {
+		if key != "$each" {
+			return nil, errors.Errorf("dry runs cannot evaluate the modifier '%s'", key)
+		}
+	}
+
+	values, ok := spec["$each"].([]interface{})
+	if !ok {
+		if arr, isArr := spec["$each"].(bson.A); isArr {
+			return arr, nil
+		}
+		return nil, errors.New("the value of '$each' must be an array")
+	}
+
+	return values, nil
+}
+
+// updateDocument returns the value as a map, if it is a document.
+func updateDocument(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case bson.M:
+		return v, true
+	case bson.D:
+		return v.Map(), true
+	default:
+		return nil, false
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	out := make([]string, 0, len(m))
+	for key := range m {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+
+	return out
+}
@@ -0,0 +1,68 @@
+package anser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUpdatePipeline(t *testing.T) {
+	t.Run("Pipeline", func(t *testing.T) {
+		pipeline := []map[string]interface{}{{"$set": map[string]interface{}{"a": 1}}, {"$unset": "b"}}
+		stages, err := updatePipeline(pipeline)
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{pipeline[0], pipeline[1]}, stages)
+	})
+	t.Run("Operators", func(t *testing.T) {
+		stages, err := updatePipeline(map[string]interface{}{
+			"$set":         map[string]interface{}{"b": "$literal", "a.x": 1},
+			"$unset":       bson.M{"c": ""},
+			"$inc":         map[string]interface{}{"n": 2},
+			"$rename":      map[string]interface{}{"old": "new"},
+			"$currentDate": map[string]interface{}{"at": true, "ts": map[string]interface{}{"$type": "timestamp"}},
+			"$setOnInsert": map[string]interface{}{"created": true},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{
+			bson.M{"$set": bson.D{{Key: "at", Value: "$$NOW"}, {Key: "ts", Value: "$$CLUSTER_TIME"}}},
+			bson.M{"$set": bson.D{{Key: "n", Value: bson.M{"$add": []interface{}{bson.M{"$ifNull": []interface{}{"$n", 0}}, bson.M{"$literal": 2}}}}}},
+			bson.M{"$set": bson.M{"new": "$old"}},
+			bson.M{"$unset": []string{"old"}},
+			bson.M{"$set": bson.D{{Key: "a.x", Value: bson.M{"$literal": 1}}, {Key: "b", Value: bson.M{"$literal": "$literal"}}}},
+			bson.M{"$unset": []string{"c"}},
+		}, stages)
+	})
+	t.Run("Arrays", func(t *testing.T) {
+		stages, err := updatePipeline(map[string]interface{}{
+			"$push": map[string]interface{}{"a": map[string]interface{}{"$each": []interface{}{1, 2}}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{
+			bson.M{"$set": bson.D{{Key: "a", Value: bson.M{"$concatArrays": []interface{}{
+				bson.M{"$ifNull": []interface{}{"$a", []interface{}{}}},
+				bson.M{"$literal": []interface{}{1, 2}},
+			}}}}},
+		}, stages)
+
+		stages, err = updatePipeline(map[string]interface{}{"$addToSet": map[string]interface{}{"a": 1}})
+		require.NoError(t, err)
+		require.Len(t, stages, 1)
+	})
+	t.Run("Unsupported", func(t *testing.T) {
+		for name, update := range map[string]interface{}{
+			"Operator":    map[string]interface{}{"$pull": map[string]interface{}{"a": 1}},
+			"Positional":  map[string]interface{}{"$set": map[string]interface{}{"a.$": 1}},
+			"Modifier":    map[string]interface{}{"$push": map[string]interface{}{"a": map[string]interface{}{"$each": []interface{}{1}, "$slice": 1}}},
+			"Replacement": map[string]interface{}{"a": 1},
+			"Rename":      map[string]interface{}{"$rename": map[string]interface{}{"a": 1}},
+			"Type":        bson.D{{Key: "$set", Value: bson.M{"a": 1}}},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := updatePipeline(update)
+				assert.Error(t, err)
+			})
+		}
+	})
+}
@@ -14,6 +14,7 @@ package anser
 import (
 	"sync"
 
+	"github.com/evergreen-ci/birch"
 	"github.com/mongodb/amboy"
 	"github.com/mongodb/amboy/dependency"
 	"github.com/mongodb/anser/client"
@@ -57,6 +58,70 @@ type Environment interface {
 	Close() error
 }
 
+// ParameterizedMigrationEnvironment is implemented by environments
+// that register manual migration operations that take parameters.
+// Environments that do not implement it run their manual migration
+// operations without parameters.
+type ParameterizedMigrationEnvironment interface {
+	RegisterParameterizedMigrationOperation(string, client.ParameterizedMigrationOperation) error
+	GetParameterizedMigrationOperation(string) (client.ParameterizedMigrationOperation, bool)
+}
+
+// getParameterizedMigrationOperation returns the named operation
+// from the environment, which ignores the parameters if the
+// environment does not support them.
+func getParameterizedMigrationOperation(env Environment, name string) (client.ParameterizedMigrationOperation, bool) {
+	if penv, ok := env.(ParameterizedMigrationEnvironment); ok {
+		return penv.GetParameterizedMigrationOperation(name)
+	}
+
+	op, ok := env.GetManualMigrationOperation(name)
+	if !ok || op == nil {
+		return nil, false
+	}
+
+	return func(cl client.Client, doc *birch.Document, _ map[string]string) error { return op(cl, doc) }, true
+}
+
+// VerificationEnvironment is implemented by environments that
+// register named verifications.
+type VerificationEnvironment interface {
+	RegisterVerification(string, client.Verification) error
+	GetVerification(string) (client.Verification, bool)
+}
+
+// getVerification returns the named verification, if the environment
+// registers verifications.
+func getVerification(env Environment, name string) (client.Verification, bool) {
+	if venv, ok := env.(VerificationEnvironment); ok {
+		return venv.GetVerification(name)
+	}
+
+	return nil, false
+}
+
+// LoadSourceEnvironment is implemented by environments that provide
+// the source of the cluster load for backpressure. Environments that
+// do not implement it read the server status of their client.
+type LoadSourceEnvironment interface {
+	SetLoadSource(client.LoadSource)
+	GetLoadSource() (client.LoadSource, error)
+}
+
+// getLoadSource returns the environment's load source.
+func getLoadSource(env Environment) (client.LoadSource, error) {
+	if lenv, ok := env.(LoadSourceEnvironment); ok {
+		return lenv.GetLoadSource()
+	}
+
+	cl, err := env.GetClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting database client")
+	}
+
+	return client.NewServerStatusLoadSource(cl), nil
+}
+
 // GetEnvironment returns the global environment object. Because this
 // produces a pointer to the global object, make sure that you have a
 // way to replace it with a mock as needed for testing.
@@ -69,11 +134,13 @@ func ResetEnvironment() {
 	globalEnv = &envState{
 		migrations: make(map[string]migrationOp),
 		processor:  make(map[string]processor),
+		verify:     make(map[string]client.Verification),
 	}
 }
 
 type migrationOp struct {
-	current client.MigrationOperation
+	current    client.MigrationOperation
+	withParams client.ParameterizedMigrationOperation
 }
 
 type processor struct {
@@ -88,6 +155,8 @@ type envState struct {
 	deps       model.DependencyNetworker
 	migrations map[string]migrationOp
 	processor  map[string]processor
+	verify     map[string]client.Verification
+	load       client.LoadSource
 	closers    []func() error
 	isSetup    bool
 	mu         sync.RWMutex
@@ -176,14 +245,46 @@ func (e *envState) RegisterManualMigrationOperation(name string, op client.Migra
 	return nil
 }
 
+// GetManualMigrationOperation returns the named operation. Operations
+// registered with params are called without params.
 func (e *envState) GetManualMigrationOperation(name string) (client.MigrationOperation, bool) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
 	op, ok := e.migrations[name]
+	if ok && op.current == nil {
+		return func(cl client.Client, doc *birch.Document) error { return op.withParams(cl, doc, nil) }, true
+	}
+
 	return op.current, ok
 }
 
+func (e *envState) RegisterParameterizedMigrationOperation(name string, op client.ParameterizedMigrationOperation) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.migrations[name]; ok {
+		return errors.Errorf("migration operation '%s' already exists", name)
+	}
+
+	e.migrations[name] = migrationOp{withParams: op}
+	return nil
+}
+
+// GetParameterizedMigrationOperation returns the named operation.
+// Operations registered without params ignore the params.
+func (e *envState) GetParameterizedMigrationOperation(name string) (client.ParameterizedMigrationOperation, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	op, ok := e.migrations[name]
+	if ok && op.withParams == nil {
+		return func(cl client.Client, doc *birch.Document, _ map[string]string) error { return op.current(cl, doc) }, true
+	}
+
+	return op.withParams, ok
+}
+
 func (e *envState) RegisterDocumentProcessor(name string, docp client.Processor) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -204,6 +305,53 @@ func (e *envState) GetDocumentProcessor(name string) (client.Processor, bool) {
 	return docp.current, ok
 }
 
+func (e *envState) RegisterVerification(name string, fn client.Verification) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.verify[name]; ok {
+		return errors.Errorf("verification '%s' already registered", name)
+	}
+
+	e.verify[name] = fn
+	return nil
+}
+
+func (e *envState) GetVerification(name string) (client.Verification, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	fn, ok := e.verify[name]
+	return fn, ok
+}
+
+// SetLoadSource sets the source of the cluster load that migrations
+// with backpressure options use to decide when to pause.
+func (e *envState) SetLoadSource(src client.LoadSource) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.load = src
+}
+
+// GetLoadSource returns the load source set with SetLoadSource or, if
+// there is none, a source that reads the server status of the
+// environment's client.
+func (e *envState) GetLoadSource() (client.LoadSource, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.load != nil {
+		return e.load, nil
+	}
+
+	if e.client == nil {
+		return nil, errors.New("no client defined")
+	}
+
+	return client.NewServerStatusLoadSource(e.client), nil
+}
+
 func (e *envState) MetadataNamespace() model.Namespace {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
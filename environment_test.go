@@ -6,12 +6,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/evergreen-ci/birch"
 	"github.com/mongodb/amboy"
 	"github.com/mongodb/amboy/queue"
 	"github.com/mongodb/anser/client"
 	"github.com/mongodb/anser/db"
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
 	"github.com/mongodb/grip"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -161,3 +165,74 @@ func TestUninitializedEnvErrors(t *testing.T) {
 	assert.Nil(net)
 	assert.Error(err)
 }
+
+func TestMigrationOperationRegistry(t *testing.T) {
+	t.Parallel()
+	env := &envState{migrations: make(map[string]migrationOp)}
+	cl := mock.NewClient()
+	doc := birch.NewDocument()
+
+	var received map[string]string
+	require.NoError(t, env.RegisterParameterizedMigrationOperation("params", func(_ client.Client, _ *birch.Document, params map[string]string) error {
+		received = params
+		return nil
+	}))
+	require.NoError(t, env.RegisterManualMigrationOperation("plain", func(client.Client, *birch.Document) error { return errors.New("plain") }))
+	assert.Error(t, env.RegisterParameterizedMigrationOperation("plain", nil))
+	assert.Error(t, env.RegisterManualMigrationOperation("params", nil))
+
+	op, ok := env.GetParameterizedMigrationOperation("params")
+	require.True(t, ok)
+	require.NoError(t, op(cl, doc, map[string]string{"field": "a"}))
+	assert.Equal(t, map[string]string{"field": "a"}, received)
+
+	plain, ok := env.GetManualMigrationOperation("params")
+	require.True(t, ok)
+	require.NoError(t, plain(cl, doc))
+	assert.Nil(t, received)
+
+	op, ok = env.GetParameterizedMigrationOperation("plain")
+	require.True(t, ok)
+	assert.EqualError(t, op(cl, doc, map[string]string{"field": "a"}), "plain")
+
+	_, ok = env.GetParameterizedMigrationOperation("missing")
+	assert.False(t, ok)
+}
+
+// plainEnvironment only implements the methods of the Environment
+// interface.
+type plainEnvironment struct{ Environment }
+
+func TestOptionalEnvironmentInterfaces(t *testing.T) {
+	env := mock.NewEnvironment()
+	env.Client = mock.NewClient()
+	require.NoError(t, env.RegisterManualMigrationOperation("plain", func(client.Client, *birch.Document) error { return errors.New("plain") }))
+	require.NoError(t, env.RegisterVerification("check", func(context.Context, client.Client, model.Namespace, []interface{}) error { return nil }))
+	plain := plainEnvironment{env}
+
+	t.Run("ParameterizedMigrationOperation", func(t *testing.T) {
+		op, ok := getParameterizedMigrationOperation(plain, "plain")
+		require.True(t, ok)
+		assert.EqualError(t, op(env.Client, birch.NewDocument(), map[string]string{"field": "a"}), "plain")
+
+		_, ok = getParameterizedMigrationOperation(plain, "missing")
+		assert.False(t, ok)
+	})
+	t.Run("Verification", func(t *testing.T) {
+		_, ok := getVerification(env, "check")
+		assert.True(t, ok)
+		_, ok = getVerification(plain, "check")
+		assert.False(t, ok)
+	})
+	t.Run("LoadSource", func(t *testing.T) {
+		src := &mock.LoadSource{}
+		env.SetLoadSource(src)
+		out, err := getLoadSource(env)
+		require.NoError(t, err)
+		assert.Equal(t, src, out)
+
+		out, err = getLoadSource(plain)
+		require.NoError(t, err)
+		assert.NotEqual(t, src, out)
+	})
+}
@@ -4,10 +4,15 @@ Generator
 Generators create migration operations and are the first step
 in an anser Migration. They are supersets of amboy.Job interfaces.
 
-The current limitation is that the generated jobs must be stored
-within the implementation of the generator job, which means they must
-either all fit in memory *or* be serializable independently (e.g. fit
-in the 16mb document limit if using a MongoDB backed queue.)
+By default, the generated jobs are stored within the implementation
+of the generator job until the application collects them, which means
+they must either all fit in memory *or* be serializable independently
+(e.g. fit in the 16mb document limit if using a MongoDB backed queue.)
+
+Generators with a BatchSize or CheckpointInterval in their
+GeneratorOptions avoid this limitation: they add their jobs to the
+queue in batches while they iterate over the source documents, and
+only hold one batch of jobs at a time.
 */
 package anser
 
@@ -36,6 +41,35 @@ type Generator interface {
 	amboy.Job
 }
 
+// rollbackGenerator is implemented by generators that can produce
+// migrations that reverse the migrations they generated. The events
+// are the metadata for the completed migration operations that
+// should be rolled back.
+type rollbackGenerator interface {
+	rollbackMigrations(Environment, []*model.MigrationMetadata) []Migration
+}
+
+// sourceGenerator is implemented by generators that produce a
+// migration operation for each document in a namespace that matches
+// a query.
+type sourceGenerator interface {
+	source() (model.Namespace, map[string]interface{})
+}
+
+// applicationGenerator is implemented by generators whose behavior
+// depends on the options of the application that runs them, for
+// example because they add jobs to the queue while they run.
+type applicationGenerator interface {
+	setApplicationOptions(model.ApplicationOptions)
+}
+
+// verifyGenerator is implemented by generators that can verify the
+// documents that their migrations modified. The verification is nil
+// if the generator does not verify its migrations.
+type verifyGenerator interface {
+	verification() *model.Verification
+}
+
 // generatorDependency produces a configured dependency.Manager from
 // the specified Generator options.
 func generatorDependency(env Environment, o model.GeneratorOptions) dependency.Manager {
@@ -49,8 +83,9 @@ func generatorDependency(env Environment, o model.GeneratorOptions) dependency.M
 }
 
 // addMigrationJobs takes an amboy.Queue, processes the results, and
-// adds any jobs produced by the generator to the queue.
-func addMigrationJobs(ctx context.Context, q amboy.Queue, dryRun bool, limit int) (int, error) {
+// adds any jobs produced by the generator to the queue, followed by
+// the verification of each generator's migrations.
+func addMigrationJobs(ctx context.Context, env Environment, q amboy.Queue, limit int) (int, error) {
 	catcher := grip.NewCatcher()
 	count := 0
 	for job := range q.Results(ctx) {
@@ -60,24 +95,61 @@ func addMigrationJobs(ctx context.Context, q amboy.Queue, dryRun bool, limit int
 		}
 		grip.Infof("adding operations for %s", generator.ID())
 
+		skipped := map[string]bool{}
 		for j := range generator.Jobs() {
-			if dryRun {
-				grip.Infof("dry-run: would have added %s", j.ID())
-				continue
-			}
-
 			if limit > 0 && count >= limit {
-				return count, catcher.Resolve()
+				skipped[j.ID()] = true
+				continue
 			}
 			catcher.Add(q.Put(ctx, j))
 			count++
 		}
+
+		catcher.Add(addVerification(ctx, env, q, generator, skipped))
 	}
 
 	grip.Infof("added %d migration operations", count)
 	return count, catcher.Resolve()
 }
 
+// addVerification adds the job that verifies the generator's
+// migrations to the queue, if the generator has a verification. The
+// verification depends on all of the generator's migration
+// operations, except for the skipped operations that were not added
+// to the queue, in which case the verification is partial.
+func addVerification(ctx context.Context, env Environment, q amboy.Queue, gen Generator, skipped map[string]bool) error {
+	vg, ok := gen.(verifyGenerator)
+	if !ok {
+		return nil
+	}
+
+	def := vg.verification()
+	if def == nil {
+		return nil
+	}
+
+	network, err := env.GetDependencyNetwork()
+	if err != nil {
+		return errors.Wrap(err, "getting dependency network")
+	}
+
+	if len(skipped) > 0 {
+		def.Partial = true
+	}
+
+	j := NewVerifyMigration(env, *def)
+	dep := env.NewDependencyManager(gen.ID())
+	for _, edge := range network.GetGroup(gen.ID()) {
+		if edge == j.ID() || skipped[edge] {
+			continue
+		}
+		grip.Warning(dep.AddEdge(edge))
+	}
+	j.SetDependency(dep)
+
+	return errors.Wrapf(q.Put(ctx, j), "adding verification of migration '%s'", gen.ID())
+}
+
 // generator provides the high level implementation of the Jobs()
 // method that's a part of the Generator interface. This
 // takes a list of jobs (using a variadic function to do the type
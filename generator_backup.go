@@ -0,0 +1,240 @@
+package anser
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mongodb/anser/backup"
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// generatorBackupTimeFormat is the format of the time of the run in
+// the names of the directories of generators' backups.
+const generatorBackupTimeFormat = "20060102T150405.000000000Z"
+
+// generatorBackupDir returns the directory that holds the backup that
+// the generator takes on the run that started at the time. Each run
+// writes to its own directory, so that a later run never replaces the
+// backup of an earlier run, whose documents may not have been
+// migrated yet.
+func generatorBackupDir(opts *model.BackupOptions, migration string, startedAt time.Time) string {
+	return filepath.Join(opts.Path, migration, startedAt.UTC().Format(generatorBackupTimeFormat))
+}
+
+// generatorDocuments describes the documents that a generator
+// migrates, and the backup that the generator takes of them, if any.
+type generatorDocuments struct {
+	migration  string
+	ns         model.Namespace
+	query      map[string]interface{}
+	limit      int
+	checkpoint *model.GeneratorCheckpoint
+	canary     *model.Canary
+	backup     *model.BackupOptions
+}
+
+// findGeneratorDocuments returns the cursor of the documents that the
+// generator migrates, after it backs them up, if the generator takes
+// a backup, along with the path of the backup's manifest.
+func findGeneratorDocuments(ctx context.Context, env Environment, coll client.Collection, docs generatorDocuments) (client.Cursor, string, error) {
+	if docs.backup == nil {
+		cursor, err := generatorCursor(ctx, coll, docs.query, docs.limit, docs.checkpoint, docs.canary)
+		return cursor, "", errors.WithStack(err)
+	}
+
+	return backupGeneratorDocuments(ctx, env, coll, docs)
+}
+
+// backupGeneratorDocuments backs up the documents that the generator
+// migrates, and returns the cursor of the documents in the backup and
+// the path of the backup's manifest, so that the generator migrates
+// exactly the documents that it backed up. The backup finds the
+// documents with the same query, order, and limit as generatorFind,
+// except for canaries, whose samples cannot be found again, so the
+// backup reads the sample first and then backs up the sampled
+// documents. Generators that resume from a checkpoint have already
+// migrated some of their documents, so they keep the backup from their
+// first run, and skip the documents in it that the checkpoint covers.
+func backupGeneratorDocuments(ctx context.Context, env Environment, coll client.Collection, docs generatorDocuments) (client.Cursor, string, error) {
+	if docs.checkpoint != nil && docs.checkpoint.Count > 0 {
+		if docs.checkpoint.Backup == "" {
+			cursor, err := generatorCursor(ctx, coll, docs.query, docs.limit, docs.checkpoint, docs.canary)
+			return cursor, "", errors.WithStack(err)
+		}
+
+		cursor, err := openBackupCursor(ctx, docs.checkpoint.Backup, docs.ns, docs.checkpoint.Count)
+		return cursor, docs.checkpoint.Backup, errors.WithStack(err)
+	}
+
+	cl, err := env.GetClient()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "getting database client")
+	}
+
+	mcl, ok := client.UnwrapClient(cl)
+	if !ok {
+		return nil, "", errors.Errorf("cannot back up documents of migration '%s' without a MongoDB client", docs.migration)
+	}
+
+	dir := generatorBackupDir(docs.backup, docs.migration, time.Now())
+	manifest := filepath.Join(dir, backup.ManifestFileName)
+	if _, err = os.Stat(manifest); err == nil {
+		return nil, "", errors.Errorf("backup '%s' of migration '%s' already exists", manifest, docs.migration)
+	}
+
+	bopts := backup.CollectionsOptions{
+		Namespaces: []model.Namespace{docs.ns},
+		Target:     backup.DirectoryTarget(dir),
+		Workers:    1,
+		Compress:   docs.backup.Compress,
+	}
+
+	if docs.canary != nil {
+		sample, err := generatorCursor(ctx, coll, docs.query, docs.limit, docs.checkpoint, docs.canary)
+		if err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+
+		ids, err := cursorIDs(ctx, sample)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "reading canary of migration '%s'", docs.migration)
+		}
+
+		bopts.Query = bson.M{"_id": bson.M{"$in": ids}}
+	} else {
+		query, opts := generatorFind(docs.query, docs.limit, docs.checkpoint)
+		if len(query) > 0 {
+			bopts.Query = bson.M(query)
+		}
+		bopts.Sort = opts.Sort
+		if opts.Limit != nil {
+			bopts.Limit = *opts.Limit
+		}
+	}
+
+	res, err := backup.Collections(ctx, mcl, bopts)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "backing up documents of migration '%s'", docs.migration)
+	}
+
+	grip.Info(message.Fields{
+		"message":   "backed up documents before migration",
+		"migration": docs.migration,
+		"ns":        docs.ns,
+		"manifest":  manifest,
+		"documents": res.Collections[0].Documents,
+	})
+
+	if docs.checkpoint != nil {
+		docs.checkpoint.Backup = manifest
+	}
+
+	cursor, err := openBackupCursor(ctx, manifest, docs.ns, 0)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	return cursor, manifest, nil
+}
+
+// cursorIDs reads the _id values of all of the documents of the
+// cursor, and closes it.
+func cursorIDs(ctx context.Context, cursor client.Cursor) ([]interface{}, error) {
+	doc := struct {
+		ID interface{} `bson:"_id"`
+	}{}
+
+	catcher := grip.NewBasicCatcher()
+	ids := []interface{}{}
+	for cursor.Next(ctx) {
+		if err := cursor.Decode(&doc); err != nil {
+			catcher.Wrap(err, "decoding document")
+			break
+		}
+		ids = append(ids, doc.ID)
+	}
+	catcher.Add(cursor.Err())
+	catcher.Add(cursor.Close(ctx))
+
+	return ids, catcher.Resolve()
+}
+
+// openBackupCursor opens the documents of the namespace in the backup
+// with the manifest, after the first skip documents.
+func openBackupCursor(ctx context.Context, manifest string, ns model.Namespace, skip int) (client.Cursor, error) {
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading backup manifest '%s'", manifest)
+	}
+
+	m := &backup.Manifest{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, errors.Wrapf(err, "parsing backup manifest '%s'", manifest)
+	}
+
+	entry := m.Entry(ns)
+	if entry == nil {
+		return nil, errors.Errorf("backup '%s' does not include '%s'", manifest, ns)
+	}
+
+	docs, err := backup.OpenDocuments(ctx, backup.DirectorySource(filepath.Dir(manifest)), ns, entry.Compressed)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	cursor := &backupCursor{docs: docs}
+	for i := 0; i < skip; i++ {
+		if !cursor.Next(ctx) {
+			break
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		catcher := grip.NewBasicCatcher()
+		catcher.Wrapf(err, "skipping the first %d documents of backup '%s'", skip, manifest)
+		catcher.Add(cursor.Close(ctx))
+		return nil, catcher.Resolve()
+	}
+
+	return cursor, nil
+}
+
+// backupCursor iterates the documents of a backup.
+type backupCursor struct {
+	docs    *backup.Documents
+	current bson.Raw
+	err     error
+}
+
+func (c *backupCursor) Next(ctx context.Context) bool {
+	if c.err != nil {
+		return false
+	}
+
+	doc, err := c.docs.Next()
+	if err == io.EOF {
+		return false
+	}
+	if err != nil {
+		c.err = errors.WithStack(err)
+		return false
+	}
+
+	c.current = doc
+	return true
+}
+
+func (c *backupCursor) Current() []byte                               { return c.current }
+func (c *backupCursor) Decode(in interface{}) error                   { return bson.Unmarshal(c.current, in) }
+func (c *backupCursor) Err() error                                    { return c.err }
+func (c *backupCursor) ID() int64                                     { return 0 }
+func (c *backupCursor) Close(context.Context) error                   { return c.docs.Close() }
+func (c *backupCursor) All(ctx context.Context, in interface{}) error { return decodeAll(ctx, c, in) }
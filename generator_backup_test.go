@@ -0,0 +1,116 @@
+package anser
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/anser/backup"
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestBackupGeneratorDocuments(t *testing.T) {
+	ctx := context.Background()
+	ns := model.Namespace{DB: "foo", Collection: "bar"}
+	opts := &model.BackupOptions{Path: filepath.Join("backups", "prod")}
+
+	startedAt := time.Date(2024, 5, 1, 12, 30, 0, 5, time.UTC)
+	assert.Equal(t, filepath.Join("backups", "prod", "migration", "20240501T123000.000000005Z"), generatorBackupDir(opts, "migration", startedAt))
+	assert.NotEqual(t, generatorBackupDir(opts, "migration", startedAt), generatorBackupDir(opts, "migration", startedAt.Add(time.Nanosecond)))
+
+	env := mock.NewEnvironment()
+	env.Client = mock.NewClient()
+	coll := &mock.Collection{FindCursor: &mock.Cursor{}}
+
+	t.Run("WithoutBackup", func(t *testing.T) {
+		cursor, manifest, err := findGeneratorDocuments(ctx, env, coll, generatorDocuments{migration: "migration", ns: ns})
+		require.NoError(t, err)
+		assert.Equal(t, coll.FindCursor, cursor)
+		assert.Empty(t, manifest)
+	})
+	t.Run("Resumed", func(t *testing.T) {
+		manifest := writeBackup(t, ns, "one", "two", "three")
+		cp := &model.GeneratorCheckpoint{Count: 1, Backup: manifest}
+		cursor, out, err := findGeneratorDocuments(ctx, env, coll, generatorDocuments{migration: "migration", ns: ns, checkpoint: cp, backup: opts})
+		require.NoError(t, err)
+		assert.Equal(t, manifest, out)
+
+		// the generator migrates the documents in the backup that
+		// the checkpoint does not cover.
+		rest := []bson.M{}
+		require.NoError(t, cursor.All(ctx, &rest))
+		assert.Equal(t, []bson.M{{"_id": "two"}, {"_id": "three"}}, rest)
+		assert.NoError(t, cursor.Close(ctx))
+	})
+	t.Run("ResumedWithoutBackup", func(t *testing.T) {
+		cp := &model.GeneratorCheckpoint{Count: 10}
+		cursor, manifest, err := findGeneratorDocuments(ctx, env, coll, generatorDocuments{migration: "migration", ns: ns, checkpoint: cp, backup: opts})
+		require.NoError(t, err)
+		assert.Equal(t, coll.FindCursor, cursor)
+		assert.Empty(t, manifest)
+	})
+	t.Run("MissingBackup", func(t *testing.T) {
+		cp := &model.GeneratorCheckpoint{Count: 1, Backup: filepath.Join(t.TempDir(), "manifest.json")}
+		_, _, err := findGeneratorDocuments(ctx, env, coll, generatorDocuments{migration: "migration", ns: ns, checkpoint: cp, backup: opts})
+		assert.Error(t, err)
+
+		_, err = openBackupCursor(ctx, writeBackup(t, model.Namespace{DB: "foo", Collection: "other"}, "one"), ns, 0)
+		assert.Error(t, err)
+	})
+	t.Run("WithoutMongoClient", func(t *testing.T) {
+		cursor, manifest, err := findGeneratorDocuments(ctx, env, coll, generatorDocuments{migration: "migration", ns: ns, checkpoint: &model.GeneratorCheckpoint{}, backup: opts})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "without a MongoDB client")
+		assert.Nil(t, cursor)
+		assert.Empty(t, manifest)
+	})
+	t.Run("CanarySample", func(t *testing.T) {
+		ids, err := cursorIDs(ctx, &mock.Cursor{ShouldIter: true, MaxNextCalls: 3, Results: []interface{}{&doc{"one"}, &doc{"two"}}})
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{"one", "two"}, ids)
+	})
+	t.Run("BackupCursor", func(t *testing.T) {
+		cursor, err := openBackupCursor(ctx, writeBackup(t, ns, "one", "two"), ns, 0)
+		require.NoError(t, err)
+
+		require.True(t, cursor.Next(ctx))
+		out := doc{}
+		require.NoError(t, cursor.Decode(&out))
+		assert.Equal(t, "one", out.ID)
+
+		rest := []bson.M{}
+		require.NoError(t, cursor.All(ctx, &rest))
+		assert.Equal(t, []bson.M{{"_id": "two"}}, rest)
+		assert.False(t, cursor.Next(ctx))
+		assert.NoError(t, cursor.Err())
+		assert.NoError(t, cursor.Close(ctx))
+	})
+}
+
+// writeBackup writes a backup of the namespace that holds documents
+// with the _id values, and returns the path of its manifest.
+func writeBackup(t *testing.T, ns model.Namespace, ids ...string) string {
+	dir := t.TempDir()
+	data := []byte{}
+	for _, id := range ids {
+		doc, err := bson.Marshal(bson.M{"_id": id})
+		require.NoError(t, err)
+		data = append(data, doc...)
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ns.DB), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ns.DB, ns.Collection+".bson"), data, 0644))
+
+	manifest, err := json.Marshal(&backup.Manifest{Collections: []backup.ManifestEntry{{NS: ns, Documents: int64(len(ids))}}})
+	require.NoError(t, err)
+	fn := filepath.Join(dir, backup.ManifestFileName)
+	require.NoError(t, os.WriteFile(fn, manifest, 0644))
+
+	return fn
+}
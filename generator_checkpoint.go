@@ -0,0 +1,426 @@
+package anser
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// checkpointID returns the ID of the document in the metadata
+// namespace that holds the checkpoint for the generator.
+func checkpointID(generator string) string { return fmt.Sprintf("%s.checkpoint", generator) }
+
+// checkpointJobsID returns the ID of the document in the metadata
+// namespace that holds the IDs of the jobs that the generator added
+// before the checkpoint at the count.
+func checkpointJobsID(generator string, count int) string {
+	return fmt.Sprintf("%s.checkpoint.%d", generator, count)
+}
+
+// getGeneratorCheckpoint returns the saved checkpoint for the
+// generator, or an empty checkpoint if the generator has not saved
+// one.
+func getGeneratorCheckpoint(ctx context.Context, env Environment, generator string) (*model.GeneratorCheckpoint, error) {
+	cl, err := env.GetClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting database client")
+	}
+
+	ns := env.MetadataNamespace()
+	cp := &model.GeneratorCheckpoint{}
+	res := cl.Database(ns.DB).Collection(ns.Collection).FindOne(ctx, bson.M{"_id": checkpointID(generator)})
+	if err = res.Err(); err == mongo.ErrNoDocuments {
+		return &model.GeneratorCheckpoint{ID: checkpointID(generator), Generator: generator}, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "finding checkpoint")
+	}
+
+	if err = res.Decode(cp); err != nil {
+		return nil, errors.Wrap(err, "decoding checkpoint")
+	}
+
+	cp.ID = checkpointID(generator)
+	cp.Generator = generator
+	return cp, nil
+}
+
+// saveGeneratorCheckpoint records the checkpoint in the metadata
+// namespace, replacing the previous checkpoint for the generator.
+func saveGeneratorCheckpoint(ctx context.Context, env Environment, cp *model.GeneratorCheckpoint) error {
+	cl, err := env.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "getting database client")
+	}
+
+	ns := env.MetadataNamespace()
+	_, err = cl.Database(ns.DB).Collection(ns.Collection).ReplaceOne(ctx,
+		bson.M{"_id": cp.ID}, cp, options.Replace().SetUpsert(true))
+
+	return errors.Wrapf(err, "saving checkpoint for '%s'", cp.Generator)
+}
+
+// resumeGenerator returns the saved checkpoint for the generator, and
+// adds the IDs of the jobs that the generator added to the queue
+// before the checkpoint to the generator's group in the dependency
+// network, because the generator only adds the jobs it produces after
+// the checkpoint to the group itself.
+func resumeGenerator(ctx context.Context, env Environment, generator string) (*model.GeneratorCheckpoint, error) {
+	cp, err := getGeneratorCheckpoint(ctx, env, generator)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if cp.Count == 0 {
+		return cp, nil
+	}
+
+	if err = restoreCheckpointJobs(ctx, env, cp); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return cp, nil
+}
+
+// restoreCheckpointJobs adds the IDs of the jobs that the generator
+// added before the checkpoint to its group in the dependency network.
+func restoreCheckpointJobs(ctx context.Context, env Environment, cp *model.GeneratorCheckpoint) error {
+	network, err := env.GetDependencyNetwork()
+	if err != nil {
+		return errors.Wrap(err, "getting dependency network")
+	}
+
+	cl, err := env.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "getting database client")
+	}
+
+	ns := env.MetadataNamespace()
+	cursor, err := cl.Database(ns.DB).Collection(ns.Collection).Find(ctx, bson.M{
+		"generator": cp.Generator,
+		"jobs":      bson.M{"$exists": true},
+		"count":     bson.M{"$lte": cp.Count},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "finding jobs of '%s'", cp.Generator)
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for cursor.Next(ctx) {
+		jobs := model.GeneratorCheckpointJobs{}
+		if err = cursor.Decode(&jobs); err != nil {
+			catcher.Wrapf(err, "decoding jobs of '%s'", cp.Generator)
+			break
+		}
+		network.AddGroup(cp.Generator, jobs.Jobs)
+	}
+	catcher.Wrapf(cursor.Err(), "finding jobs of '%s'", cp.Generator)
+	catcher.Add(cursor.Close(ctx))
+
+	return catcher.Resolve()
+}
+
+// saveCheckpointJobs records the IDs of the jobs that the generator
+// added since its previous checkpoint.
+func saveCheckpointJobs(ctx context.Context, env Environment, cp *model.GeneratorCheckpoint, count int, ids []string) error {
+	cl, err := env.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "getting database client")
+	}
+
+	jobs := &model.GeneratorCheckpointJobs{
+		ID:        checkpointJobsID(cp.Generator, count),
+		Generator: cp.Generator,
+		Count:     count,
+		Jobs:      ids,
+	}
+
+	ns := env.MetadataNamespace()
+	_, err = cl.Database(ns.DB).Collection(ns.Collection).ReplaceOne(ctx,
+		bson.M{"_id": jobs.ID}, jobs, options.Replace().SetUpsert(true))
+
+	return errors.Wrapf(err, "saving jobs of checkpoint for '%s'", cp.Generator)
+}
+
+// generatorFind returns the query and options that generators use to
+// find the documents to migrate. When the checkpoint is not nil, the
+// documents are sorted by _id and the query resumes after the last
+// document that the checkpoint recorded. Limited finds are also sorted
+// by _id, so that the backups of generators find the same documents.
+func generatorFind(query map[string]interface{}, limit int, cp *model.GeneratorCheckpoint) (map[string]interface{}, *options.FindOptions) {
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	if cp == nil {
+		if limit > 0 {
+			opts.SetSort(bson.M{"_id": 1})
+			opts.SetLimit(int64(limit))
+		}
+		return query, opts
+	}
+
+	opts.SetSort(bson.M{"_id": 1})
+	if limit > 0 {
+		opts.SetLimit(int64(limit - cp.Count))
+	}
+
+	if cp.LastID == nil {
+		return query, opts
+	}
+
+	resume := map[string]interface{}{"_id": map[string]interface{}{"$gt": cp.LastID}}
+	if len(query) == 0 {
+		return resume, opts
+	}
+
+	return map[string]interface{}{"$and": []interface{}{query, resume}}, opts
+}
+
+// generatorBatchSize returns the number of jobs that a generator
+// holds before it adds them to the queue, or 0 if the generator holds
+// all of its jobs until the application collects them. Checkpointing
+// generators must add their jobs before each checkpoint, so the
+// checkpoint interval is the batch size if none is set. Continuous
+// generators add each job as soon as they produce it, so that changed
+// documents are migrated promptly. Generators in dry runs hold all of
+// their jobs, so that the application can report on every migration
+// operation.
+func generatorBatchSize(batchSize, checkpointInterval int, dryRun, continuous bool) int {
+	if dryRun {
+		return 0
+	}
+	if continuous {
+		return 1
+	}
+	if batchSize > 0 {
+		return batchSize
+	}
+
+	return checkpointInterval
+}
+
+// addGeneratedJobs sets the dependencies of jobs produced by the
+// generator, adds them to the queue, and adds their IDs to the
+// generator's group in the dependency network. Generators use this to
+// add their jobs to the queue while they run, rather than waiting for
+// the application to collect the jobs after all generators
+// complete. During dry runs, the jobs are only logged.
+func addGeneratedJobs(ctx context.Context, env Environment, groupID string, jobs []amboy.Job, dryRun bool) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	network, err := env.GetDependencyNetwork()
+	if err != nil {
+		return errors.Wrap(err, "getting dependency network")
+	}
+
+	ids := make([]string, 0, len(jobs))
+	for _, j := range jobs {
+		ids = append(ids, j.ID())
+	}
+
+	if dryRun {
+		for _, id := range ids {
+			grip.Infof("dry-run: would have added %s", id)
+		}
+		network.AddGroup(groupID, ids)
+		return nil
+	}
+
+	queue, err := env.GetQueue()
+	if err != nil {
+		return errors.Wrap(err, "getting queue")
+	}
+	if queue == nil {
+		return errors.New("no queue defined")
+	}
+
+	input := make(chan amboy.Job, len(jobs))
+	for _, j := range jobs {
+		input <- j
+	}
+	close(input)
+
+	out, err := generator(env, groupID, input)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for j := range out {
+		catcher.Add(queue.Put(ctx, j))
+	}
+	network.AddGroup(groupID, ids)
+
+	grip.Infof("added %d operations for migration %s", len(ids), groupID)
+	return catcher.Resolve()
+}
+
+// jobHolder is implemented by generators, which hold the jobs that
+// they produce until they add them to the queue or the application
+// collects them.
+type jobHolder interface {
+	heldJobs() []amboy.Job
+	clearJobs()
+}
+
+// generatorLoop produces the jobs of a generator for the documents
+// from its cursor, and adds them to the queue in batches and at each
+// checkpoint. Generators only describe how to produce their jobs.
+type generatorLoop struct {
+	id         string
+	dryRun     bool
+	limit      int
+	batchSize  int
+	interval   int
+	checkpoint *model.GeneratorCheckpoint
+	generated  *int
+	holder     jobHolder
+
+	// queued, if set, is called after the loop adds jobs to the
+	// queue.
+	queued func()
+
+	// newJob produces the job for the document at the position, and
+	// returns the job's ID, or an empty string if the generator holds
+	// the document until flush produces a job for several documents.
+	newJob func(docID interface{}, position int) string
+
+	// flush, if set, produces a job for the documents that the
+	// generator holds, where position is the position of the last
+	// document, and returns the ID of the job, or an empty string if
+	// the generator does not hold any documents.
+	flush func(position int) string
+}
+
+// run produces the jobs for the documents from the cursor, and
+// returns the IDs of the jobs that the generator still holds, which
+// the application adds to the queue. If a document cannot be decoded,
+// run stops, records a checkpoint for the documents before it, and
+// returns the error.
+func (l *generatorLoop) run(ctx context.Context, env Environment, iter client.Cursor) ([]string, error) {
+	if c, ok := iter.(*continuousCursor); ok {
+		l.queued = c.jobsQueued
+	}
+
+	ids := []string{}
+	var lastID interface{}
+	if l.checkpoint != nil {
+		lastID = l.checkpoint.LastID
+	}
+
+	count := 0
+	offset := 0
+	if l.checkpoint != nil {
+		offset = l.checkpoint.Count
+	}
+	held := 0
+	// added holds the IDs of all of the jobs since the previous
+	// checkpoint, including those already added to the queue.
+	added := []string{}
+	add := func(id string) {
+		if id == "" {
+			return
+		}
+		ids = append(ids, id)
+		added = append(added, id)
+		held++
+		*l.generated++
+	}
+
+	var decodeErr error
+	for iter.Next(ctx) {
+		doc := struct {
+			ID interface{} `bson:"_id"`
+		}{}
+		if decodeErr = iter.Decode(&doc); decodeErr != nil {
+			decodeErr = errors.Wrapf(decodeErr, "decoding document %d of migration '%s'", offset+count, l.id)
+			break
+		}
+		count++
+		lastID = doc.ID
+
+		add(l.newJob(doc.ID, offset+count-1))
+
+		if l.checkpoint != nil && count%l.interval == 0 {
+			l.flushHeld(add, offset+count-1)
+			if err := l.saveCheckpoint(ctx, env, doc.ID, offset+count, added); err != nil {
+				return ids, errors.WithStack(err)
+			}
+			ids = []string{}
+			added = []string{}
+			held = 0
+		} else if l.batchSize > 0 && held >= l.batchSize {
+			if err := l.addJobs(ctx, env); err != nil {
+				return ids, errors.WithStack(err)
+			}
+			ids = []string{}
+			held = 0
+		}
+
+		if l.limit > 0 && offset+count >= l.limit {
+			break
+		}
+	}
+
+	l.flushHeld(add, offset+count-1)
+
+	if l.checkpoint != nil && count%l.interval != 0 {
+		if err := l.saveCheckpoint(ctx, env, lastID, offset+count, added); err != nil {
+			return ids, errors.WithStack(err)
+		}
+		ids = []string{}
+	} else if l.batchSize > 0 && held > 0 {
+		if err := l.addJobs(ctx, env); err != nil {
+			return ids, errors.WithStack(err)
+		}
+		ids = []string{}
+	}
+
+	return ids, decodeErr
+}
+
+func (l *generatorLoop) flushHeld(add func(string), position int) {
+	if l.flush != nil {
+		add(l.flush(position))
+	}
+}
+
+// addJobs adds the jobs that the generator holds to the queue, so
+// that the generator does not hold every job that it produces.
+func (l *generatorLoop) addJobs(ctx context.Context, env Environment) error {
+	if err := addGeneratedJobs(ctx, env, l.id, l.holder.heldJobs(), l.dryRun); err != nil {
+		return errors.Wrapf(err, "adding jobs for migration '%s'", l.id)
+	}
+	l.holder.clearJobs()
+	if l.queued != nil {
+		l.queued()
+	}
+
+	return nil
+}
+
+// saveCheckpoint adds the generated jobs to the queue, records the
+// IDs of the jobs added since the previous checkpoint, and then
+// records the checkpoint, so that the checkpoint never covers
+// documents whose jobs were not added to the queue.
+func (l *generatorLoop) saveCheckpoint(ctx context.Context, env Environment, lastID interface{}, count int, added []string) error {
+	if err := l.addJobs(ctx, env); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := saveCheckpointJobs(ctx, env, l.checkpoint, count, added); err != nil {
+		return errors.WithStack(err)
+	}
+
+	l.checkpoint.LastID = lastID
+	l.checkpoint.Count = count
+	l.checkpoint.Generated = *l.generated
+	return errors.WithStack(saveGeneratorCheckpoint(ctx, env, l.checkpoint))
+}
@@ -0,0 +1,226 @@
+package anser
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratorFind(t *testing.T) {
+	query := map[string]interface{}{"a": 1}
+
+	t.Run("WithoutCheckpoint", func(t *testing.T) {
+		q, opts := generatorFind(query, 0, nil)
+		assert.Equal(t, query, q)
+		assert.Nil(t, opts.Sort)
+		assert.Nil(t, opts.Limit)
+
+		q, opts = generatorFind(query, 10, nil)
+		assert.Equal(t, query, q)
+		require.NotNil(t, opts.Limit)
+		assert.EqualValues(t, 10, *opts.Limit)
+	})
+	t.Run("EmptyCheckpoint", func(t *testing.T) {
+		q, opts := generatorFind(query, 10, &model.GeneratorCheckpoint{})
+		assert.Equal(t, query, q)
+		assert.NotNil(t, opts.Sort)
+		require.NotNil(t, opts.Limit)
+		assert.EqualValues(t, 10, *opts.Limit)
+	})
+	t.Run("ResumesAfterCheckpoint", func(t *testing.T) {
+		cp := &model.GeneratorCheckpoint{LastID: "foo", Count: 4}
+		q, opts := generatorFind(query, 10, cp)
+		assert.Equal(t, map[string]interface{}{"$and": []interface{}{
+			query,
+			map[string]interface{}{"_id": map[string]interface{}{"$gt": "foo"}},
+		}}, q)
+		assert.NotNil(t, opts.Sort)
+		require.NotNil(t, opts.Limit)
+		assert.EqualValues(t, 6, *opts.Limit)
+	})
+	t.Run("ResumesWithoutQuery", func(t *testing.T) {
+		cp := &model.GeneratorCheckpoint{LastID: "foo", Count: 4}
+		q, _ := generatorFind(nil, 0, cp)
+		assert.Equal(t, map[string]interface{}{"_id": map[string]interface{}{"$gt": "foo"}}, q)
+	})
+}
+
+func TestGeneratorCheckpointPersistence(t *testing.T) {
+	ctx := context.Background()
+	env := mock.NewEnvironment()
+	env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+
+	t.Run("NoClient", func(t *testing.T) {
+		env.ClientError = errors.New("no client")
+		defer func() { env.ClientError = nil }()
+
+		cp, err := getGeneratorCheckpoint(ctx, env, "gen")
+		assert.Error(t, err)
+		assert.Nil(t, cp)
+		assert.Error(t, saveGeneratorCheckpoint(ctx, env, &model.GeneratorCheckpoint{}))
+	})
+	t.Run("FindError", func(t *testing.T) {
+		env.Client = mock.NewClient()
+		res := mock.NewSingleResult()
+		res.ErrorValue = errors.New("find failed")
+		env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{
+			"migrations.metadata": {SingleResult: res},
+		}}
+
+		cp, err := getGeneratorCheckpoint(ctx, env, "gen")
+		assert.Error(t, err)
+		assert.Nil(t, cp)
+	})
+	t.Run("Found", func(t *testing.T) {
+		env.Client = mock.NewClient()
+
+		cp, err := getGeneratorCheckpoint(ctx, env, "gen")
+		require.NoError(t, err)
+		assert.Equal(t, "gen.checkpoint", cp.ID)
+		assert.Equal(t, "gen", cp.Generator)
+		assert.NoError(t, saveGeneratorCheckpoint(ctx, env, cp))
+	})
+}
+
+func TestAddGeneratedJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env := mock.NewEnvironment()
+
+	jobs := []amboy.Job{
+		NewSimpleMigration(env, model.Simple{}),
+		NewSimpleMigration(env, model.Simple{}),
+	}
+	jobs[0].(*simpleMigrationJob).SetID("one")
+	jobs[1].(*simpleMigrationJob).SetID("two")
+
+	t.Run("NoJobs", func(t *testing.T) {
+		assert.NoError(t, addGeneratedJobs(ctx, env, "gen", nil, false))
+	})
+	t.Run("NoQueue", func(t *testing.T) {
+		assert.Error(t, addGeneratedJobs(ctx, env, "gen", jobs, false))
+	})
+	t.Run("QueueError", func(t *testing.T) {
+		env.QueueError = errors.New("no queue")
+		defer func() { env.QueueError = nil }()
+		assert.Error(t, addGeneratedJobs(ctx, env, "gen", jobs, false))
+	})
+	t.Run("AddsJobs", func(t *testing.T) {
+		env.Queue = queue.NewLocalLimitedSize(2, 128)
+		require.NoError(t, env.Queue.Start(ctx))
+		env.Network.Add("gen", []string{"dep"})
+		env.Network.AddGroup("dep", []string{"dep.0"})
+
+		require.NoError(t, addGeneratedJobs(ctx, env, "gen", jobs, false))
+		assert.Equal(t, 2, env.Queue.Stats(ctx).Total)
+		assert.Contains(t, env.Network.Network()["gen"], "one")
+		assert.Contains(t, env.Network.Network()["gen"], "two")
+	})
+	t.Run("DryRun", func(t *testing.T) {
+		defer func() { env.Queue = nil }()
+		env.Queue = nil
+		env.Network = mock.NewDependencyNetwork()
+
+		require.NoError(t, addGeneratedJobs(ctx, env, "gen", jobs, true))
+		assert.Equal(t, []string{"one", "two"}, env.Network.Network()["gen"])
+	})
+}
+
+func TestGeneratorBatchSize(t *testing.T) {
+	assert.Equal(t, 0, generatorBatchSize(0, 0, false, false))
+	assert.Equal(t, 100, generatorBatchSize(100, 0, false, false))
+	assert.Equal(t, 100, generatorBatchSize(100, 10, false, false))
+	assert.Equal(t, 10, generatorBatchSize(0, 10, false, false))
+	assert.Equal(t, 0, generatorBatchSize(100, 10, true, false))
+	assert.Equal(t, 1, generatorBatchSize(100, 0, false, true))
+	assert.Equal(t, 0, generatorBatchSize(0, 0, true, true))
+}
+
+// networkEnvironment uses a real dependency network, which, unlike
+// the mock network, resolves the groups of dependencies.
+type networkEnvironment struct {
+	*mock.Environment
+	network model.DependencyNetworker
+}
+
+func (e *networkEnvironment) GetDependencyNetwork() (model.DependencyNetworker, error) {
+	return e.network, nil
+}
+
+func TestGeneratorResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	meta := &mock.Collection{}
+	env := &networkEnvironment{Environment: mock.NewEnvironment(), network: newDependencyNetwork()}
+	env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+	env.Client = mock.NewClient()
+	env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{"migrations.metadata": meta}}
+	env.Queue = queue.NewLocalLimitedSize(2, 128)
+	require.NoError(t, env.Queue.Start(ctx))
+
+	newGenerator := func(cp *model.GeneratorCheckpoint) *manualMigrationGenerator {
+		job := NewManualMigrationGenerator(env, model.GeneratorOptions{
+			JobID:              "manual",
+			NS:                 model.Namespace{DB: "foo", Collection: "bar"},
+			CheckpointInterval: 2,
+		}, "op").(*manualMigrationGenerator)
+		job.checkpoint = cp
+		return job
+	}
+
+	// the first run stops after its first checkpoint
+	job := newGenerator(&model.GeneratorCheckpoint{ID: checkpointID("manual"), Generator: "manual"})
+	cursor := &mock.Cursor{ShouldIter: true, MaxNextCalls: 3, Results: []interface{}{&doc{"one"}, &doc{"two"}}}
+	assert.Empty(t, job.generateJobs(ctx, env, cursor))
+	require.NoError(t, job.Error())
+
+	saved := []interface{}{}
+	for _, update := range meta.Updates {
+		if jobs, ok := update.(*model.GeneratorCheckpointJobs); ok {
+			saved = append(saved, jobs)
+		}
+	}
+	require.Len(t, saved, 1)
+	assert.Equal(t, "manual.checkpoint.2", saved[0].(*model.GeneratorCheckpointJobs).ID)
+	assert.Equal(t, []string{"manual.one.0", "manual.two.1"}, saved[0].(*model.GeneratorCheckpointJobs).Jobs)
+
+	// after a restart, the dependency network no longer holds the
+	// jobs that the generator added before its checkpoint
+	env.network = newDependencyNetwork()
+	env.network.Add("dependent", []string{"manual"})
+	meta.FindCursor = &mock.Cursor{ShouldIter: true, MaxNextCalls: 2, Results: saved}
+
+	cp := &model.GeneratorCheckpoint{ID: checkpointID("manual"), Generator: "manual", LastID: "two", Count: 2, Generated: 2}
+	require.NoError(t, restoreCheckpointJobs(ctx, env, cp))
+	job = newGenerator(cp)
+	cursor = &mock.Cursor{ShouldIter: true, MaxNextCalls: 2, Results: []interface{}{&doc{"three"}}}
+	assert.Empty(t, job.generateJobs(ctx, env, cursor))
+	require.NoError(t, job.Error())
+	assert.ElementsMatch(t, []string{"manual.one.0", "manual.two.1", "manual.three.2"}, env.network.GetGroup("manual"))
+
+	// migrations that depend on the generator wait for the jobs
+	// from before the checkpoint
+	dependent := NewSimpleMigration(env, model.Simple{ID: "a", Migration: "dependent"}).(*simpleMigrationJob)
+	dependent.SetID("dependent.a.0")
+	dependent.SetDependency(env.NewDependencyManager("dependent"))
+	input := make(chan amboy.Job, 1)
+	input <- dependent
+	close(input)
+	out, err := generator(env, "dependent", input)
+	require.NoError(t, err)
+	for j := range out {
+		assert.Contains(t, j.Dependency().Edges(), "manual.one.0")
+		assert.Contains(t, j.Dependency().Edges(), "manual.three.2")
+	}
+
+	meta.FindError = errors.New("find failed")
+	assert.Error(t, restoreCheckpointJobs(ctx, env, cp))
+}
@@ -89,6 +89,24 @@ func TestManualMigrationGenerator(t *testing.T) {
 			}
 			env.ClientError = nil
 		})
+		t.Run("BackupError", func(t *testing.T) {
+			// backups need a MongoDB client, so the mock client
+			// cannot back up documents before the generator runs
+			job = factory().(*manualMigrationGenerator)
+			job.NS = ns
+			job.Backup = &model.BackupOptions{Path: t.TempDir()}
+			job.SetID("manual")
+			env.Client.Databases["foo"].Collections["bar"].FindError = errors.New("injected query error")
+			defer func() { env.Client.Databases["foo"].Collections["bar"].FindError = nil }()
+			job.MigrationHelper = mh
+			job.Run(ctx)
+			assert.True(t, job.Status().Completed)
+			if assert.True(t, job.HasErrors()) {
+				err = job.Error()
+				assert.Contains(t, err.Error(), "cannot back up documents of migration 'manual'")
+				assert.NotContains(t, err.Error(), "injected query error")
+			}
+		})
 		t.Run("Generation", func(t *testing.T) {
 			defer func() { env.Network = mock.NewDependencyNetwork() }()
 			env.Network = mock.NewDependencyNetwork()
@@ -97,6 +115,7 @@ func TestManualMigrationGenerator(t *testing.T) {
 			job.NS = ns
 			job.MigrationHelper = mh
 			job.Limit = 3
+			job.RateLimit = &model.RateLimit{DocumentsPerSecond: 10}
 			job.SetID("manual")
 
 			cursor := &mock.Cursor{
@@ -125,6 +144,9 @@ func TestManualMigrationGenerator(t *testing.T) {
 
 			assert.Len(t, ids, 3)
 			assert.Len(t, job.Migrations, 3)
+			for _, m := range job.Migrations {
+				assert.Equal(t, job.RateLimit, m.Definition.RateLimit)
+			}
 
 			network, err := env.GetDependencyNetwork()
 			require.NoError(t, err)
@@ -134,4 +156,27 @@ func TestManualMigrationGenerator(t *testing.T) {
 		})
 
 	})
+	t.Run("Rollback", func(t *testing.T) {
+		events := []*model.MigrationMetadata{
+			{ID: "manual.one.0", Migration: "manual", Target: "one", Completed: true},
+			{ID: "manual.two.1", Migration: "manual", Target: "two", Completed: true},
+		}
+
+		generator := NewManualMigrationGenerator(env, model.GeneratorOptions{JobID: "manual", NS: ns}, "forward").(*manualMigrationGenerator)
+		assert.Nil(t, generator.rollbackMigrations(env, events))
+
+		generator = NewManualMigrationGenerator(env, model.GeneratorOptions{
+			JobID:    "manual",
+			NS:       ns,
+			Rollback: &model.RollbackOptions{Name: "inverse"},
+		}, "forward").(*manualMigrationGenerator)
+		migrations := generator.rollbackMigrations(env, events)
+		require.Len(t, migrations, 2)
+		for idx, m := range migrations {
+			rollback := m.(*rollbackMigrationJob)
+			assert.True(t, strings.HasPrefix(rollback.ID(), events[idx].ID+".rollback."))
+			assert.Equal(t, events[idx].Target, rollback.Definition.ID)
+			assert.Equal(t, "inverse", rollback.Definition.OperationName)
+		}
+	})
 }
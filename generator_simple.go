@@ -12,8 +12,6 @@ import (
 	"github.com/mongodb/anser/model"
 	"github.com/mongodb/grip"
 	"github.com/mongodb/grip/message"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func init() {
@@ -30,6 +28,26 @@ func NewSimpleMigrationGenerator(e Environment, opts model.GeneratorOptions, upd
 	j.Query = opts.Query
 	j.Update = update
 	j.Limit = opts.Limit
+	j.BatchSize = opts.BatchSize
+	j.CheckpointInterval = opts.CheckpointInterval
+	j.BulkWriteSize = opts.BulkWriteSize
+	j.BulkWriteUnordered = opts.BulkWriteUnordered
+	j.RateLimit = opts.RateLimit
+	j.Rollback = opts.Rollback
+	j.Canary = opts.Canary
+	j.Verify = opts.Verify
+	j.Backup = opts.Backup
+	j.Continuous = opts.Continuous
+	return j
+}
+
+// NewSimplePipelineMigrationGenerator is the same as
+// NewSimpleMigrationGenerator, but the migrations apply an update
+// pipeline, which can compute new values from the existing fields of
+// each document, rather than an update document.
+func NewSimplePipelineMigrationGenerator(e Environment, opts model.GeneratorOptions, pipeline []map[string]interface{}) Generator {
+	j := NewSimpleMigrationGenerator(e, opts, nil).(*simpleMigrationGenerator)
+	j.Pipeline = pipeline
 	return j
 }
 
@@ -46,18 +64,44 @@ func makeSimpleGenerator() *simpleMigrationGenerator {
 }
 
 type simpleMigrationGenerator struct {
-	NS              model.Namespace        `bson:"ns" json:"ns" yaml:"ns"`
-	Query           map[string]interface{} `bson:"source_query" json:"source_query" yaml:"source_query"`
-	Limit           int                    `bson:"limit" json:"limit" yaml:"limit"`
-	Update          map[string]interface{} `bson:"update" json:"update" yaml:"update"`
-	Migrations      []*simpleMigrationJob  `bson:"migrations" json:"migrations" yaml:"migrations"`
-	job.Base        `bson:"job_base" json:"job_base" yaml:"job_base"`
-	MigrationHelper `bson:"-" json:"-" yaml:"-"`
-	mu              sync.Mutex
+	NS                 model.Namespace            `bson:"ns" json:"ns" yaml:"ns"`
+	Query              map[string]interface{}     `bson:"source_query" json:"source_query" yaml:"source_query"`
+	Limit              int                        `bson:"limit" json:"limit" yaml:"limit"`
+	BatchSize          int                        `bson:"batch_size" json:"batch_size" yaml:"batch_size"`
+	CheckpointInterval int                        `bson:"checkpoint_interval" json:"checkpoint_interval" yaml:"checkpoint_interval"`
+	BulkWriteSize      int                        `bson:"bulk_write_size" json:"bulk_write_size" yaml:"bulk_write_size"`
+	BulkWriteUnordered bool                       `bson:"bulk_write_unordered" json:"bulk_write_unordered" yaml:"bulk_write_unordered"`
+	DryRun             bool                       `bson:"dry_run" json:"dry_run" yaml:"dry_run"`
+	RateLimit          *model.RateLimit           `bson:"rate_limit,omitempty" json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+	Rollback           *model.RollbackOptions     `bson:"rollback,omitempty" json:"rollback,omitempty" yaml:"rollback,omitempty"`
+	Canary             *model.Canary              `bson:"canary,omitempty" json:"canary,omitempty" yaml:"canary,omitempty"`
+	Verify             *model.VerifyOptions       `bson:"verify,omitempty" json:"verify,omitempty" yaml:"verify,omitempty"`
+	Backup             *model.BackupOptions       `bson:"backup,omitempty" json:"backup,omitempty" yaml:"backup,omitempty"`
+	Continuous         *model.ContinuousOptions   `bson:"continuous,omitempty" json:"continuous,omitempty" yaml:"continuous,omitempty"`
+	Update             map[string]interface{}     `bson:"update" json:"update" yaml:"update"`
+	Pipeline           []map[string]interface{}   `bson:"pipeline,omitempty" json:"pipeline,omitempty" yaml:"pipeline,omitempty"`
+	Migrations         []*simpleMigrationJob      `bson:"migrations" json:"migrations" yaml:"migrations"`
+	Batches            []*simpleBatchMigrationJob `bson:"batches" json:"batches" yaml:"batches"`
+	job.Base           `bson:"job_base" json:"job_base" yaml:"job_base"`
+	MigrationHelper    `bson:"-" json:"-" yaml:"-"`
+	mu                 sync.Mutex
+
+	// checkpoint is only set while the generator runs, when
+	// checkpointing is enabled.
+	checkpoint *model.GeneratorCheckpoint
+
+	// pending holds the _ids of documents that are not yet part
+	// of a batch, when bulk writes are enabled.
+	pending []interface{}
+
+	// generated counts the jobs that the generator has produced,
+	// including those produced before its checkpoint.
+	generated int
 }
 
 func (j *simpleMigrationGenerator) Run(ctx context.Context) {
-	defer j.FinishMigration(ctx, j.ID(), &j.Base)
+	meta := &model.MigrationMetadata{Migration: j.ID()}
+	defer finishMigration(ctx, j.MigrationHelper, meta, &j.Base)
 
 	env := j.Env()
 
@@ -73,80 +117,224 @@ func (j *simpleMigrationGenerator) Run(ctx context.Context) {
 		return
 	}
 
-	findOpts := options.Find().SetProjection(bson.M{"_id": 1})
-	if j.Limit > 0 {
-		findOpts.SetLimit(int64(j.Limit))
+	if j.CheckpointInterval > 0 && !j.DryRun {
+		j.checkpoint, err = resumeGenerator(ctx, env, j.ID())
+		if err != nil {
+			j.AddError(err)
+			return
+		}
+		j.generated = j.checkpoint.Generated
+		meta.Generated = j.generated
+
+		if j.Limit > 0 && j.checkpoint.Count >= j.Limit {
+			grip.Infof("migration generator %s already reached its limit of %d documents", j.ID(), j.Limit)
+			return
+		}
+	}
+
+	coll := client.Database(j.NS.DB).Collection(j.NS.Collection)
+	stream, err := watchGenerator(ctx, env, j.ID(), coll, j.Query, j.Continuous, j.DryRun)
+	if err != nil {
+		j.AddError(err)
+		return
+	}
+	if stream != nil {
+		defer func() { grip.Warning(message.WrapError(stream.Close(ctx), "closing change stream")) }()
+	}
+
+	docs := generatorDocuments{
+		migration:  j.ID(),
+		ns:         j.NS,
+		query:      j.Query,
+		limit:      j.Limit,
+		checkpoint: j.checkpoint,
+		canary:     j.Canary,
+	}
+	if !j.DryRun {
+		docs.backup = j.Backup
 	}
 
-	cursor, err := client.Database(j.NS.DB).Collection(j.NS.Collection).Find(ctx, j.Query, findOpts) // findOpts
+	cursor, manifest, err := findGeneratorDocuments(ctx, env, coll, docs)
 	if err != nil {
 		j.AddError(err)
 		return
 	}
+	meta.Backup = manifest
 
+	cursor = newContinuousCursor(env, j.ID(), cursor, stream, j.Continuous)
 	network.AddGroup(j.ID(), j.generateJobs(ctx, env, cursor))
+	j.AddError(cursor.Err())
+	meta.Generated = j.generated
 }
 
 func (j *simpleMigrationGenerator) generateJobs(ctx context.Context, env Environment, iter client.Cursor) []string {
-	ids := []string{}
-	doc := struct {
-		ID interface{} `bson:"_id"`
-	}{}
-
 	j.mu.Lock()
 	defer j.mu.Unlock()
-	count := 0
 
-	for iter.Next(ctx) {
-		count++
+	loop := &generatorLoop{
+		id:         j.ID(),
+		dryRun:     j.DryRun,
+		limit:      j.Limit,
+		batchSize:  generatorBatchSize(j.BatchSize, j.CheckpointInterval, j.DryRun, j.Continuous != nil),
+		interval:   j.CheckpointInterval,
+		checkpoint: j.checkpoint,
+		generated:  &j.generated,
+		holder:     j,
+		newJob: func(docID interface{}, position int) string {
+			if j.BulkWriteSize > 0 {
+				j.pending = append(j.pending, docID)
+				if len(j.pending) < j.BulkWriteSize {
+					return ""
+				}
+				return j.addBatch(env, position)
+			}
 
-		if err := iter.Decode(&doc); err != nil {
-			grip.Error(message.WrapError(err, "decoding generator results"))
-			break
-		}
+			m := NewSimpleMigration(env, model.Simple{
+				ID:        docID,
+				Update:    j.Update,
+				Pipeline:  j.Pipeline,
+				Migration: j.ID(),
+				Namespace: j.NS,
+				RateLimit: j.RateLimit,
+			}).(*simpleMigrationJob)
 
-		m := NewSimpleMigration(env, model.Simple{
-			ID:        doc.ID,
-			Update:    j.Update,
-			Migration: j.ID(),
-			Namespace: j.NS,
-		}).(*simpleMigrationJob)
-
-		m.SetDependency(env.NewDependencyManager(j.ID()))
-		m.SetID(fmt.Sprintf("%s.%v.%d", j.ID(), doc.ID, len(ids)))
-		ids = append(ids, m.ID())
-		j.Migrations = append(j.Migrations, m)
-
-		grip.Debug(message.Fields{
-			"ns":  j.NS,
-			"id":  m.ID(),
-			"doc": doc.ID,
-			"num": count,
-		})
-
-		if j.Limit > 0 && count >= j.Limit {
-			break
-		}
+			m.SetDependency(env.NewDependencyManager(j.ID()))
+			m.SetID(fmt.Sprintf("%s.%v.%d", j.ID(), docID, position))
+			j.Migrations = append(j.Migrations, m)
+
+			grip.Debug(message.Fields{
+				"ns":  j.NS,
+				"id":  m.ID(),
+				"doc": docID,
+				"num": position + 1,
+			})
+
+			return m.ID()
+		},
+		flush: func(position int) string {
+			if len(j.pending) == 0 {
+				return ""
+			}
+			return j.addBatch(env, position)
+		},
 	}
 
+	ids, err := loop.run(ctx, env, iter)
+	j.AddError(err)
 	return ids
 }
 
+// addBatch creates a job that migrates the pending documents with a
+// single bulk write. The job's ID includes the position of the last
+// document in the batch, so that the IDs are stable when the
+// generator resumes from a checkpoint.
+func (j *simpleMigrationGenerator) addBatch(env Environment, last int) string {
+	m := NewSimpleBatchMigration(env, model.SimpleBatch{
+		IDs:       j.pending,
+		Update:    j.Update,
+		Pipeline:  j.Pipeline,
+		Unordered: j.BulkWriteUnordered,
+		Migration: j.ID(),
+		Namespace: j.NS,
+		RateLimit: j.RateLimit,
+	}).(*simpleBatchMigrationJob)
+
+	m.SetDependency(env.NewDependencyManager(j.ID()))
+	m.SetID(fmt.Sprintf("%s.batch.%d", j.ID(), last))
+	j.Batches = append(j.Batches, m)
+	j.pending = nil
+
+	grip.Debug(message.Fields{
+		"ns":   j.NS,
+		"id":   m.ID(),
+		"docs": len(m.Definition.IDs),
+		"num":  last + 1,
+	})
+
+	return m.ID()
+}
+
+// heldJobs returns all of the jobs that the generator holds.
+func (j *simpleMigrationGenerator) heldJobs() []amboy.Job {
+	jobs := make([]amboy.Job, 0, len(j.Migrations)+len(j.Batches))
+	for _, m := range j.Migrations {
+		jobs = append(jobs, m)
+	}
+	for _, m := range j.Batches {
+		jobs = append(jobs, m)
+	}
+
+	return jobs
+}
+
+func (j *simpleMigrationGenerator) clearJobs() {
+	j.Migrations = []*simpleMigrationJob{}
+	j.Batches = []*simpleBatchMigrationJob{}
+}
+
+// setApplicationOptions prevents the generator from adding jobs to
+// the queue during dry runs, and, because streaming generators add
+// their jobs to the queue directly, applies the application's limit to
+// the generator's own limit.
+func (j *simpleMigrationGenerator) setApplicationOptions(opts model.ApplicationOptions) {
+	j.DryRun = opts.DryRun
+	if generatorBatchSize(j.BatchSize, j.CheckpointInterval, opts.DryRun, j.Continuous != nil) > 0 && opts.Limit > 0 && (j.Limit == 0 || opts.Limit < j.Limit) {
+		j.Limit = opts.Limit
+	}
+}
+
+func (j *simpleMigrationGenerator) source() (model.Namespace, map[string]interface{}) {
+	return j.NS, j.Query
+}
+
+func (j *simpleMigrationGenerator) canary() *model.Canary { return j.Canary }
+
+func (j *simpleMigrationGenerator) verification() *model.Verification {
+	return generatorVerification(j.ID(), j.NS, j.Verify, j.Canary != nil || j.Limit > 0)
+}
+
 func (j *simpleMigrationGenerator) Jobs() <-chan amboy.Job {
 	env := j.Env()
 
 	j.mu.Lock()
 	defer j.mu.Unlock()
 
-	jobs := make(chan amboy.Job, len(j.Migrations))
-	for _, job := range j.Migrations {
+	held := j.heldJobs()
+	jobs := make(chan amboy.Job, len(held))
+	for _, job := range held {
 		jobs <- job
 	}
 	close(jobs)
 
 	out, err := generator(env, j.ID(), jobs)
 	grip.Error(err)
-	grip.Infof("produced %d tasks for migration %s", len(j.Migrations), j.ID())
-	j.Migrations = []*simpleMigrationJob{}
+	grip.Infof("produced %d tasks for migration %s", len(held), j.ID())
+	j.clearJobs()
+	return out
+}
+
+func (j *simpleMigrationGenerator) rollbackMigrations(env Environment, events []*model.MigrationMetadata) []Migration {
+	if j.Rollback == nil || len(j.Rollback.Update) == 0 {
+		return nil
+	}
+
+	out := []Migration{}
+	for _, meta := range events {
+		if meta.Target == nil && len(meta.Targets) == 0 {
+			continue
+		}
+
+		m := NewRollbackMigration(env, model.Rollback{
+			ID:        meta.Target,
+			IDs:       meta.Targets,
+			Update:    j.Rollback.Update,
+			Migration: j.ID(),
+			Events:    []string{meta.ID},
+			Namespace: j.NS,
+		}).(*rollbackMigrationJob)
+		m.SetID(rollbackJobID(meta.ID))
+		out = append(out, m)
+	}
+
 	return out
 }
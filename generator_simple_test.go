@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/mongodb/amboy/queue"
 	"github.com/mongodb/amboy/registry"
 	"github.com/mongodb/anser/mock"
 	"github.com/mongodb/anser/model"
@@ -125,6 +126,7 @@ func TestSimpleMigrationGenerator(t *testing.T) {
 
 			assert.Len(t, ids, 3)
 			assert.Len(t, job.Migrations, 3)
+			assert.Equal(t, 3, job.generated)
 
 			network, err := env.GetDependencyNetwork()
 			require.NoError(t, err)
@@ -134,4 +136,219 @@ func TestSimpleMigrationGenerator(t *testing.T) {
 		})
 
 	})
+	t.Run("Pipeline", func(t *testing.T) {
+		env.Network = mock.NewDependencyNetwork()
+		pipeline := []map[string]interface{}{{"$set": map[string]interface{}{"a": "$b"}}}
+
+		job := NewSimplePipelineMigrationGenerator(env, model.GeneratorOptions{JobID: "simple", NS: ns}, pipeline).(*simpleMigrationGenerator)
+		assert.Nil(t, job.Update)
+		assert.Equal(t, pipeline, job.Pipeline)
+		job.MigrationHelper = mh
+
+		cursor := &mock.Cursor{
+			Results:      []interface{}{&doc{"one"}},
+			ShouldIter:   true,
+			MaxNextCalls: 2,
+		}
+
+		ids := job.generateJobs(ctx, env, cursor)
+		require.Len(t, ids, 1)
+		require.Len(t, job.Migrations, 1)
+		assert.Equal(t, pipeline, job.Migrations[0].Definition.Pipeline)
+	})
+	t.Run("Rollback", func(t *testing.T) {
+		events := []*model.MigrationMetadata{
+			{ID: "simple.one.0", Migration: "simple", Target: "one", Completed: true},
+			{ID: "simple.none.1", Migration: "simple", Completed: true},
+		}
+
+		generator := NewSimpleMigrationGenerator(env, model.GeneratorOptions{JobID: "simple", NS: ns}, nil).(*simpleMigrationGenerator)
+		assert.Nil(t, generator.rollbackMigrations(env, events))
+
+		generator = NewSimpleMigrationGenerator(env, model.GeneratorOptions{
+			JobID:    "simple",
+			NS:       ns,
+			Rollback: &model.RollbackOptions{Update: map[string]interface{}{"$unset": map[string]interface{}{"a": 1}}},
+		}, nil).(*simpleMigrationGenerator)
+		migrations := generator.rollbackMigrations(env, events)
+		require.Len(t, migrations, 1)
+		rollback := migrations[0].(*rollbackMigrationJob)
+		assert.True(t, strings.HasPrefix(rollback.ID(), "simple.one.0.rollback."))
+		assert.NotEqual(t, rollback.ID(), generator.rollbackMigrations(env, events)[0].ID())
+		assert.Equal(t, "one", rollback.Definition.ID)
+		assert.Equal(t, []string{"simple.one.0"}, rollback.Definition.Events)
+		assert.Equal(t, generator.Rollback.Update, rollback.Definition.Update)
+		assert.Equal(t, ns, rollback.Definition.Namespace)
+	})
+	t.Run("Checkpoint", func(t *testing.T) {
+		qctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		defer func() { env.Queue = nil }()
+		env.Queue = queue.NewLocalLimitedSize(2, 128)
+		require.NoError(t, env.Queue.Start(qctx))
+		env.Network = mock.NewDependencyNetwork()
+
+		job := factory().(*simpleMigrationGenerator)
+		job.NS = ns
+		job.MigrationHelper = mh
+		job.SetID("simple")
+		job.CheckpointInterval = 2
+		job.checkpoint = &model.GeneratorCheckpoint{ID: checkpointID("simple"), Generator: "simple", LastID: "zero", Count: 1}
+
+		cursor := &mock.Cursor{
+			Results:      []interface{}{&doc{"one"}, &doc{"two"}, &doc{"three"}},
+			ShouldIter:   true,
+			MaxNextCalls: 4,
+		}
+
+		ids := job.generateJobs(qctx, env, cursor)
+		require.NoError(t, job.Error())
+		assert.Len(t, ids, 0)
+
+		// the jobs go to the queue and the dependency network
+		// rather than the generator
+		group := env.Network.Network()["simple"]
+		require.Len(t, group, 3)
+		assert.True(t, strings.HasSuffix(group[0], ".one.1"))
+		assert.True(t, strings.HasSuffix(group[2], ".three.3"))
+		assert.Len(t, job.Migrations, 0)
+		assert.Equal(t, 3, env.Queue.Stats(qctx).Total)
+		assert.Equal(t, "three", job.checkpoint.LastID)
+		assert.Equal(t, 4, job.checkpoint.Count)
+		assert.Equal(t, 3, job.checkpoint.Generated)
+	})
+	t.Run("DecodeError", func(t *testing.T) {
+		qctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		defer func() { env.Queue = nil }()
+		env.Queue = queue.NewLocalLimitedSize(2, 128)
+		require.NoError(t, env.Queue.Start(qctx))
+		env.Network = mock.NewDependencyNetwork()
+
+		job := factory().(*simpleMigrationGenerator)
+		job.NS = ns
+		job.MigrationHelper = mh
+		job.SetID("simple")
+		job.CheckpointInterval = 5
+		job.checkpoint = &model.GeneratorCheckpoint{ID: checkpointID("simple"), Generator: "simple", LastID: "zero", Count: 1}
+
+		cursor := &decodeFailingCursor{
+			Cursor: &mock.Cursor{
+				Results:      []interface{}{&doc{"one"}, &doc{"two"}, &doc{"three"}},
+				ShouldIter:   true,
+				MaxNextCalls: 4,
+			},
+			failAt: 3,
+		}
+
+		ids := job.generateJobs(qctx, env, cursor)
+		require.Error(t, job.Error())
+		assert.Contains(t, job.Error().Error(), "decoding document 3")
+		assert.Len(t, ids, 0)
+
+		// the checkpoint covers only the documents that were
+		// decoded.
+		assert.Len(t, env.Network.Network()["simple"], 2)
+		assert.Equal(t, "two", job.checkpoint.LastID)
+		assert.Equal(t, 3, job.checkpoint.Count)
+		assert.Equal(t, 2, job.checkpoint.Generated)
+	})
+	t.Run("Batches", func(t *testing.T) {
+		qctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		defer func() { env.Queue = nil }()
+		env.Queue = queue.NewLocalLimitedSize(2, 128)
+		require.NoError(t, env.Queue.Start(qctx))
+		env.Network = mock.NewDependencyNetwork()
+
+		job := factory().(*simpleMigrationGenerator)
+		job.NS = ns
+		job.MigrationHelper = mh
+		job.SetID("simple")
+		job.BatchSize = 2
+
+		cursor := &mock.Cursor{
+			Results:      []interface{}{&doc{"one"}, &doc{"two"}, &doc{"three"}},
+			ShouldIter:   true,
+			MaxNextCalls: 4,
+		}
+
+		ids := job.generateJobs(qctx, env, cursor)
+		require.NoError(t, job.Error())
+		assert.Len(t, ids, 0)
+		assert.Len(t, job.Migrations, 0)
+		assert.Nil(t, job.checkpoint)
+		assert.Equal(t, 3, env.Queue.Stats(qctx).Total)
+		assert.Len(t, env.Network.Network()["simple"], 3)
+	})
+	t.Run("BulkWrites", func(t *testing.T) {
+		env.Network = mock.NewDependencyNetwork()
+
+		job := factory().(*simpleMigrationGenerator)
+		job.NS = ns
+		job.MigrationHelper = mh
+		job.SetID("simple")
+		job.BulkWriteSize = 2
+		job.BulkWriteUnordered = true
+
+		cursor := &mock.Cursor{
+			Results:      []interface{}{&doc{"one"}, &doc{"two"}, &doc{"three"}},
+			ShouldIter:   true,
+			MaxNextCalls: 4,
+		}
+
+		ids := job.generateJobs(ctx, env, cursor)
+		require.NoError(t, job.Error())
+		assert.Equal(t, []string{"simple.batch.1", "simple.batch.2"}, ids)
+		assert.Len(t, job.Migrations, 0)
+		require.Len(t, job.Batches, 2)
+		assert.Equal(t, []interface{}{"one", "two"}, job.Batches[0].Definition.IDs)
+		assert.Equal(t, []interface{}{"three"}, job.Batches[1].Definition.IDs)
+		assert.True(t, job.Batches[0].Definition.Unordered)
+
+		count := 0
+		for range job.Jobs() {
+			count++
+		}
+		assert.Equal(t, 2, count)
+		assert.Len(t, job.Batches, 0)
+
+		job.Rollback = &model.RollbackOptions{Update: map[string]interface{}{"$unset": map[string]interface{}{"a": 1}}}
+		migrations := job.rollbackMigrations(env, []*model.MigrationMetadata{
+			{ID: "simple.batch.1", Migration: "simple", Targets: []interface{}{"one", "two"}, Completed: true},
+		})
+		require.Len(t, migrations, 1)
+		assert.Equal(t, []interface{}{"one", "two"}, migrations[0].(*rollbackMigrationJob).Definition.IDs)
+	})
+	t.Run("ApplicationOptions", func(t *testing.T) {
+		job := factory().(*simpleMigrationGenerator)
+		job.setApplicationOptions(model.ApplicationOptions{DryRun: true, Limit: 5})
+		assert.True(t, job.DryRun)
+		assert.Zero(t, job.Limit)
+
+		job.BatchSize = 10
+		job.setApplicationOptions(model.ApplicationOptions{Limit: 5})
+		assert.False(t, job.DryRun)
+		assert.Equal(t, 5, job.Limit)
+
+		job = factory().(*simpleMigrationGenerator)
+		job.CheckpointInterval = 10
+		job.setApplicationOptions(model.ApplicationOptions{Limit: 5})
+		assert.Equal(t, 5, job.Limit)
+	})
+}
+
+// decodeFailingCursor fails to decode the document at the position,
+// counted from 1.
+type decodeFailingCursor struct {
+	*mock.Cursor
+	failAt int
+}
+
+func (c *decodeFailingCursor) Decode(in interface{}) error {
+	if c.NextCallsCount == c.failAt {
+		return errors.New("bad document")
+	}
+
+	return c.Cursor.Decode(in)
 }
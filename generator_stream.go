@@ -12,8 +12,6 @@ import (
 	"github.com/mongodb/anser/model"
 	"github.com/mongodb/grip"
 	"github.com/mongodb/grip/message"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func init() {
@@ -22,6 +20,13 @@ func init() {
 }
 
 func NewStreamMigrationGenerator(e Environment, opts model.GeneratorOptions, opName string) Generator {
+	return NewStreamMigrationGeneratorWithParams(e, opts, opName, nil)
+}
+
+// NewStreamMigrationGeneratorWithParams constructs a stream migration
+// generator whose migrations pass the params to the processor, which
+// must implement client.ParameterizedProcessor to receive them.
+func NewStreamMigrationGeneratorWithParams(e Environment, opts model.GeneratorOptions, opName string, params map[string]string) Generator {
 	j := makeStreamGenerator()
 	j.SetID(opts.JobID)
 	j.SetDependency(generatorDependency(e, opts))
@@ -29,7 +34,17 @@ func NewStreamMigrationGenerator(e Environment, opts model.GeneratorOptions, opN
 	j.NS = opts.NS
 	j.Query = opts.Query
 	j.ProcessorName = opName
+	j.Params = params
 	j.Limit = opts.Limit
+	j.BatchSize = opts.BatchSize
+	j.CheckpointInterval = opts.CheckpointInterval
+	j.RateLimit = opts.RateLimit
+	j.Rollback = opts.Rollback
+	j.Canary = opts.Canary
+	j.Verify = opts.Verify
+	j.Backup = opts.Backup
+	j.Continuous = opts.Continuous
+	j.Snapshot = opts.Snapshot
 	return j
 }
 
@@ -46,18 +61,38 @@ func makeStreamGenerator() *streamMigrationGenerator {
 }
 
 type streamMigrationGenerator struct {
-	NS              model.Namespace        `bson:"ns" json:"ns" yaml:"ns"`
-	Query           map[string]interface{} `bson:"source_query" json:"source_query" yaml:"source_query"`
-	Limit           int                    `bson:"limit" json:"limit" yaml:"limit"`
-	ProcessorName   string                 `bson:"processor_name" json:"processor_name" yaml:"processor_name"`
-	Migrations      []*streamMigrationJob  `bson:"migrations" json:"migrations" yaml:"migrations"`
-	job.Base        `bson:"job_base" json:"job_base" yaml:"job_base"`
-	MigrationHelper `bson:"-" json:"-" yaml:"-"`
-	mu              sync.Mutex
+	NS                 model.Namespace          `bson:"ns" json:"ns" yaml:"ns"`
+	Query              map[string]interface{}   `bson:"source_query" json:"source_query" yaml:"source_query"`
+	Limit              int                      `bson:"limit" json:"limit" yaml:"limit"`
+	BatchSize          int                      `bson:"batch_size" json:"batch_size" yaml:"batch_size"`
+	CheckpointInterval int                      `bson:"checkpoint_interval" json:"checkpoint_interval" yaml:"checkpoint_interval"`
+	DryRun             bool                     `bson:"dry_run" json:"dry_run" yaml:"dry_run"`
+	RateLimit          *model.RateLimit         `bson:"rate_limit,omitempty" json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+	Rollback           *model.RollbackOptions   `bson:"rollback,omitempty" json:"rollback,omitempty" yaml:"rollback,omitempty"`
+	Canary             *model.Canary            `bson:"canary,omitempty" json:"canary,omitempty" yaml:"canary,omitempty"`
+	Verify             *model.VerifyOptions     `bson:"verify,omitempty" json:"verify,omitempty" yaml:"verify,omitempty"`
+	Backup             *model.BackupOptions     `bson:"backup,omitempty" json:"backup,omitempty" yaml:"backup,omitempty"`
+	Continuous         *model.ContinuousOptions `bson:"continuous,omitempty" json:"continuous,omitempty" yaml:"continuous,omitempty"`
+	Snapshot           *model.SnapshotOptions   `bson:"snapshot,omitempty" json:"snapshot,omitempty" yaml:"snapshot,omitempty"`
+	ProcessorName      string                   `bson:"processor_name" json:"processor_name" yaml:"processor_name"`
+	Params             map[string]string        `bson:"params,omitempty" json:"params,omitempty" yaml:"params,omitempty"`
+	Migrations         []*streamMigrationJob    `bson:"migrations" json:"migrations" yaml:"migrations"`
+	job.Base           `bson:"job_base" json:"job_base" yaml:"job_base"`
+	MigrationHelper    `bson:"-" json:"-" yaml:"-"`
+	mu                 sync.Mutex
+
+	// checkpoint is only set while the generator runs, when
+	// checkpointing is enabled.
+	checkpoint *model.GeneratorCheckpoint
+
+	// generated counts the jobs that the generator has produced,
+	// including those produced before its checkpoint.
+	generated int
 }
 
 func (j *streamMigrationGenerator) Run(ctx context.Context) {
-	defer j.FinishMigration(ctx, j.ID(), &j.Base)
+	meta := &model.MigrationMetadata{Migration: j.ID()}
+	defer finishMigration(ctx, j.MigrationHelper, meta, &j.Base)
 
 	env := j.Env()
 
@@ -73,79 +108,184 @@ func (j *streamMigrationGenerator) Run(ctx context.Context) {
 		return
 	}
 
-	findOpts := options.Find().SetProjection(bson.M{"_id": 1})
-	if j.Limit > 0 {
-		findOpts.SetLimit(int64(j.Limit))
+	if j.Snapshot != nil && j.Snapshot.TTLSeconds > 0 && !j.DryRun {
+		if err = ensureSnapshotIndex(ctx, env, j.ID()); err != nil {
+			j.AddError(err)
+			return
+		}
+	}
+
+	if j.CheckpointInterval > 0 && !j.DryRun {
+		j.checkpoint, err = resumeGenerator(ctx, env, j.ID())
+		if err != nil {
+			j.AddError(err)
+			return
+		}
+		j.generated = j.checkpoint.Generated
+		meta.Generated = j.generated
+
+		if j.Limit > 0 && j.checkpoint.Count >= j.Limit {
+			grip.Infof("migration generator %s already reached its limit of %d documents", j.ID(), j.Limit)
+			return
+		}
 	}
 
-	cursor, err := client.Database(j.NS.DB).Collection(j.NS.Collection).Find(ctx, j.Query, findOpts) // findOpts
+	coll := client.Database(j.NS.DB).Collection(j.NS.Collection)
+	stream, err := watchGenerator(ctx, env, j.ID(), coll, j.Query, j.Continuous, j.DryRun)
 	if err != nil {
 		j.AddError(err)
 		return
 	}
+	if stream != nil {
+		defer func() { grip.Warning(message.WrapError(stream.Close(ctx), "closing change stream")) }()
+	}
 
+	docs := generatorDocuments{
+		migration:  j.ID(),
+		ns:         j.NS,
+		query:      j.Query,
+		limit:      j.Limit,
+		checkpoint: j.checkpoint,
+		canary:     j.Canary,
+	}
+	if !j.DryRun {
+		docs.backup = j.Backup
+	}
+
+	cursor, manifest, err := findGeneratorDocuments(ctx, env, coll, docs)
+	if err != nil {
+		j.AddError(err)
+		return
+	}
+	meta.Backup = manifest
+
+	cursor = newContinuousCursor(env, j.ID(), cursor, stream, j.Continuous)
 	network.AddGroup(j.ID(), j.generateJobs(ctx, env, cursor))
+	j.AddError(cursor.Err())
+	meta.Generated = j.generated
 }
 
 func (j *streamMigrationGenerator) generateJobs(ctx context.Context, env Environment, iter client.Cursor) []string {
-	ids := []string{}
-	doc := struct {
-		ID interface{} `bson:"_id"`
-	}{}
-
 	j.mu.Lock()
 	defer j.mu.Unlock()
-	count := 0
 
-	for iter.Next(ctx) {
-		count++
-		if err := iter.Decode(&doc); err != nil {
-			grip.Error(message.WrapError(err, "decoding generator results"))
-			break
-		}
+	loop := &generatorLoop{
+		id:         j.ID(),
+		dryRun:     j.DryRun,
+		limit:      j.Limit,
+		batchSize:  generatorBatchSize(j.BatchSize, j.CheckpointInterval, j.DryRun, j.Continuous != nil),
+		interval:   j.CheckpointInterval,
+		checkpoint: j.checkpoint,
+		generated:  &j.generated,
+		holder:     j,
+		newJob: func(docID interface{}, position int) string {
+			m := NewStreamMigration(env, model.Stream{
+				ProcessorName: j.ProcessorName,
+				Migration:     j.ID(),
+				Namespace:     j.NS,
+				Query:         j.Query,
+				RateLimit:     j.RateLimit,
+				Params:        j.Params,
+				Snapshot:      j.Snapshot,
+			}).(*streamMigrationJob)
 
-		m := NewStreamMigration(env, model.Stream{
-			ProcessorName: j.ProcessorName,
-			Migration:     j.ID(),
-			Namespace:     j.NS,
-			Query:         j.Query,
-		}).(*streamMigrationJob)
-
-		m.SetDependency(env.NewDependencyManager(j.ID()))
-		m.SetID(fmt.Sprintf("%s.%v.%d", j.ID(), doc.ID, len(ids)))
-		ids = append(ids, m.ID())
-		j.Migrations = append(j.Migrations, m)
-
-		grip.Debug(message.Fields{
-			"ns":  j.NS,
-			"id":  m.ID(),
-			"doc": doc.ID,
-			"num": count,
-		})
-
-		if j.Limit > 0 && count >= j.Limit {
-			break
-		}
+			m.SetDependency(env.NewDependencyManager(j.ID()))
+			m.SetID(fmt.Sprintf("%s.%v.%d", j.ID(), docID, position))
+			j.Migrations = append(j.Migrations, m)
+
+			grip.Debug(message.Fields{
+				"ns":  j.NS,
+				"id":  m.ID(),
+				"doc": docID,
+				"num": position + 1,
+			})
+
+			return m.ID()
+		},
 	}
 
+	ids, err := loop.run(ctx, env, iter)
+	j.AddError(err)
 	return ids
 }
 
+// heldJobs returns all of the jobs that the generator holds.
+func (j *streamMigrationGenerator) heldJobs() []amboy.Job {
+	jobs := make([]amboy.Job, 0, len(j.Migrations))
+	for _, m := range j.Migrations {
+		jobs = append(jobs, m)
+	}
+
+	return jobs
+}
+
+func (j *streamMigrationGenerator) clearJobs() { j.Migrations = []*streamMigrationJob{} }
+
+// setApplicationOptions prevents the generator from adding jobs to
+// the queue during dry runs, and, because streaming generators add
+// their jobs to the queue directly, applies the application's limit to
+// the generator's own limit.
+func (j *streamMigrationGenerator) setApplicationOptions(opts model.ApplicationOptions) {
+	j.DryRun = opts.DryRun
+	if generatorBatchSize(j.BatchSize, j.CheckpointInterval, opts.DryRun, j.Continuous != nil) > 0 && opts.Limit > 0 && (j.Limit == 0 || opts.Limit < j.Limit) {
+		j.Limit = opts.Limit
+	}
+}
+
+func (j *streamMigrationGenerator) source() (model.Namespace, map[string]interface{}) {
+	return j.NS, j.Query
+}
+
+func (j *streamMigrationGenerator) canary() *model.Canary { return j.Canary }
+
+func (j *streamMigrationGenerator) verification() *model.Verification {
+	return generatorVerification(j.ID(), j.NS, j.Verify, j.Canary != nil || j.Limit > 0)
+}
+
 func (j *streamMigrationGenerator) Jobs() <-chan amboy.Job {
 	env := j.Env()
 
 	j.mu.Lock()
 	defer j.mu.Unlock()
 
-	jobs := make(chan amboy.Job, len(j.Migrations))
-	for _, job := range j.Migrations {
+	held := j.heldJobs()
+	jobs := make(chan amboy.Job, len(held))
+	for _, job := range held {
 		jobs <- job
 	}
 	close(jobs)
 
 	out, err := generator(env, j.ID(), jobs)
 	grip.Error(err)
-	grip.Infof("produced %d tasks for migration %s", len(j.Migrations), j.ID())
-	j.Migrations = []*streamMigrationJob{}
+	grip.Infof("produced %d tasks for migration %s", len(held), j.ID())
+	j.clearJobs()
 	return out
 }
+
+// rollbackMigrations produces a single rollback operation for a stream
+// migration, because document processors operate on all documents
+// matching the query rather than on a single document. The ID of the
+// operation includes the time, because a migration that runs again
+// after a rollback can be rolled back again.
+func (j *streamMigrationGenerator) rollbackMigrations(env Environment, events []*model.MigrationMetadata) []Migration {
+	if j.Rollback == nil || j.Rollback.Name == "" || len(events) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(events))
+	for _, meta := range events {
+		ids = append(ids, meta.ID)
+	}
+
+	m := NewRollbackMigration(env, model.Rollback{
+		ProcessorName: j.Rollback.Name,
+		Query:         j.Query,
+		Migration:     j.ID(),
+		Events:        ids,
+		Namespace:     j.NS,
+		Params:        j.Params,
+	}).(*rollbackMigrationJob)
+	m.SetID(rollbackJobID(j.ID()))
+
+	return []Migration{m}
+}
@@ -137,4 +137,27 @@ func TestStreamMigrationGenerator(t *testing.T) {
 			assert.Len(t, networkMap[job.ID()], 3)
 		})
 	})
+	t.Run("Rollback", func(t *testing.T) {
+		events := []*model.MigrationMetadata{
+			{ID: "stream.one.0", Migration: "stream", Completed: true},
+			{ID: "stream.two.1", Migration: "stream", Completed: true},
+		}
+
+		generator := NewStreamMigrationGenerator(env, model.GeneratorOptions{
+			JobID:    "stream",
+			NS:       ns,
+			Query:    map[string]interface{}{"a": 1},
+			Rollback: &model.RollbackOptions{Name: "inverse"},
+		}, "forward").(*streamMigrationGenerator)
+		assert.Nil(t, generator.rollbackMigrations(env, nil))
+
+		migrations := generator.rollbackMigrations(env, events)
+		require.Len(t, migrations, 1)
+		rollback := migrations[0].(*rollbackMigrationJob)
+		assert.True(t, strings.HasPrefix(rollback.ID(), "stream.rollback."))
+		assert.NotEqual(t, rollback.ID(), generator.rollbackMigrations(env, events)[0].ID())
+		assert.Equal(t, "inverse", rollback.Definition.ProcessorName)
+		assert.Equal(t, generator.Query, rollback.Definition.Query)
+		assert.Equal(t, []string{"stream.one.0", "stream.two.1"}, rollback.Definition.Events)
+	})
 }
@@ -0,0 +1,267 @@
+package anser
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/anser/model"
+	"github.com/pkg/errors"
+)
+
+// GraphFormat names a format for rendering a dependency network.
+type GraphFormat string
+
+const (
+	// GraphFormatDOT renders the network in the Graphviz DOT
+	// language.
+	GraphFormatDOT GraphFormat = "dot"
+	// GraphFormatMermaid renders the network as a Mermaid
+	// flowchart.
+	GraphFormatMermaid GraphFormat = "mermaid"
+)
+
+// graphStateBlocked annotates migrations that have not started
+// because one of their dependencies has not completed.
+const graphStateBlocked = "blocked"
+
+// graphStateUndefined annotates dependencies that are not defined in
+// the network.
+const graphStateUndefined = "undefined"
+
+// Graph renders the application's dependency network, including the
+// migration operations that each generator produced, with each
+// migration annotated with its status from the metadata collection.
+func (a *Application) Graph(ctx context.Context, format GraphFormat) (string, error) {
+	if !a.hasSetup {
+		return "", errors.New("cannot render the graph of an application that has not been set up")
+	}
+
+	network, err := a.env.GetDependencyNetwork()
+	if err != nil {
+		return "", errors.Wrap(err, "getting dependency network")
+	}
+
+	statuses, err := a.Status(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "getting migration status")
+	}
+
+	return RenderDependencyNetwork(network, statuses, format)
+}
+
+// RenderDependencyNetwork renders the dependency network in the
+// format. Edges point from each migration to the migrations that
+// depend on it, and the IDs in each node's group (the migration
+// operations that a generator produced) are rendered in a cluster
+// attached to the node. When statuses are given, nodes are annotated
+// and colored by the state of the corresponding migration; migrations
+// that have not started because a dependency has not completed are
+// marked as blocked.
+func RenderDependencyNetwork(network model.DependencyNetworker, statuses []model.MigrationStatus, format GraphFormat) (string, error) {
+	g := newDependencyGraph(network, statuses)
+
+	switch format {
+	case GraphFormatDOT:
+		return g.dot(), nil
+	case GraphFormatMermaid:
+		return g.mermaid(), nil
+	default:
+		return "", errors.Errorf("unknown graph format '%s'", format)
+	}
+}
+
+type dependencyGraph struct {
+	nodes      []string
+	edges      map[string][]string
+	groups     map[string][]string
+	states     map[string]string
+	annotated  bool
+	identifier map[string]string
+}
+
+func newDependencyGraph(network model.DependencyNetworker, statuses []model.MigrationStatus) *dependencyGraph {
+	g := &dependencyGraph{
+		edges:      map[string][]string{},
+		groups:     map[string][]string{},
+		states:     map[string]string{},
+		annotated:  statuses != nil,
+		identifier: map[string]string{},
+	}
+
+	for _, status := range statuses {
+		g.states[status.Migration] = string(status.State())
+	}
+
+	for node, edges := range network.Network() {
+		g.nodes = append(g.nodes, node)
+		g.edges[node] = append([]string{}, edges...)
+		sort.Strings(g.edges[node])
+
+		if group := network.GetGroup(node); len(group) > 0 {
+			group = append([]string{}, group...)
+			sort.Strings(group)
+			g.groups[node] = group
+		}
+	}
+	for _, node := range g.nodes {
+		for _, dep := range g.edges[node] {
+			if _, ok := g.edges[dep]; !ok {
+				g.edges[dep] = nil
+				g.nodes = append(g.nodes, dep)
+				g.states[dep] = graphStateUndefined
+			}
+		}
+	}
+	sort.Strings(g.nodes)
+
+	for idx, node := range g.nodes {
+		g.identifier[node] = fmt.Sprintf("n%d", idx)
+	}
+
+	if g.annotated {
+		g.markBlocked()
+	}
+
+	return g
+}
+
+// markBlocked marks the pending migrations with a dependency that has
+// not completed as blocked.
+func (g *dependencyGraph) markBlocked() {
+	for _, node := range g.nodes {
+		if state, ok := g.states[node]; ok && state != string(model.MigrationStatePending) {
+			continue
+		}
+		g.states[node] = string(model.MigrationStatePending)
+
+		for _, dep := range g.edges[node] {
+			if g.states[dep] != string(model.MigrationStateCompleted) {
+				g.states[node] = graphStateBlocked
+				break
+			}
+		}
+	}
+}
+
+func (g *dependencyGraph) label(node string) string {
+	if state, ok := g.states[node]; ok && (g.annotated || state == graphStateUndefined) {
+		return fmt.Sprintf("%s\n(%s)", node, state)
+	}
+
+	return node
+}
+
+var dotColors = map[string]string{
+	string(model.MigrationStatePending):    "white",
+	string(model.MigrationStateGenerating): "lightblue",
+	string(model.MigrationStateRunning):    "lightblue",
+	string(model.MigrationStateCompleted):  "palegreen",
+	string(model.MigrationStateFailed):     "salmon",
+	string(model.MigrationStateRolledBack): "lightgrey",
+	graphStateBlocked:                      "orange",
+	graphStateUndefined:                    "red",
+}
+
+func dotQuote(in string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(in) + `"`
+}
+
+func (g *dependencyGraph) dot() string {
+	buf := &strings.Builder{}
+	buf.WriteString("digraph anser {\n")
+	buf.WriteString("\tcompound=true;\n")
+	buf.WriteString("\tnode [shape=box, style=filled, fillcolor=white];\n")
+
+	for _, node := range g.nodes {
+		attrs := "label=" + dotQuote(g.label(node))
+		if color, ok := dotColors[g.states[node]]; ok {
+			attrs += ", fillcolor=" + color
+		}
+		fmt.Fprintf(buf, "\t%s [%s];\n", g.identifier[node], attrs)
+	}
+
+	for _, node := range g.nodes {
+		group := g.groups[node]
+		if len(group) == 0 {
+			continue
+		}
+
+		id := g.identifier[node]
+		fmt.Fprintf(buf, "\tsubgraph cluster_%s {\n", id)
+		fmt.Fprintf(buf, "\t\tlabel=%s;\n", dotQuote(node+" operations"))
+		for idx, op := range group {
+			fmt.Fprintf(buf, "\t\t%s_%d [label=%s, fillcolor=white];\n", id, idx, dotQuote(op))
+		}
+		buf.WriteString("\t}\n")
+		fmt.Fprintf(buf, "\t%s -> %s_0 [lhead=cluster_%s, style=dashed];\n", id, id, id)
+	}
+
+	for _, node := range g.nodes {
+		for _, dep := range g.edges[node] {
+			fmt.Fprintf(buf, "\t%s -> %s;\n", g.identifier[dep], g.identifier[node])
+		}
+	}
+
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+func mermaidQuote(in string) string {
+	return `"` + strings.NewReplacer(`"`, "#quot;", "\n", "<br/>").Replace(in) + `"`
+}
+
+func (g *dependencyGraph) mermaid() string {
+	buf := &strings.Builder{}
+	buf.WriteString("flowchart LR\n")
+
+	for _, node := range g.nodes {
+		fmt.Fprintf(buf, "\t%s[%s]\n", g.identifier[node], mermaidQuote(g.label(node)))
+	}
+
+	for _, node := range g.nodes {
+		group := g.groups[node]
+		if len(group) == 0 {
+			continue
+		}
+
+		id := g.identifier[node]
+		fmt.Fprintf(buf, "\tsubgraph %s_ops[%s]\n", id, mermaidQuote(node+" operations"))
+		for idx, op := range group {
+			fmt.Fprintf(buf, "\t\t%s_%d[%s]\n", id, idx, mermaidQuote(op))
+		}
+		buf.WriteString("\tend\n")
+		fmt.Fprintf(buf, "\t%s -.-> %s_ops\n", id, id)
+	}
+
+	for _, node := range g.nodes {
+		for _, dep := range g.edges[node] {
+			fmt.Fprintf(buf, "\t%s --> %s\n", g.identifier[dep], g.identifier[node])
+		}
+	}
+
+	states := []string{}
+	for state := range dotColors {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	for _, state := range states {
+		nodes := []string{}
+		for _, node := range g.nodes {
+			if g.states[node] == state {
+				nodes = append(nodes, g.identifier[node])
+			}
+		}
+		if len(nodes) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(buf, "\tclassDef %s fill:%s\n", mermaidClass(state), dotColors[state])
+		fmt.Fprintf(buf, "\tclass %s %s\n", strings.Join(nodes, ","), mermaidClass(state))
+	}
+
+	return buf.String()
+}
+
+func mermaidClass(state string) string { return strings.ReplaceAll(state, "-", "_") }
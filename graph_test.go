@@ -0,0 +1,93 @@
+package anser
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderDependencyNetwork(t *testing.T) {
+	network := newDependencyNetwork()
+	network.Add("first", nil)
+	network.Add("second", []string{"first"})
+	network.Add("third", []string{"second", "missing"})
+	network.AddGroup("first", []string{"first.1", "first.0"})
+
+	statuses := []model.MigrationStatus{
+		{Migration: "first", GeneratorCompleted: true, Generated: 2, Completed: 2},
+		{Migration: "second"},
+		{Migration: "third"},
+	}
+
+	t.Run("DOT", func(t *testing.T) {
+		out, err := RenderDependencyNetwork(network, statuses, GraphFormatDOT)
+		require.NoError(t, err)
+
+		assert.Contains(t, out, "digraph anser {")
+		assert.Contains(t, out, `n0 [label="first\n(completed)", fillcolor=palegreen];`)
+		assert.Contains(t, out, `n1 [label="missing\n(undefined)", fillcolor=red];`)
+		assert.Contains(t, out, `n2 [label="second\n(pending)", fillcolor=white];`)
+		assert.Contains(t, out, `n3 [label="third\n(blocked)", fillcolor=orange];`)
+		assert.Contains(t, out, "subgraph cluster_n0 {")
+		assert.Contains(t, out, `n0_0 [label="first.0", fillcolor=white];`)
+		assert.Contains(t, out, `n0_1 [label="first.1", fillcolor=white];`)
+		assert.Contains(t, out, "n0 -> n0_0 [lhead=cluster_n0, style=dashed];")
+		assert.Contains(t, out, "n0 -> n2;")
+		assert.Contains(t, out, "n1 -> n3;")
+		assert.Contains(t, out, "n2 -> n3;")
+	})
+	t.Run("Mermaid", func(t *testing.T) {
+		out, err := RenderDependencyNetwork(network, statuses, GraphFormatMermaid)
+		require.NoError(t, err)
+
+		assert.Contains(t, out, "flowchart LR")
+		assert.Contains(t, out, `n0["first<br/>(completed)"]`)
+		assert.Contains(t, out, `subgraph n0_ops["first operations"]`)
+		assert.Contains(t, out, `n0_1["first.1"]`)
+		assert.Contains(t, out, "n0 -.-> n0_ops")
+		assert.Contains(t, out, "n2 --> n3")
+		assert.Contains(t, out, "classDef blocked fill:orange")
+		assert.Contains(t, out, "class n3 blocked")
+	})
+	t.Run("WithoutStatus", func(t *testing.T) {
+		out, err := RenderDependencyNetwork(network, nil, GraphFormatDOT)
+		require.NoError(t, err)
+		assert.Contains(t, out, `n2 [label="second"];`)
+		assert.Contains(t, out, `n1 [label="missing\n(undefined)", fillcolor=red];`)
+		assert.NotContains(t, out, "pending")
+	})
+	t.Run("Quoting", func(t *testing.T) {
+		quoted := newDependencyNetwork()
+		quoted.Add(`say "hi"`, nil)
+
+		out, err := RenderDependencyNetwork(quoted, nil, GraphFormatDOT)
+		require.NoError(t, err)
+		assert.Contains(t, out, `label="say \"hi\""`)
+
+		out, err = RenderDependencyNetwork(quoted, nil, GraphFormatMermaid)
+		require.NoError(t, err)
+		assert.Contains(t, out, `n0["say #quot;hi#quot;"]`)
+	})
+	t.Run("UnknownFormat", func(t *testing.T) {
+		_, err := RenderDependencyNetwork(network, nil, "svg")
+		assert.Error(t, err)
+	})
+	t.Run("Application", func(t *testing.T) {
+		ctx := context.Background()
+		env := mock.NewEnvironment()
+		app := &Application{}
+
+		_, err := app.Graph(ctx, GraphFormatDOT)
+		assert.Error(t, err)
+
+		require.NoError(t, app.Setup(env))
+		env.Network.Add("first", nil)
+		out, err := app.Graph(ctx, GraphFormatMermaid)
+		require.NoError(t, err)
+		assert.Contains(t, out, `n0["first<br/>(pending)"]`)
+	})
+}
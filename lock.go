@@ -0,0 +1,209 @@
+package anser
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	lockCollection  = "migrations.lock"
+	defaultLockName = "anser"
+	defaultLockTTL  = time.Minute
+)
+
+// applicationLock is a lease on a document in the lock collection of
+// the metadata database, which is held by one application at a time.
+// The lease expires if the holder does not renew it within the TTL.
+type applicationLock struct {
+	coll  client.Collection
+	name  string
+	owner string
+	ttl   time.Duration
+}
+
+func newApplicationLock(env Environment, opts model.LockOptions) (*applicationLock, error) {
+	if !opts.IsValid() {
+		return nil, errors.New("invalid lock options")
+	}
+
+	cl, err := env.GetClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting client")
+	}
+
+	hostname, _ := os.Hostname()
+	l := &applicationLock{
+		coll:  cl.Database(env.MetadataNamespace().DB).Collection(lockCollection),
+		name:  opts.Name,
+		owner: fmt.Sprintf("%s:%d:%s", hostname, os.Getpid(), primitive.NewObjectID().Hex()),
+		ttl:   time.Duration(opts.TTLSeconds) * time.Second,
+	}
+	if l.name == "" {
+		l.name = defaultLockName
+	}
+	if l.ttl == 0 {
+		l.ttl = defaultLockTTL
+	}
+
+	return l, nil
+}
+
+// acquire takes the lease, waiting up to the wait duration for
+// another application to release it.
+func (l *applicationLock) acquire(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	deadline := time.Now().Add(wait)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "waiting for lock")
+		case <-timer.C:
+			acquired, err := l.tryAcquire(ctx)
+			if err != nil {
+				return errors.Wrapf(err, "acquiring lock '%s'", l.name)
+			}
+			if acquired {
+				return nil
+			}
+
+			if !time.Now().Before(deadline) {
+				return errors.Errorf("lock '%s' is held by another application", l.name)
+			}
+			timer.Reset(l.retryInterval())
+		}
+	}
+}
+
+// tryAcquire takes the lease if it is not held or has expired. If
+// another application holds the lease, the filter does not match and
+// the upsert fails because the lock document already exists.
+func (l *applicationLock) tryAcquire(ctx context.Context) (bool, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id": l.name,
+		"$or": bson.A{
+			bson.M{"owner": l.owner},
+			bson.M{"expires_at": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		"owner":       l.owner,
+		"acquired_at": now,
+		"expires_at":  now.Add(l.ttl),
+	}}
+
+	res, err := l.coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return res.MatchedCount > 0 || res.UpsertedCount > 0, nil
+}
+
+// renew extends the lease, and returns an error if the application no
+// longer holds it.
+func (l *applicationLock) renew(ctx context.Context) error {
+	res, err := l.coll.UpdateOne(ctx,
+		bson.M{"_id": l.name, "owner": l.owner},
+		bson.M{"$set": bson.M{"expires_at": time.Now().Add(l.ttl)}})
+	if err != nil {
+		return errors.Wrapf(err, "renewing lock '%s'", l.name)
+	}
+	if res.MatchedCount == 0 {
+		return errors.Errorf("lost lock '%s' to another application", l.name)
+	}
+
+	return nil
+}
+
+// heartbeat renews the lease until the context is canceled. If the
+// application loses the lease, heartbeat calls cancel to stop the
+// application.
+func (l *applicationLock) heartbeat(ctx context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.renew(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				grip.Error(message.WrapError(err, message.Fields{
+					"message": "stopping application",
+					"lock":    l.name,
+					"owner":   l.owner,
+				}))
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// release expires the lease if the application still holds it.
+func (l *applicationLock) release(ctx context.Context) error {
+	_, err := l.coll.UpdateOne(ctx,
+		bson.M{"_id": l.name, "owner": l.owner},
+		bson.M{"$set": bson.M{"expires_at": time.Time{}}})
+
+	return errors.Wrapf(err, "releasing lock '%s'", l.name)
+}
+
+func (l *applicationLock) retryInterval() time.Duration {
+	if interval := l.ttl / 3; interval < time.Second {
+		return interval
+	}
+
+	return time.Second
+}
+
+// lock acquires the application's lease, if the application uses a
+// lock, and returns a context that is canceled if the application
+// loses the lease and a function that releases the lease.
+func (a *Application) lock(ctx context.Context) (context.Context, func(), error) {
+	if a.Options.Lock == nil {
+		return ctx, func() {}, nil
+	}
+
+	l, err := newApplicationLock(a.env, *a.Options.Lock)
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	if err = l.acquire(ctx, time.Duration(a.Options.Lock.WaitSeconds)*time.Second); err != nil {
+		return ctx, nil, err
+	}
+
+	lctx, cancel := context.WithCancel(ctx)
+	go l.heartbeat(lctx, cancel)
+
+	return lctx, func() {
+		cancel()
+		grip.Warning(message.WrapError(l.release(context.Background()), message.Fields{
+			"message": "could not release lock",
+			"lock":    l.name,
+		}))
+	}, nil
+}
@@ -0,0 +1,108 @@
+package anser
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestApplicationLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	held := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "duplicate key"}}}
+
+	setup := func(t *testing.T, coll *mock.Collection) *mock.Environment {
+		env := mock.NewEnvironment()
+		env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+		env.Client = mock.NewClient()
+		env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{lockCollection: coll}}
+		return env
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		coll := &mock.Collection{CollName: lockCollection}
+		l, err := newApplicationLock(setup(t, coll), model.LockOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, client.Collection(coll), l.coll)
+		assert.Equal(t, defaultLockName, l.name)
+		assert.Equal(t, defaultLockTTL, l.ttl)
+		assert.NotEmpty(t, l.owner)
+
+		other, err := newApplicationLock(setup(t, coll), model.LockOptions{Name: "deploy", TTLSeconds: 10})
+		require.NoError(t, err)
+		assert.Equal(t, "deploy", other.name)
+		assert.Equal(t, 10*time.Second, other.ttl)
+		assert.NotEqual(t, l.owner, other.owner)
+	})
+	t.Run("InvalidOptions", func(t *testing.T) {
+		_, err := newApplicationLock(setup(t, &mock.Collection{}), model.LockOptions{TTLSeconds: -1})
+		assert.Error(t, err)
+	})
+	t.Run("Acquire", func(t *testing.T) {
+		coll := &mock.Collection{UpdateResult: client.UpdateResult{UpsertedCount: 1}}
+		l, err := newApplicationLock(setup(t, coll), model.LockOptions{})
+		require.NoError(t, err)
+		require.NoError(t, l.acquire(ctx, 0))
+		assert.Len(t, coll.Updates, 1)
+
+		require.NoError(t, l.release(ctx))
+		assert.Len(t, coll.Updates, 2)
+	})
+	t.Run("HeldFailsFast", func(t *testing.T) {
+		coll := &mock.Collection{UpdateError: held}
+		l, err := newApplicationLock(setup(t, coll), model.LockOptions{})
+		require.NoError(t, err)
+
+		err = l.acquire(ctx, 0)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "held by another application")
+		assert.Len(t, coll.Updates, 1)
+	})
+	t.Run("HeldWaits", func(t *testing.T) {
+		coll := &mock.Collection{UpdateError: held}
+		l, err := newApplicationLock(setup(t, coll), model.LockOptions{})
+		require.NoError(t, err)
+		l.ttl = 30 * time.Millisecond
+
+		start := time.Now()
+		require.Error(t, l.acquire(ctx, 50*time.Millisecond))
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+		assert.True(t, len(coll.Updates) > 1)
+	})
+	t.Run("LostLease", func(t *testing.T) {
+		coll := &mock.Collection{}
+		l, err := newApplicationLock(setup(t, coll), model.LockOptions{})
+		require.NoError(t, err)
+		l.ttl = 30 * time.Millisecond
+
+		err = l.renew(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "lost lock")
+
+		hctx, hcancel := context.WithCancel(ctx)
+		defer hcancel()
+		l.heartbeat(hctx, hcancel)
+		assert.Error(t, hctx.Err())
+	})
+	t.Run("Application", func(t *testing.T) {
+		env := setup(t, &mock.Collection{UpdateError: held})
+		app := &Application{Options: model.ApplicationOptions{Lock: &model.LockOptions{}}}
+		require.NoError(t, app.Setup(env))
+
+		err := app.Run(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "held by another application")
+
+		err = app.Rollback(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "held by another application")
+	})
+}
@@ -13,6 +13,8 @@ requirement of running migrations as amboy Jobs, these migrations
 support round-trippable BSON serialization and thus distributed
 queues.
 
+The README describes the features below in more detail.
+
 Simple
 
 Use simple migrations to rename a field in a document or change the
@@ -20,6 +22,16 @@ structure of a document using MongoDB queries. Prefer these operations
 to running actual queries for the rate-limiting properties of the
 Anser executor.
 
+Rate Limits
+
+All migrations honor the RateLimit in their generator's options.
+The limits apply within each process, and waiting operations hold
+queue workers; see model.RateLimit.
+
+Rate limits may also specify Backpressure, which pauses the
+migration's operations while the cluster is under stress, as
+reported by the environment's LoadSource.
+
 Manual
 
 Use manual migrations when you need to perform a migration operation
@@ -33,6 +45,31 @@ Use stream migrations for processing using application logic, an
 iterator of documents. This is similar to the manual migration but
 allows reduce-like operations, or even destructive operations.
 
+Verification
+
+Generators with verification options check their migrated documents
+after their operations complete, and migrations that depend on them
+do not run unless the verification passes.
+
+Snapshots
+
+Manual and stream migrations with snapshot options save a copy of
+each document before they change it, which RestoreSnapshots puts
+back.
+
+Backups
+
+Generators with backup options back up the documents that they will
+migrate before they produce any operations, and produce their
+operations from the backup.
+
+Continuous Migrations
+
+Generators with continuous options keep producing operations for the
+documents that change to match their query until they reach their
+cutover or StopContinuousMigration stops them. Their updates must be
+idempotent, since each change produces another operation.
+
 db.Processor
 
 The db.Processor is an interface that you can implement for
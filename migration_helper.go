@@ -24,10 +24,33 @@ type MigrationHelper interface {
 	// The migration helper provides a model/interface for
 	// interacting with the database to check the state of a
 	// migration operation, helpful in dependency approval.
+	// PendingMigrationOperations counts the documents in the
+	// namespace that match the query, and returns -1 if it cannot
+	// count them.
 	PendingMigrationOperations(context.Context, model.Namespace, map[string]interface{}) int
 	GetMigrationEvents(context.Context, map[string]interface{}) MigrationMetadataIterator
 }
 
+// metadataFinisher is implemented by migration helpers that can save
+// metadata that the caller provides when a migration job finishes,
+// after populating its ID and status from the job. Callers should set
+// the Migration and, if applicable, Target fields.
+type metadataFinisher interface {
+	FinishMigrationWithMetadata(context.Context, *model.MigrationMetadata, *job.Base)
+}
+
+// finishMigration saves the metadata with the helper if the helper
+// supports it, and otherwise finishes the named migration with the
+// helper's FinishMigration.
+func finishMigration(ctx context.Context, mh MigrationHelper, meta *model.MigrationMetadata, j *job.Base) {
+	if f, ok := mh.(metadataFinisher); ok {
+		f.FinishMigrationWithMetadata(ctx, meta, j)
+		return
+	}
+
+	mh.FinishMigration(ctx, meta.Migration, j)
+}
+
 // MigrationMetadataiterator wraps a query response for data about a migration.
 type MigrationMetadataIterator interface {
 	Next(context.Context) bool
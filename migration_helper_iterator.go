@@ -3,6 +3,7 @@ package anser
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/mongodb/amboy/job"
 	"github.com/mongodb/anser/client"
@@ -78,20 +79,25 @@ func (m *migrationBase) SaveMigrationEvent(ctx context.Context, mm *model.Migrat
 }
 
 func (m *migrationBase) FinishMigration(ctx context.Context, name string, j *job.Base) {
+	m.FinishMigrationWithMetadata(ctx, &model.MigrationMetadata{Migration: name}, j)
+}
+
+func (m *migrationBase) FinishMigrationWithMetadata(ctx context.Context, meta *model.MigrationMetadata, j *job.Base) {
 	j.MarkComplete()
-	meta := model.MigrationMetadata{
-		ID:        j.ID(),
-		Migration: name,
-		HasErrors: j.HasErrors(),
-		Completed: true,
-	}
-	err := m.SaveMigrationEvent(ctx, &meta)
+	meta.ID = j.ID()
+	meta.HasErrors = j.HasErrors()
+	meta.Errors = j.Status().Errors
+	meta.Completed = true
+	meta.StartedAt = j.TimeInfo().Start
+	meta.CompletedAt = time.Now()
+
+	err := m.SaveMigrationEvent(ctx, meta)
 	if err != nil {
 		j.AddError(err)
 		grip.Warning(message.Fields{
 			"message": "encountered problem saving migration event",
 			"id":      j.ID(),
-			"name":    name,
+			"name":    meta.Migration,
 			"error":   err.Error(),
 			"type":    "client",
 		})
@@ -101,13 +107,31 @@ func (m *migrationBase) FinishMigration(ctx context.Context, name string, j *job
 	grip.Debug(message.Fields{
 		"message":  "completed migration",
 		"id":       j.ID(),
-		"name":     name,
+		"name":     meta.Migration,
 		"metadata": meta,
 	})
 }
 
 func (m *migrationBase) PendingMigrationOperations(ctx context.Context, ns model.Namespace, q map[string]interface{}) int {
-	return 0
+	env := m.Env()
+
+	client, err := env.GetClient()
+	if err != nil {
+		grip.Error(errors.WithStack(err))
+		return -1
+	}
+
+	if q == nil {
+		q = map[string]interface{}{}
+	}
+
+	num, err := client.Database(ns.DB).Collection(ns.Collection).CountDocuments(ctx, q)
+	if err != nil {
+		grip.Warning(errors.WithStack(err))
+		return -1
+	}
+
+	return int(num)
 }
 
 func (m *migrationBase) GetMigrationEvents(ctx context.Context, q map[string]interface{}) MigrationMetadataIterator {
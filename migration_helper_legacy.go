@@ -3,6 +3,7 @@ package anser
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/mongodb/amboy/job"
 	"github.com/mongodb/anser/db"
@@ -70,20 +71,25 @@ func (e *legacyMigrationBase) SaveMigrationEvent(ctx context.Context, m *model.M
 }
 
 func (e *legacyMigrationBase) FinishMigration(ctx context.Context, name string, j *job.Base) {
+	e.FinishMigrationWithMetadata(ctx, &model.MigrationMetadata{Migration: name}, j)
+}
+
+func (e *legacyMigrationBase) FinishMigrationWithMetadata(ctx context.Context, meta *model.MigrationMetadata, j *job.Base) {
 	j.MarkComplete()
-	meta := model.MigrationMetadata{
-		ID:        j.ID(),
-		Migration: name,
-		HasErrors: j.HasErrors(),
-		Completed: true,
-	}
-	err := e.SaveMigrationEvent(ctx, &meta)
+	meta.ID = j.ID()
+	meta.HasErrors = j.HasErrors()
+	meta.Errors = j.Status().Errors
+	meta.Completed = true
+	meta.StartedAt = j.TimeInfo().Start
+	meta.CompletedAt = time.Now()
+
+	err := e.SaveMigrationEvent(ctx, meta)
 	if err != nil {
 		j.AddError(err)
 		grip.Warning(message.Fields{
 			"message": "encountered problem saving migration event",
 			"id":      j.ID(),
-			"name":    name,
+			"name":    meta.Migration,
 			"error":   err.Error(),
 			"type":    "legacy",
 		})
@@ -93,7 +99,7 @@ func (e *legacyMigrationBase) FinishMigration(ctx context.Context, name string,
 	grip.Debug(message.Fields{
 		"message":  "completed migration",
 		"id":       j.ID(),
-		"name":     name,
+		"name":     meta.Migration,
 		"metadata": meta,
 	})
 }
@@ -2,6 +2,7 @@ package anser
 
 import (
 	"context"
+	"time"
 
 	"github.com/mongodb/amboy/job"
 	"github.com/mongodb/anser/mock"
@@ -25,14 +26,19 @@ type MigrationHelperMock struct {
 func (m *MigrationHelperMock) Env() Environment { return m.Environment }
 
 func (m *MigrationHelperMock) FinishMigration(ctx context.Context, name string, j *job.Base) {
+	m.FinishMigrationWithMetadata(ctx, &model.MigrationMetadata{Migration: name}, j)
+}
+
+func (m *MigrationHelperMock) FinishMigrationWithMetadata(ctx context.Context, meta *model.MigrationMetadata, j *job.Base) {
 	j.MarkComplete()
-	meta := model.MigrationMetadata{
-		ID:        j.ID(),
-		Migration: name,
-		HasErrors: j.HasErrors(),
-		Completed: true,
-	}
-	err := m.SaveMigrationEvent(ctx, &meta)
+	meta.ID = j.ID()
+	meta.HasErrors = j.HasErrors()
+	meta.Errors = j.Status().Errors
+	meta.Completed = true
+	meta.StartedAt = j.TimeInfo().Start
+	meta.CompletedAt = time.Now()
+
+	err := m.SaveMigrationEvent(ctx, meta)
 	if err != nil {
 		j.AddError(err)
 		grip.Warning(message.WrapError(err, "saving migration metadata"))
@@ -87,6 +87,47 @@ func (s *MigrationHelperSuite) TestFinishMigrationIsTracked() {
 	s.True(status.Completed)
 }
 
+func (s *MigrationHelperSuite) TestFinishMigrationWithMetadataIsTracked() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := &job.Base{}
+
+	meta := &model.MigrationMetadata{Migration: "foo"}
+	base.AddError(errors.New("problem"))
+	s.mh.FinishMigrationWithMetadata(ctx, meta, base)
+
+	s.True(base.Status().Completed)
+	s.True(meta.Completed)
+	s.True(meta.HasErrors)
+	s.Equal([]string{"problem"}, meta.Errors)
+	s.False(meta.CompletedAt.IsZero())
+}
+
+type namedMigrationHelper struct {
+	MigrationHelper
+	finished []string
+}
+
+func (m *namedMigrationHelper) FinishMigration(ctx context.Context, name string, j *job.Base) {
+	m.finished = append(m.finished, name)
+}
+
+func (s *MigrationHelperSuite) TestFinishMigrationUsesHelperWithoutMetadata() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mh := &namedMigrationHelper{}
+	finishMigration(ctx, mh, &model.MigrationMetadata{Migration: "foo", Target: "one"}, &job.Base{})
+	s.Equal([]string{"foo"}, mh.finished)
+
+	base := &job.Base{}
+	meta := &model.MigrationMetadata{Migration: "foo", Target: "one"}
+	finishMigration(ctx, s.mh, meta, base)
+	s.True(meta.Completed)
+	s.True(base.Status().Completed)
+}
+
 func (s *MigrationHelperSuite) TestGetMigrationEvents() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -126,6 +167,24 @@ func (s *MigrationHelperSuite) TestPendingMigrationsWithoutConfiguration() {
 	s.Zero(s.mh.PendingMigrationOperations(ctx, model.Namespace{DB: "dbname", Collection: "collname"}, map[string]interface{}{}))
 }
 
+func (s *MigrationHelperSuite) TestPendingMigrationsCountsMatchingDocuments() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ns := model.Namespace{DB: "dbname", Collection: "collname"}
+	s.env.Client = mock.NewClient()
+	s.env.Client.Databases["dbname"] = &mock.Database{DBName: "dbname", Collections: map[string]*mock.Collection{
+		"collname": {CountResult: 42},
+	}}
+	s.Equal(42, s.mh.PendingMigrationOperations(ctx, ns, nil))
+
+	s.env.Client.Databases["dbname"].Collections["collname"].CountError = errors.New("problem")
+	s.Equal(-1, s.mh.PendingMigrationOperations(ctx, ns, nil))
+
+	s.env.ClientError = errors.New("no client")
+	s.Equal(-1, s.mh.PendingMigrationOperations(ctx, ns, nil))
+}
+
 func TestDefaultEnvironmentAndMigrationHelperState(t *testing.T) {
 	assert := assert.New(t)
 	env := &envState{}
@@ -55,20 +55,33 @@ func (j *manualMigrationJob) Run(ctx context.Context) {
 		"name":      j.Definition.OperationName,
 	})
 
-	defer j.FinishMigration(ctx, j.Definition.Migration, &j.Base)
+	defer finishMigration(ctx, j.MigrationHelper, &model.MigrationMetadata{Migration: j.Definition.Migration, Target: j.Definition.ID}, &j.Base)
 	env := j.Env()
 
-	operation, ok := env.GetManualMigrationOperation(j.Definition.OperationName)
+	operation, ok := getParameterizedMigrationOperation(env, j.Definition.OperationName)
 	if !ok {
 		j.AddError(errors.Errorf("could not find migration named '%s'", j.Definition.OperationName))
 		return
 	}
 
+	limiter := getMigrationLimiter(env, j.Definition.Migration, j.Definition.RateLimit)
+	if err := limiter.start(ctx); err != nil {
+		j.AddError(err)
+		return
+	}
+	defer limiter.finish()
+
+	if err := limiter.waitDocuments(ctx, 1); err != nil {
+		j.AddError(err)
+		return
+	}
+
 	client, err := env.GetClient()
 	if err != nil {
 		j.AddError(errors.Wrap(err, "getting database client"))
 		return
 	}
+	client = limiter.client(client)
 
 	coll := client.Database(j.Definition.Namespace.DB).Collection(j.Definition.Namespace.Collection)
 
@@ -89,5 +102,12 @@ func (j *manualMigrationJob) Run(ctx context.Context) {
 		return
 	}
 
-	j.AddError(operation(client, doc))
+	if j.Definition.Snapshot != nil {
+		if err = saveSnapshot(ctx, env, j.Definition.Migration, j.Definition.Namespace, j.Definition.Snapshot, payload); err != nil {
+			j.AddError(err)
+			return
+		}
+	}
+
+	j.AddError(operation(client, doc, j.Definition.Params))
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func TestManualMigration(t *testing.T) {
@@ -82,6 +83,56 @@ func TestManualMigration(t *testing.T) {
 			assert.True(t, job.Status().Completed)
 			assert.False(t, job.HasErrors())
 		})
+		t.Run("Params", func(t *testing.T) {
+			var received map[string]string
+			require.NoError(t, env.RegisterParameterizedMigrationOperation("params", func(_ client.Client, _ *birch.Document, params map[string]string) error {
+				received = params
+				return nil
+			}))
+			defer delete(env.ParamsRegistry, "params")
+
+			env.Client = mock.NewClient()
+			job = factory().(*manualMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.OperationName = "params"
+			job.Definition.Params = map[string]string{"field": "name"}
+			job.Run(ctx)
+			assert.NoError(t, job.Error())
+			assert.Equal(t, map[string]string{"field": "name"}, received)
+		})
+		t.Run("Snapshot", func(t *testing.T) {
+			raw, err := bson.Marshal(bson.M{"_id": "one", "a": 1})
+			require.NoError(t, err)
+			snapshots := &mock.Collection{}
+			env.Client = mock.NewClient()
+			env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": {SingleResult: &mock.SingleResult{DecodeBytesValue: raw}}}}
+			env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{snapshotCollection("migration"): snapshots}}
+			env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+			defer func() { env.MetaNS = model.Namespace{} }()
+
+			job = factory().(*manualMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.Migration = "migration"
+			job.Definition.Namespace = model.Namespace{DB: "foo", Collection: "bar"}
+			job.Definition.OperationName = "passing"
+			job.Definition.Snapshot = &model.SnapshotOptions{}
+			job.Run(ctx)
+			assert.NoError(t, job.Error())
+			require.Len(t, snapshots.Updates, 1)
+			assert.Equal(t, bson.Raw(raw), snapshots.Updates[0].(bson.M)["$setOnInsert"].(bson.M)["document"])
+
+			snapshots.UpdateError = errors.New("write failed")
+			job = factory().(*manualMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.Migration = "migration"
+			job.Definition.Namespace = model.Namespace{DB: "foo", Collection: "bar"}
+			job.Definition.OperationName = "failing"
+			job.Definition.Snapshot = &model.SnapshotOptions{}
+			job.Run(ctx)
+			require.Error(t, job.Error())
+			assert.Contains(t, job.Error().Error(), "write failed")
+			assert.NotContains(t, job.Error().Error(), "manual fail")
+		})
 		t.Run("Failing", func(t *testing.T) {
 			// reset and have a job that always fails and make sure the error propagates
 			job = factory().(*manualMigrationJob)
@@ -0,0 +1,178 @@
+package anser
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/evergreen-ci/birch"
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func init() {
+	registry.AddJobType("rollback-migration", func() amboy.Job { return makeRollbackMigration() })
+}
+
+func NewRollbackMigration(e Environment, m model.Rollback) Migration {
+	j := makeRollbackMigration()
+	j.Definition = m
+	j.MigrationHelper = NewMigrationHelper(e)
+	return j
+}
+
+func makeRollbackMigration() *rollbackMigrationJob {
+	return &rollbackMigrationJob{
+		MigrationHelper: &migrationBase{},
+		Base: job.Base{
+			JobType: amboy.JobType{
+				Name:    "rollback-migration",
+				Version: 0,
+			},
+		},
+	}
+}
+
+type rollbackMigrationJob struct {
+	Definition      model.Rollback `bson:"migration" json:"migration" yaml:"migration"`
+	job.Base        `bson:"job_base" json:"job_base" yaml:"job_base"`
+	MigrationHelper `bson:"-" json:"-" yaml:"-"`
+}
+
+// rollbackMigrationName returns the name that rollback operations
+// record in the migration metadata, which is distinct from the name
+// of the migration they reverse.
+func rollbackMigrationName(migration string) string { return fmt.Sprintf("%s.rollback", migration) }
+
+// rollbackJobID returns a new ID for a job that rolls back the
+// migration or migration operation. Each rollback has its own IDs, so
+// that queues do not treat the jobs of a rollback that follows a
+// later run as duplicates of an earlier rollback's jobs.
+func rollbackJobID(name string) string {
+	return fmt.Sprintf("%s.%d", rollbackMigrationName(name), time.Now().UnixNano())
+}
+
+func (j *rollbackMigrationJob) Run(ctx context.Context) {
+	grip.Info(message.Fields{
+		"message":   "starting rollback",
+		"migration": j.Definition.Migration,
+		"target":    j.Definition.ID,
+		"targets":   len(j.Definition.IDs),
+		"id":        j.ID(),
+		"ns":        j.Definition.Namespace,
+		"events":    len(j.Definition.Events),
+	})
+
+	defer finishMigration(ctx, j.MigrationHelper, &model.MigrationMetadata{
+		Migration: rollbackMigrationName(j.Definition.Migration),
+		Target:    j.Definition.ID,
+		Targets:   j.Definition.IDs,
+	}, &j.Base)
+
+	env := j.Env()
+
+	client, err := env.GetClient()
+	if err != nil {
+		j.AddError(errors.Wrap(err, "getting database client"))
+		return
+	}
+
+	switch {
+	case len(j.Definition.Update) > 0:
+		j.AddError(j.runUpdate(ctx, client))
+	case j.Definition.OperationName != "":
+		j.AddError(j.runOperation(ctx, env, client))
+	case j.Definition.ProcessorName != "":
+		j.AddError(j.runProcessor(env, client))
+	default:
+		j.AddError(errors.Errorf("rollback for '%s' does not define an operation", j.Definition.Migration))
+	}
+
+	if j.HasErrors() || len(j.Definition.Events) == 0 {
+		return
+	}
+
+	ns := env.MetadataNamespace()
+	_, err = client.Database(ns.DB).Collection(ns.Collection).UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": j.Definition.Events}},
+		bson.M{"$set": bson.M{"rolled_back": true}})
+	j.AddError(errors.Wrap(err, "marking migrations as rolled back"))
+}
+
+func (j *rollbackMigrationJob) runUpdate(ctx context.Context, cl client.Client) error {
+	coll := cl.Database(j.Definition.Namespace.DB).Collection(j.Definition.Namespace.Collection)
+	if len(j.Definition.IDs) > 0 {
+		res, err := coll.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": j.Definition.IDs}}, j.Definition.Update)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if res.MatchedCount != int64(len(j.Definition.IDs)) {
+			return errors.Errorf("found %d of %d documents to roll back for '%s'", res.MatchedCount, len(j.Definition.IDs), j.ID())
+		}
+
+		return nil
+	}
+
+	res, err := coll.UpdateOne(ctx, bson.M{"_id": j.Definition.ID}, j.Definition.Update)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if res.MatchedCount != 1 {
+		return errors.Errorf("could not find '%v' to roll back for '%s'", j.Definition.ID, j.ID())
+	}
+
+	return nil
+}
+
+func (j *rollbackMigrationJob) runOperation(ctx context.Context, env Environment, cl client.Client) error {
+	operation, ok := getParameterizedMigrationOperation(env, j.Definition.OperationName)
+	if !ok {
+		return errors.Errorf("could not find migration named '%s'", j.Definition.OperationName)
+	}
+
+	coll := cl.Database(j.Definition.Namespace.DB).Collection(j.Definition.Namespace.Collection)
+	res := coll.FindOne(ctx, bson.M{"_id": j.Definition.ID})
+	if err := res.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	payload, err := res.Raw()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	doc, err := birch.ReadDocument(payload)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return operation(cl, doc, j.Definition.Params)
+}
+
+func (j *rollbackMigrationJob) runProcessor(env Environment, cl client.Client) error {
+	processor, ok := env.GetDocumentProcessor(j.Definition.ProcessorName)
+	if !ok {
+		return errors.Errorf("producer named '%s' is not defined", j.Definition.ProcessorName)
+	}
+
+	processor, err := configureProcessor(processor, j.Definition.Params)
+	if err != nil {
+		return errors.Wrapf(err, "configuring producer '%s'", j.Definition.ProcessorName)
+	}
+
+	iter := processor.Load(cl, j.Definition.Namespace, j.Definition.Query)
+	if iter == nil {
+		return errors.Errorf("document processor for %s could not return iterator", j.Definition.Migration)
+	}
+
+	return processor.Migrate(iter)
+}
@@ -0,0 +1,181 @@
+package anser
+
+import (
+	"context"
+	"testing"
+
+	"github.com/evergreen-ci/birch"
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackMigration(t *testing.T) {
+	env := mock.NewEnvironment()
+	mh := &MigrationHelperMock{Environment: env}
+	ctx := context.Background()
+	const jobTypeName = "rollback-migration"
+
+	factory, err := registry.GetJobFactory(jobTypeName)
+	require.NoError(t, err)
+	job, ok := factory().(*rollbackMigrationJob)
+	require.True(t, ok)
+	require.Equal(t, jobTypeName, job.Type().Name)
+
+	t.Run("Factory", func(t *testing.T) {
+		// verify that the factory doesn't share state.
+		jone := factory().(*rollbackMigrationJob)
+		jone.SetID("foo")
+		jtwo := factory().(*rollbackMigrationJob)
+		jtwo.SetID("bar")
+		assert.NotEqual(t, jone, jtwo)
+	})
+	t.Run("Constructor", func(t *testing.T) {
+		migration := NewRollbackMigration(env, model.Rollback{})
+		assert.NotNil(t, migration)
+		assert.Equal(t, jobTypeName, migration.Type().Name)
+	})
+	t.Run("NoOperation", func(t *testing.T) {
+		job := factory().(*rollbackMigrationJob)
+		job.MigrationHelper = mh
+		job.Run(ctx)
+		assert.True(t, job.Status().Completed)
+		require.True(t, job.HasErrors())
+		assert.Contains(t, job.Error().Error(), "does not define an operation")
+	})
+	t.Run("NoClient", func(t *testing.T) {
+		env.ClientError = errors.New("no client")
+		defer func() { env.ClientError = nil }()
+
+		job := factory().(*rollbackMigrationJob)
+		job.MigrationHelper = mh
+		job.Definition.Update = map[string]interface{}{"$unset": map[string]interface{}{"foo": 1}}
+		job.Run(ctx)
+		assert.True(t, job.Status().Completed)
+		require.True(t, job.HasErrors())
+		assert.Contains(t, job.Error().Error(), "no client")
+	})
+	t.Run("Update", func(t *testing.T) {
+		t.Run("Matched", func(t *testing.T) {
+			env.Client = mock.NewClient()
+			env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": {UpdateResult: client.UpdateResult{MatchedCount: 1}}}}
+
+			job := factory().(*rollbackMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.Namespace = model.Namespace{DB: "foo", Collection: "bar"}
+			job.Definition.Migration = "migration"
+			job.Definition.Update = map[string]interface{}{"$unset": map[string]interface{}{"foo": 1}}
+			job.Definition.Events = []string{"migration.one.0"}
+			job.Run(ctx)
+			assert.True(t, job.Status().Completed)
+			assert.NoError(t, job.Error())
+
+			require.NotEmpty(t, mh.MigrationEvents)
+			meta := mh.MigrationEvents[len(mh.MigrationEvents)-1]
+			assert.Equal(t, "migration.rollback", meta.Migration)
+		})
+		t.Run("NotMatched", func(t *testing.T) {
+			env.Client = mock.NewClient()
+			env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": {UpdateResult: client.UpdateResult{MatchedCount: 0}}}}
+
+			job := factory().(*rollbackMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.Namespace = model.Namespace{DB: "foo", Collection: "bar"}
+			job.Definition.Update = map[string]interface{}{"$unset": map[string]interface{}{"foo": 1}}
+			job.Run(ctx)
+			assert.True(t, job.Status().Completed)
+			require.Error(t, job.Error())
+			assert.Contains(t, job.Error().Error(), "could not find")
+		})
+		t.Run("Batch", func(t *testing.T) {
+			env.Client = mock.NewClient()
+			env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": {UpdateResult: client.UpdateResult{MatchedCount: 2}}}}
+
+			job := factory().(*rollbackMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.Namespace = model.Namespace{DB: "foo", Collection: "bar"}
+			job.Definition.IDs = []interface{}{"one", "two"}
+			job.Definition.Update = map[string]interface{}{"$unset": map[string]interface{}{"foo": 1}}
+			job.Run(ctx)
+			assert.True(t, job.Status().Completed)
+			assert.NoError(t, job.Error())
+
+			job = factory().(*rollbackMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.Namespace = model.Namespace{DB: "foo", Collection: "bar"}
+			job.Definition.IDs = []interface{}{"one", "two", "three"}
+			job.Definition.Update = map[string]interface{}{"$unset": map[string]interface{}{"foo": 1}}
+			job.Run(ctx)
+			require.Error(t, job.Error())
+			assert.Contains(t, job.Error().Error(), "found 2 of 3 documents")
+		})
+	})
+	t.Run("Operation", func(t *testing.T) {
+		env.Client = mock.NewClient()
+		assert.NoError(t, env.RegisterManualMigrationOperation("passing", func(c client.Client, d *birch.Document) error { return nil }))
+		assert.NoError(t, env.RegisterManualMigrationOperation("failing", func(c client.Client, d *birch.Document) error { return errors.New("rollback fail") }))
+		defer func() { env.MigrationRegistry = make(map[string]client.MigrationOperation) }()
+
+		t.Run("Unregistered", func(t *testing.T) {
+			job := factory().(*rollbackMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.OperationName = "missing"
+			job.Run(ctx)
+			require.True(t, job.HasErrors())
+			assert.Contains(t, job.Error().Error(), "could not find migration named")
+		})
+		t.Run("Passing", func(t *testing.T) {
+			job := factory().(*rollbackMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.OperationName = "passing"
+			job.Run(ctx)
+			assert.True(t, job.Status().Completed)
+			assert.NoError(t, job.Error())
+		})
+		t.Run("Failing", func(t *testing.T) {
+			job := factory().(*rollbackMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.OperationName = "failing"
+			job.Run(ctx)
+			require.True(t, job.HasErrors())
+			assert.Contains(t, job.Error().Error(), "rollback fail")
+		})
+	})
+	t.Run("Processor", func(t *testing.T) {
+		processor := &mock.Processor{}
+		assert.NoError(t, env.RegisterDocumentProcessor("inverse", processor))
+		defer func() { env.ProcessorRegistry = make(map[string]client.Processor) }()
+
+		t.Run("Unregistered", func(t *testing.T) {
+			job := factory().(*rollbackMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.ProcessorName = "missing"
+			job.Run(ctx)
+			require.True(t, job.HasErrors())
+			assert.Contains(t, job.Error().Error(), "is not defined")
+		})
+		t.Run("NoIterator", func(t *testing.T) {
+			job := factory().(*rollbackMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.ProcessorName = "inverse"
+			job.Run(ctx)
+			require.True(t, job.HasErrors())
+			assert.Contains(t, job.Error().Error(), "could not return iterator")
+		})
+		t.Run("Passing", func(t *testing.T) {
+			processor.Cursor = &mock.Cursor{}
+			job := factory().(*rollbackMigrationJob)
+			job.MigrationHelper = mh
+			job.Definition.ProcessorName = "inverse"
+			job.Definition.Query = map[string]interface{}{"a": 1}
+			job.Run(ctx)
+			assert.NoError(t, job.Error())
+			assert.Equal(t, 1, processor.NumMigrateCalls)
+			assert.Equal(t, job.Definition.Query, processor.Query)
+		})
+	})
+}
@@ -55,18 +55,42 @@ func (j *simpleMigrationJob) Run(ctx context.Context) {
 		"ns":        j.Definition.Namespace,
 	})
 
-	defer j.FinishMigration(ctx, j.Definition.Migration, &j.Base)
+	defer finishMigration(ctx, j.MigrationHelper, &model.MigrationMetadata{Migration: j.Definition.Migration, Target: j.Definition.ID}, &j.Base)
+
+	limiter := getMigrationLimiter(env, j.Definition.Migration, j.Definition.RateLimit)
+	if err := limiter.start(ctx); err != nil {
+		j.AddError(err)
+		return
+	}
+	defer limiter.finish()
+
+	if err := limiter.waitDocuments(ctx, 1); err != nil {
+		j.AddError(err)
+		return
+	}
 
 	client, err := env.GetClient()
 	if err != nil {
 		j.AddError(errors.Wrap(err, "getting database client"))
 		return
 	}
+	client = limiter.client(client)
 
 	coll := client.Database(j.Definition.Namespace.DB).Collection(j.Definition.Namespace.Collection)
-	res, err := coll.UpdateOne(ctx, bson.M{"_id": j.Definition.ID}, j.Definition.Update)
+	res, err := coll.UpdateOne(ctx, bson.M{"_id": j.Definition.ID}, simpleUpdate(j.Definition.Update, j.Definition.Pipeline))
 	j.AddError(err)
 	if res.ModifiedCount != 1 {
 		j.AddError(errors.Errorf("could not update '%s' for '%s'", j.Definition.ID, j.ID()))
 	}
 }
+
+// simpleUpdate returns the update that simple migrations apply to
+// their documents: the update pipeline, if there is one, and
+// otherwise the update document.
+func simpleUpdate(update map[string]interface{}, pipeline []map[string]interface{}) interface{} {
+	if len(pipeline) > 0 {
+		return pipeline
+	}
+
+	return update
+}
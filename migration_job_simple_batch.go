@@ -0,0 +1,170 @@
+package anser
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func init() {
+	registry.AddJobType("simple-batch-migration",
+		func() amboy.Job { return makeSimpleBatchMigration() })
+}
+
+func NewSimpleBatchMigration(e Environment, m model.SimpleBatch) Migration {
+	j := makeSimpleBatchMigration()
+	j.Definition = m
+	j.MigrationHelper = NewMigrationHelper(e)
+	return j
+}
+
+func makeSimpleBatchMigration() *simpleBatchMigrationJob {
+	return &simpleBatchMigrationJob{
+		MigrationHelper: &migrationBase{},
+		Base: job.Base{
+			JobType: amboy.JobType{
+				Name:    "simple-batch-migration",
+				Version: 0,
+			},
+		},
+	}
+}
+
+type simpleBatchMigrationJob struct {
+	Definition      model.SimpleBatch `bson:"migration" json:"migration" yaml:"migration"`
+	job.Base        `bson:"job_base" json:"job_base" yaml:"job_base"`
+	MigrationHelper `bson:"-" json:"-" yaml:"-"`
+}
+
+func (j *simpleBatchMigrationJob) Run(ctx context.Context) {
+	env := j.Env()
+
+	grip.Info(message.Fields{
+		"message":   "starting migration",
+		"operation": "simple-batch",
+		"migration": j.Definition.Migration,
+		"targets":   len(j.Definition.IDs),
+		"id":        j.ID(),
+		"ns":        j.Definition.Namespace,
+	})
+
+	meta := &model.MigrationMetadata{Migration: j.Definition.Migration, Targets: j.Definition.IDs}
+	defer finishMigration(ctx, j.MigrationHelper, meta, &j.Base)
+
+	if len(j.Definition.IDs) == 0 {
+		return
+	}
+
+	limiter := getMigrationLimiter(env, j.Definition.Migration, j.Definition.RateLimit)
+	if err := limiter.start(ctx); err != nil {
+		j.AddError(err)
+		return
+	}
+	defer limiter.finish()
+
+	if err := limiter.waitDocuments(ctx, len(j.Definition.IDs)); err != nil {
+		j.AddError(err)
+		return
+	}
+
+	client, err := env.GetClient()
+	if err != nil {
+		j.AddError(errors.Wrap(err, "getting database client"))
+		return
+	}
+	client = limiter.client(client)
+
+	models := make([]mongo.WriteModel, 0, len(j.Definition.IDs))
+	for _, id := range j.Definition.IDs {
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": id}).SetUpdate(simpleUpdate(j.Definition.Update, j.Definition.Pipeline)))
+	}
+
+	coll := client.Database(j.Definition.Namespace.DB).Collection(j.Definition.Namespace.Collection)
+	res, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(!j.Definition.Unordered))
+	if err != nil {
+		meta.DocumentErrors = j.documentErrors(err)
+		meta.Targets = j.writtenIDs(err)
+		j.AddError(errors.Wrapf(err, "updating documents for '%s'", j.ID()))
+		return
+	}
+
+	// documents that already have the result of the update match
+	// without being modified, like those of simple migrations that
+	// run again.
+	if res.MatchedCount != int64(len(j.Definition.IDs)) {
+		j.AddError(errors.Errorf("found %d of %d documents for '%s'", res.MatchedCount, len(j.Definition.IDs), j.ID()))
+	}
+}
+
+// writtenIDs returns the IDs of the documents that a bulk write that
+// failed updated, which are the documents without errors. If the
+// error is not from the writes themselves, the documents that were
+// updated are not known, and writtenIDs returns none.
+func (j *simpleBatchMigrationJob) writtenIDs(err error) []interface{} {
+	bwe, ok := errors.Cause(err).(mongo.BulkWriteException)
+	if !ok {
+		return nil
+	}
+
+	failed := make([]bool, len(j.Definition.IDs))
+	for _, we := range bwe.WriteErrors {
+		if we.Index >= 0 && we.Index < len(failed) {
+			failed[we.Index] = true
+		}
+	}
+
+	out := []interface{}{}
+	for idx, id := range j.Definition.IDs {
+		if failed[idx] {
+			// ordered writes stop at the first failed write.
+			if !j.Definition.Unordered {
+				break
+			}
+			continue
+		}
+		out = append(out, id)
+	}
+
+	return out
+}
+
+// documentErrors converts the write errors from a bulk write into
+// errors for the documents that the writes targeted. When the bulk
+// write is ordered, the server does not attempt the writes after the
+// first failed write, so these documents are also reported.
+func (j *simpleBatchMigrationJob) documentErrors(err error) []model.DocumentError {
+	bwe, ok := errors.Cause(err).(mongo.BulkWriteException)
+	if !ok {
+		return nil
+	}
+
+	out := []model.DocumentError{}
+	last := -1
+	for _, we := range bwe.WriteErrors {
+		if we.Index < 0 || we.Index >= len(j.Definition.IDs) {
+			continue
+		}
+
+		out = append(out, model.DocumentError{ID: j.Definition.IDs[we.Index], Error: we.Message})
+		if we.Index > last {
+			last = we.Index
+		}
+	}
+
+	if !j.Definition.Unordered && last >= 0 {
+		for _, id := range j.Definition.IDs[last+1:] {
+			out = append(out, model.DocumentError{ID: id, Error: "not attempted after an earlier write failed"})
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,171 @@
+package anser
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestSimpleBatchMigrationJob(t *testing.T) {
+	env := mock.NewEnvironment()
+	ctx := context.Background()
+
+	const jobTypeName = "simple-batch-migration"
+
+	factory, err := registry.GetJobFactory(jobTypeName)
+	require.NoError(t, err)
+	job, ok := factory().(*simpleBatchMigrationJob)
+	require.True(t, ok)
+	require.Equal(t, jobTypeName, job.Type().Name)
+
+	ns := model.Namespace{DB: "foo", Collection: "bar"}
+	ids := []interface{}{"one", "two", "three"}
+
+	t.Run("Constructor", func(t *testing.T) {
+		migration := NewSimpleBatchMigration(env, model.SimpleBatch{})
+		assert.NotNil(t, migration)
+		assert.Equal(t, jobTypeName, migration.Type().Name)
+	})
+	t.Run("Client", func(t *testing.T) {
+		t.Run("SuccessfulOperation", func(t *testing.T) {
+			mh := &MigrationHelperMock{Environment: env}
+			env.Client = mock.NewClient()
+			coll := &mock.Collection{BulkWriteResult: client.BulkWriteResult{MatchedCount: 3, ModifiedCount: 3}}
+			env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": coll}}
+
+			job = factory().(*simpleBatchMigrationJob)
+			job.Definition = model.SimpleBatch{IDs: ids, Update: map[string]interface{}{"$set": map[string]interface{}{"a": 1}}, Migration: "batch", Namespace: ns}
+			job.MigrationHelper = mh
+			job.Run(ctx)
+			assert.True(t, job.Status().Completed)
+			assert.NoError(t, job.Error())
+			assert.Len(t, coll.BulkWriteModels, 3)
+
+			require.Len(t, mh.MigrationEvents, 1)
+			assert.Equal(t, ids, mh.MigrationEvents[0].Targets)
+			assert.Empty(t, mh.MigrationEvents[0].DocumentErrors)
+		})
+		t.Run("Pipeline", func(t *testing.T) {
+			mh := &MigrationHelperMock{Environment: env}
+			env.Client = mock.NewClient()
+			coll := &mock.Collection{BulkWriteResult: client.BulkWriteResult{MatchedCount: 3, ModifiedCount: 3}}
+			env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": coll}}
+
+			pipeline := []map[string]interface{}{{"$set": map[string]interface{}{"a": "$b"}}}
+			job = factory().(*simpleBatchMigrationJob)
+			job.Definition = model.SimpleBatch{IDs: ids, Pipeline: pipeline, Migration: "batch", Namespace: ns}
+			job.MigrationHelper = mh
+			job.Run(ctx)
+			assert.NoError(t, job.Error())
+			require.Len(t, coll.BulkWriteModels, 3)
+			assert.Equal(t, pipeline, coll.BulkWriteModels[0].(*mongo.UpdateOneModel).Update)
+		})
+		t.Run("UnmodifiedDocuments", func(t *testing.T) {
+			mh := &MigrationHelperMock{Environment: env}
+			env.Client = mock.NewClient()
+			coll := &mock.Collection{BulkWriteResult: client.BulkWriteResult{MatchedCount: 3, ModifiedCount: 2}}
+			env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": coll}}
+
+			job = factory().(*simpleBatchMigrationJob)
+			job.Definition = model.SimpleBatch{IDs: ids, Migration: "batch", Namespace: ns}
+			job.MigrationHelper = mh
+			job.Run(ctx)
+			assert.NoError(t, job.Error())
+		})
+		t.Run("MissingDocuments", func(t *testing.T) {
+			mh := &MigrationHelperMock{Environment: env}
+			env.Client = mock.NewClient()
+			coll := &mock.Collection{BulkWriteResult: client.BulkWriteResult{MatchedCount: 2, ModifiedCount: 2}}
+			env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": coll}}
+
+			job = factory().(*simpleBatchMigrationJob)
+			job.Definition = model.SimpleBatch{IDs: ids, Migration: "batch", Namespace: ns}
+			job.MigrationHelper = mh
+			job.Run(ctx)
+			err = job.Error()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "found 2 of 3 documents")
+		})
+		t.Run("OrderedWriteErrors", func(t *testing.T) {
+			mh := &MigrationHelperMock{Environment: env}
+			env.Client = mock.NewClient()
+			coll := &mock.Collection{BulkWriteError: mongo.BulkWriteException{
+				WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Index: 1, Message: "bad update"}}},
+			}}
+			env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": coll}}
+
+			job = factory().(*simpleBatchMigrationJob)
+			job.Definition = model.SimpleBatch{IDs: ids, Migration: "batch", Namespace: ns}
+			job.MigrationHelper = mh
+			job.Run(ctx)
+			require.Error(t, job.Error())
+
+			require.Len(t, mh.MigrationEvents, 1)
+			meta := mh.MigrationEvents[0]
+			assert.True(t, meta.HasErrors)
+			require.Len(t, meta.DocumentErrors, 2)
+			assert.Equal(t, model.DocumentError{ID: "two", Error: "bad update"}, meta.DocumentErrors[0])
+			assert.Equal(t, "three", meta.DocumentErrors[1].ID)
+			assert.Equal(t, []interface{}{"one"}, meta.Targets)
+		})
+		t.Run("UnorderedWriteErrors", func(t *testing.T) {
+			mh := &MigrationHelperMock{Environment: env}
+			env.Client = mock.NewClient()
+			coll := &mock.Collection{BulkWriteError: mongo.BulkWriteException{
+				WriteErrors: []mongo.BulkWriteError{
+					{WriteError: mongo.WriteError{Index: 0, Message: "bad update"}},
+					{WriteError: mongo.WriteError{Index: 2, Message: "worse update"}},
+				},
+			}}
+			env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": coll}}
+
+			job = factory().(*simpleBatchMigrationJob)
+			job.Definition = model.SimpleBatch{IDs: ids, Unordered: true, Migration: "batch", Namespace: ns}
+			job.MigrationHelper = mh
+			job.Run(ctx)
+			require.Error(t, job.Error())
+
+			require.Len(t, mh.MigrationEvents, 1)
+			assert.Equal(t, []model.DocumentError{
+				{ID: "one", Error: "bad update"},
+				{ID: "three", Error: "worse update"},
+			}, mh.MigrationEvents[0].DocumentErrors)
+			assert.Equal(t, []interface{}{"two"}, mh.MigrationEvents[0].Targets)
+		})
+		t.Run("OtherErrors", func(t *testing.T) {
+			mh := &MigrationHelperMock{Environment: env}
+			env.Client = mock.NewClient()
+			coll := &mock.Collection{BulkWriteError: errors.New("connection reset")}
+			env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": coll}}
+
+			job = factory().(*simpleBatchMigrationJob)
+			job.Definition = model.SimpleBatch{IDs: ids, Migration: "batch", Namespace: ns}
+			job.MigrationHelper = mh
+			job.Run(ctx)
+			require.Error(t, job.Error())
+
+			require.Len(t, mh.MigrationEvents, 1)
+			assert.Empty(t, mh.MigrationEvents[0].Targets)
+		})
+		t.Run("NoClient", func(t *testing.T) {
+			job = factory().(*simpleBatchMigrationJob)
+			job.Definition = model.SimpleBatch{IDs: ids, Migration: "batch", Namespace: ns}
+			job.MigrationHelper = &MigrationHelperMock{Environment: env}
+			env.ClientError = errors.New("no client")
+			defer func() { env.ClientError = nil }()
+			job.Run(ctx)
+			assert.True(t, job.Status().Completed)
+			err = job.Error()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "no client")
+		})
+	})
+}
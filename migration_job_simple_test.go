@@ -82,5 +82,12 @@ func TestSimpleMigrationJob(t *testing.T) {
 			assert.Contains(t, err.Error(), "no client")
 		})
 	})
+	t.Run("Update", func(t *testing.T) {
+		update := map[string]interface{}{"$set": map[string]interface{}{"a": 1}}
+		pipeline := []map[string]interface{}{{"$set": map[string]interface{}{"a": "$b"}}}
 
+		assert.Equal(t, update, simpleUpdate(update, nil))
+		assert.Equal(t, pipeline, simpleUpdate(nil, pipeline))
+		assert.Equal(t, pipeline, simpleUpdate(update, pipeline))
+	})
 }
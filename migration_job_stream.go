@@ -6,6 +6,7 @@ import (
 	"github.com/mongodb/amboy"
 	"github.com/mongodb/amboy/job"
 	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/anser/client"
 	"github.com/mongodb/anser/model"
 	"github.com/mongodb/grip"
 	"github.com/mongodb/grip/message"
@@ -61,18 +62,42 @@ func (j *streamMigrationJob) Run(ctx context.Context) {
 		return
 	}
 
+	producer, err := configureProcessor(producer, j.Definition.Params)
+	if err != nil {
+		j.AddError(errors.Wrapf(err, "configuring producer '%s'", j.Definition.ProcessorName))
+		return
+	}
+
+	limiter := getMigrationLimiter(env, j.Definition.Migration, j.Definition.RateLimit)
+	if err := limiter.start(ctx); err != nil {
+		j.AddError(err)
+		return
+	}
+	defer limiter.finish()
+
 	client, err := env.GetClient()
 	if err != nil {
 		j.AddError(errors.Wrap(err, "getting database client"))
 		return
 	}
 
-	iter := producer.Load(client, j.Definition.Namespace, j.Definition.Query)
+	iter := producer.Load(limiter.client(client), j.Definition.Namespace, j.Definition.Query)
 	if iter == nil {
 		j.AddError(errors.Errorf("document processor for %s could not return iterator",
 			j.Definition.Migration))
 		return
 	}
 
-	j.AddError(producer.Migrate(iter))
+	j.AddError(producer.Migrate(limiter.cursor(newSnapshotCursor(env, client, j.Definition, iter))))
+}
+
+// configureProcessor returns the processor configured with the params
+// if it accepts params, and otherwise returns the processor.
+func configureProcessor(p client.Processor, params map[string]string) (client.Processor, error) {
+	pp, ok := p.(client.ParameterizedProcessor)
+	if !ok {
+		return p, nil
+	}
+
+	return pp.WithParams(params)
 }
@@ -47,6 +47,28 @@ func TestStreamMigrationJob(t *testing.T) {
 		assert.Contains(t, err.Error(), job.Definition.ProcessorName)
 	})
 
+	t.Run("ParameterizedProcessor", func(t *testing.T) {
+		processor := &mock.ParameterizedProcessor{Processor: mock.Processor{Cursor: &mock.Cursor{}}}
+		env.ProcessorRegistry[processorTypeName] = processor
+		defer func() { delete(env.ProcessorRegistry, processorTypeName) }()
+
+		job := factory().(*streamMigrationJob)
+		job.MigrationHelper = mh
+		job.Definition.ProcessorName = processorTypeName
+		job.Definition.Params = map[string]string{"default": "value"}
+		job.Run(ctx)
+		assert.NoError(t, job.Error())
+		assert.Equal(t, map[string]string{"default": "value"}, processor.Params)
+		assert.Equal(t, 1, processor.NumMigrateCalls)
+
+		processor.ParamsError = errors.New("bad params")
+		job = factory().(*streamMigrationJob)
+		job.MigrationHelper = mh
+		job.Definition.ProcessorName = processorTypeName
+		job.Run(ctx)
+		require.Error(t, job.Error())
+		assert.Contains(t, job.Error().Error(), "bad params")
+	})
 	t.Run("Processor", func(t *testing.T) {
 		processor := &mock.Processor{}
 		env.ProcessorRegistry[processorTypeName] = processor
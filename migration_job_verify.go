@@ -0,0 +1,139 @@
+package anser
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func init() {
+	registry.AddJobType("verify-migration", func() amboy.Job { return makeVerifyMigration() })
+}
+
+// NewVerifyMigration constructs the job that verifies a migration,
+// which should depend on all of the migration's operations.
+func NewVerifyMigration(e Environment, v model.Verification) Migration {
+	j := makeVerifyMigration()
+	j.Definition = v
+	j.MigrationHelper = NewMigrationHelper(e)
+	j.SetID(verificationID(v.Migration))
+	return j
+}
+
+func makeVerifyMigration() *verifyMigrationJob {
+	return &verifyMigrationJob{
+		MigrationHelper: &migrationBase{},
+		Base: job.Base{
+			JobType: amboy.JobType{
+				Name:    "verify-migration",
+				Version: 0,
+			},
+		},
+	}
+}
+
+type verifyMigrationJob struct {
+	Definition      model.Verification `bson:"migration" json:"migration" yaml:"migration"`
+	job.Base        `bson:"job_base" json:"job_base" yaml:"job_base"`
+	MigrationHelper `bson:"-" json:"-" yaml:"-"`
+}
+
+// verificationID returns the ID of the job that verifies the
+// migration, which is also the ID of the metadata that records the
+// result of the verification. Migrations that depend on the migration
+// depend on this ID, so that they remain blocked if the verification
+// fails.
+func verificationID(migration string) string { return fmt.Sprintf("%s.verify", migration) }
+
+// generatorVerification returns the definition of the verification of
+// a generator's migrations, or nil if the generator has no
+// verification options.
+func generatorVerification(id string, ns model.Namespace, opts *model.VerifyOptions, partial bool) *model.Verification {
+	if opts == nil {
+		return nil
+	}
+
+	return &model.Verification{
+		Migration: id,
+		Namespace: ns,
+		Query:     opts.Query,
+		Name:      opts.Name,
+		Partial:   partial,
+	}
+}
+
+func (j *verifyMigrationJob) Run(ctx context.Context) {
+	grip.Info(message.Fields{
+		"message":   "starting verification",
+		"migration": j.Definition.Migration,
+		"id":        j.ID(),
+		"ns":        j.Definition.Namespace,
+		"name":      j.Definition.Name,
+		"partial":   j.Definition.Partial,
+	})
+
+	defer finishMigration(ctx, j.MigrationHelper, &model.MigrationMetadata{Migration: j.Definition.Migration, Verification: true}, &j.Base)
+
+	env := j.Env()
+
+	client, err := env.GetClient()
+	if err != nil {
+		j.AddError(errors.Wrap(err, "getting database client"))
+		return
+	}
+
+	var ids []interface{}
+	if j.Definition.Partial {
+		ids, err = getMigrationTargets(ctx, j.MigrationHelper, j.Definition.Migration)
+		if err != nil {
+			j.AddError(errors.Wrap(err, "finding migrated documents"))
+			return
+		}
+	}
+
+	if len(j.Definition.Query) > 0 {
+		j.AddError(j.verifyQuery(ctx, client, ids))
+	}
+
+	if j.Definition.Name == "" {
+		return
+	}
+
+	verify, ok := getVerification(env, j.Definition.Name)
+	if !ok {
+		j.AddError(errors.Errorf("could not find verification named '%s'", j.Definition.Name))
+		return
+	}
+
+	j.AddError(errors.Wrapf(verify(ctx, client, j.Definition.Namespace, ids), "running verification '%s'", j.Definition.Name))
+}
+
+// verifyQuery returns an error if any documents in the namespace (or,
+// for partial verifications, any of the documents with the ids) match
+// the verification query.
+func (j *verifyMigrationJob) verifyQuery(ctx context.Context, cl client.Client, ids []interface{}) error {
+	filter := bson.M(j.Definition.Query)
+	if j.Definition.Partial {
+		filter = bson.M{"$and": []interface{}{j.Definition.Query, bson.M{"_id": bson.M{"$in": ids}}}}
+	}
+
+	num, err := cl.Database(j.Definition.Namespace.DB).Collection(j.Definition.Namespace.Collection).CountDocuments(ctx, filter)
+	if err != nil {
+		return errors.Wrap(err, "counting documents that match the verification query")
+	}
+
+	if num > 0 {
+		return errors.Errorf("%d documents match the verification query", num)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package anser
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestVerifyMigration(t *testing.T) {
+	ctx := context.Background()
+	const jobTypeName = "verify-migration"
+	ns := model.Namespace{DB: "foo", Collection: "bar"}
+	query := map[string]interface{}{"a": map[string]interface{}{"$exists": false}}
+
+	factory, err := registry.GetJobFactory(jobTypeName)
+	require.NoError(t, err)
+
+	setup := func(t *testing.T) (*mock.Environment, *MigrationHelperMock, *mock.Collection) {
+		env := mock.NewEnvironment()
+		env.Client = mock.NewClient()
+		coll := &mock.Collection{}
+		env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": coll}}
+		return env, &MigrationHelperMock{Environment: env}, coll
+	}
+	run := func(t *testing.T, mh *MigrationHelperMock, def model.Verification) *model.MigrationMetadata {
+		job := NewVerifyMigration(mh.Environment, def).(*verifyMigrationJob)
+		job.MigrationHelper = mh
+		job.Run(ctx)
+		assert.True(t, job.Status().Completed)
+
+		require.Len(t, mh.MigrationEvents, 1)
+		meta := mh.MigrationEvents[0]
+		assert.Equal(t, "migration.verify", meta.ID)
+		assert.Equal(t, "migration", meta.Migration)
+		assert.True(t, meta.Verification)
+		assert.Equal(t, job.HasErrors(), meta.HasErrors)
+		return meta
+	}
+
+	t.Run("Factory", func(t *testing.T) {
+		job, ok := factory().(*verifyMigrationJob)
+		require.True(t, ok)
+		assert.Equal(t, jobTypeName, job.Type().Name)
+	})
+	t.Run("GeneratorVerification", func(t *testing.T) {
+		assert.Nil(t, generatorVerification("migration", ns, nil, true))
+		assert.Equal(t, &model.Verification{Migration: "migration", Namespace: ns, Query: query, Name: "check", Partial: true},
+			generatorVerification("migration", ns, &model.VerifyOptions{Query: query, Name: "check"}, true))
+	})
+	t.Run("QueryPasses", func(t *testing.T) {
+		_, mh, coll := setup(t)
+		meta := run(t, mh, model.Verification{Migration: "migration", Namespace: ns, Query: query})
+		assert.False(t, meta.HasErrors)
+		assert.Equal(t, []interface{}{bson.M(query)}, coll.Counts)
+	})
+	t.Run("QueryFails", func(t *testing.T) {
+		_, mh, coll := setup(t)
+		coll.CountResult = 2
+		meta := run(t, mh, model.Verification{Migration: "migration", Namespace: ns, Query: query})
+		assert.True(t, meta.HasErrors)
+		require.Len(t, meta.Errors, 1)
+		assert.Contains(t, meta.Errors[0], "2 documents match the verification query")
+	})
+	t.Run("Partial", func(t *testing.T) {
+		env, mh, coll := setup(t)
+		mh.GetMigrationEventsIter = &cursorMigrationMetadataIterator{
+			catcher: grip.NewBasicCatcher(),
+			cursor: &mock.Cursor{
+				ShouldIter:   true,
+				MaxNextCalls: 3,
+				Results: []interface{}{
+					&model.MigrationMetadata{ID: "migration.1.0", Migration: "migration", Target: 1, Completed: true},
+					&model.MigrationMetadata{ID: "migration.batch.2", Migration: "migration", Targets: []interface{}{2, 3}, Completed: true},
+				},
+			},
+		}
+
+		var ids []interface{}
+		require.NoError(t, env.RegisterVerification("check", func(_ context.Context, _ client.Client, _ model.Namespace, in []interface{}) error {
+			ids = in
+			return nil
+		}))
+
+		meta := run(t, mh, model.Verification{Migration: "migration", Namespace: ns, Query: query, Name: "check", Partial: true})
+		assert.False(t, meta.HasErrors)
+		assert.Equal(t, []interface{}{1, 2, 3}, ids)
+		assert.Equal(t, []interface{}{bson.M{"$and": []interface{}{query, bson.M{"_id": bson.M{"$in": ids}}}}}, coll.Counts)
+	})
+	t.Run("NamedFails", func(t *testing.T) {
+		env, mh, coll := setup(t)
+		var ids []interface{}
+		require.NoError(t, env.RegisterVerification("check", func(_ context.Context, _ client.Client, in model.Namespace, docs []interface{}) error {
+			assert.Equal(t, ns, in)
+			ids = docs
+			return errors.New("documents are wrong")
+		}))
+
+		meta := run(t, mh, model.Verification{Migration: "migration", Namespace: ns, Name: "check"})
+		assert.True(t, meta.HasErrors)
+		require.Len(t, meta.Errors, 1)
+		assert.Contains(t, meta.Errors[0], "running verification 'check': documents are wrong")
+		assert.Nil(t, ids)
+		assert.Empty(t, coll.Counts)
+	})
+	t.Run("NamedMissing", func(t *testing.T) {
+		_, mh, _ := setup(t)
+		meta := run(t, mh, model.Verification{Migration: "migration", Namespace: ns, Name: "check"})
+		assert.True(t, meta.HasErrors)
+		assert.Contains(t, meta.Errors[0], "could not find verification named 'check'")
+	})
+}
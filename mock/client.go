@@ -8,6 +8,7 @@ import (
 	"github.com/mongodb/anser/client"
 	"github.com/mongodb/grip"
 	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -43,6 +44,7 @@ func (c *Client) ListDatabaseNames(ctx context.Context, query interface{}) ([]st
 type Database struct {
 	DBName      string
 	Collections map[string]*Collection
+	Commands    map[string]*SingleResult
 }
 
 func (d *Database) Name() string { return d.DBName }
@@ -58,7 +60,39 @@ func (d *Database) Collection(name string) client.Collection {
 	return d.Collections[name]
 }
 
-func (d *Database) RunCommand(ctx context.Context, cmd interface{}) client.SingleResult { return nil }
+// RunCommand returns the result in Commands for the name of the
+// command, which is the first key of the command document, or an
+// empty result if there is none.
+func (d *Database) RunCommand(ctx context.Context, cmd interface{}) client.SingleResult {
+	if res, ok := d.Commands[commandName(cmd)]; ok {
+		return res
+	}
+
+	return NewSingleResult()
+}
+
+func commandName(cmd interface{}) string {
+	switch c := cmd.(type) {
+	case bson.D:
+		if len(c) > 0 {
+			return c[0].Key
+		}
+	case bson.M:
+		for k := range c {
+			return k
+		}
+	case map[string]interface{}:
+		for k := range c {
+			return k
+		}
+	case *birch.Document:
+		if c.Len() > 0 {
+			return c.ElementAt(0).Key()
+		}
+	}
+
+	return ""
+}
 
 func (d *Database) RunCommandCursor(ctx context.Context, cmd interface{}) (client.Cursor, error) {
 	return &Cursor{}, nil
@@ -67,18 +101,67 @@ func (d *Database) RunCommandCursor(ctx context.Context, cmd interface{}) (clien
 type Collection struct {
 	CollName         string
 	UpdateResult     client.UpdateResult
+	UpdateError      error
+	Updates          []interface{}
 	SingleResult     *SingleResult
 	InsertManyResult client.InsertManyResult
 	InsertOneResult  client.InsertOneResult
+	BulkWriteResult  client.BulkWriteResult
+	BulkWriteModels  []client.WriteModel
+	BulkWriteError   error
+	CountResult      int64
+	CountError       error
+	Counts           []interface{}
+	DeleteResult     client.DeleteResult
+	DeleteError      error
+	Deletes          []interface{}
+	FindCursor       *Cursor
+	AggregateCursor  *Cursor
+	AggregateError   error
 	FindError        error
+	Pipelines        []interface{}
+	ChangeStream     *ChangeStream
+	WatchError       error
+	WatchPipelines   []interface{}
+	WatchOptions     []*options.ChangeStreamOptions
 }
 
 func (c *Collection) Name() string { return c.CollName }
 func (c *Collection) Aggregate(ctx context.Context, pipe interface{}, opts ...*options.AggregateOptions) (client.Cursor, error) {
+	c.Pipelines = append(c.Pipelines, pipe)
+	if c.AggregateError != nil {
+		return nil, c.AggregateError
+	}
+	if c.AggregateCursor != nil {
+		return c.AggregateCursor, nil
+	}
+
 	return &Cursor{}, nil
 }
 
+func (c *Collection) BulkWrite(ctx context.Context, models []client.WriteModel, opts ...*options.BulkWriteOptions) (*client.BulkWriteResult, error) {
+	c.BulkWriteModels = models
+	return &c.BulkWriteResult, c.BulkWriteError
+}
+
+func (c *Collection) CountDocuments(ctx context.Context, query interface{}, opts ...*options.CountOptions) (int64, error) {
+	c.Counts = append(c.Counts, query)
+	return c.CountResult, c.CountError
+}
+
+func (c *Collection) DeleteMany(ctx context.Context, query interface{}, opts ...*options.DeleteOptions) (*client.DeleteResult, error) {
+	c.Deletes = append(c.Deletes, query)
+	if c.DeleteError != nil {
+		return nil, c.DeleteError
+	}
+	return &c.DeleteResult, nil
+}
+
 func (c *Collection) Find(ctx context.Context, query interface{}, opts ...*options.FindOptions) (client.Cursor, error) {
+	if c.FindCursor != nil {
+		return c.FindCursor, c.FindError
+	}
+
 	return &Cursor{}, c.FindError
 }
 
@@ -95,17 +178,41 @@ func (c *Collection) InsertMany(ctx context.Context, docs []interface{}) (*clien
 }
 
 func (c *Collection) ReplaceOne(ctx context.Context, query, update interface{}, opts ...*options.ReplaceOptions) (*client.UpdateResult, error) {
+	c.Updates = append(c.Updates, update)
+	if c.UpdateError != nil {
+		return nil, c.UpdateError
+	}
 	return &c.UpdateResult, nil
 }
 
 func (c *Collection) UpdateOne(ctx context.Context, query, update interface{}, opts ...*options.UpdateOptions) (*client.UpdateResult, error) {
+	c.Updates = append(c.Updates, update)
+	if c.UpdateError != nil {
+		return nil, c.UpdateError
+	}
 	return &c.UpdateResult, nil
 }
 
 func (c *Collection) UpdateMany(ctx context.Context, query, update interface{}, opts ...*options.UpdateOptions) (*client.UpdateResult, error) {
+	c.Updates = append(c.Updates, update)
+	if c.UpdateError != nil {
+		return nil, c.UpdateError
+	}
 	return &c.UpdateResult, nil
 }
 
+func (c *Collection) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (client.ChangeStream, error) {
+	c.WatchPipelines = append(c.WatchPipelines, pipeline)
+	c.WatchOptions = append(c.WatchOptions, opts...)
+	if c.WatchError != nil {
+		return nil, c.WatchError
+	}
+	if c.ChangeStream == nil {
+		c.ChangeStream = &ChangeStream{}
+	}
+	return c.ChangeStream, nil
+}
+
 type Cursor struct {
 	ShouldIter     bool
 	CurrentValue   []byte
@@ -148,6 +255,44 @@ func (c *Cursor) Next(ctx context.Context) bool {
 	return false
 }
 
+// ChangeStream returns each of its Events once, from either Next or
+// TryNext, and then reports that there are no more events.
+type ChangeStream struct {
+	Events      []interface{}
+	CloseError  error
+	DecodeError error
+	ErrError    error
+	StreamID    int64
+	Closed      bool
+	position    int
+}
+
+func (s *ChangeStream) Close(ctx context.Context) error { s.Closed = true; return s.CloseError }
+func (s *ChangeStream) Err() error                      { return s.ErrError }
+func (s *ChangeStream) ID() int64                       { return s.StreamID }
+func (s *ChangeStream) Next(ctx context.Context) bool   { return s.TryNext(ctx) }
+func (s *ChangeStream) TryNext(ctx context.Context) bool {
+	if s.Closed || s.position >= len(s.Events) {
+		return false
+	}
+
+	s.position++
+	return true
+}
+func (s *ChangeStream) Decode(in interface{}) error {
+	if s.DecodeError != nil {
+		return s.DecodeError
+	}
+
+	if s.position == 0 {
+		return errors.New("no events")
+	}
+
+	reflect.ValueOf(in).Elem().Set(reflect.ValueOf(s.Events[s.position-1]).Elem())
+
+	return nil
+}
+
 type SingleResult struct {
 	DecodeError      error
 	DecodeBytesError error
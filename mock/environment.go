@@ -1,6 +1,7 @@
 package mock
 
 import (
+	"github.com/evergreen-ci/birch"
 	"github.com/mongodb/amboy"
 	"github.com/mongodb/amboy/dependency"
 	"github.com/mongodb/anser/client"
@@ -28,7 +29,11 @@ type Environment struct {
 	Closers            []func() error
 	DependencyManagers map[string]*DependencyManager
 	MigrationRegistry  map[string]client.MigrationOperation
+	ParamsRegistry     map[string]client.ParameterizedMigrationOperation
 	ProcessorRegistry  map[string]client.Processor
+	VerifyRegistry     map[string]client.Verification
+	LoadSource         client.LoadSource
+	LoadSourceError    error
 	MetaNS             model.Namespace
 }
 
@@ -38,7 +43,9 @@ func NewEnvironment() *Environment {
 		Network:            NewDependencyNetwork(),
 		DependencyManagers: make(map[string]*DependencyManager),
 		MigrationRegistry:  make(map[string]client.MigrationOperation),
+		ParamsRegistry:     make(map[string]client.ParameterizedMigrationOperation),
 		ProcessorRegistry:  make(map[string]client.Processor),
+		VerifyRegistry:     make(map[string]client.Verification),
 	}
 }
 
@@ -100,10 +107,36 @@ func (e *Environment) RegisterManualMigrationOperation(name string, op client.Mi
 }
 
 func (e *Environment) GetManualMigrationOperation(name string) (client.MigrationOperation, bool) {
+	if op, ok := e.ParamsRegistry[name]; ok {
+		return func(cl client.Client, doc *birch.Document) error { return op(cl, doc, nil) }, true
+	}
+
 	op, ok := e.MigrationRegistry[name]
 	return op, ok
 }
 
+func (e *Environment) RegisterParameterizedMigrationOperation(name string, op client.ParameterizedMigrationOperation) error {
+	if _, ok := e.ParamsRegistry[name]; ok {
+		return errors.Errorf("migration operation '%s' already exists", name)
+	}
+
+	e.ParamsRegistry[name] = op
+	return nil
+}
+
+func (e *Environment) GetParameterizedMigrationOperation(name string) (client.ParameterizedMigrationOperation, bool) {
+	if op, ok := e.ParamsRegistry[name]; ok {
+		return op, true
+	}
+
+	op, ok := e.MigrationRegistry[name]
+	if !ok {
+		return nil, false
+	}
+
+	return func(cl client.Client, doc *birch.Document, _ map[string]string) error { return op(cl, doc) }, true
+}
+
 func (e *Environment) RegisterDocumentProcessor(name string, docp client.Processor) error {
 	if _, ok := e.ProcessorRegistry[name]; ok {
 		return errors.Errorf("document processor '%s' already registered", name)
@@ -118,6 +151,34 @@ func (e *Environment) GetDocumentProcessor(name string) (client.Processor, bool)
 	return docp, ok
 }
 
+func (e *Environment) RegisterVerification(name string, fn client.Verification) error {
+	if _, ok := e.VerifyRegistry[name]; ok {
+		return errors.Errorf("verification '%s' already registered", name)
+	}
+
+	e.VerifyRegistry[name] = fn
+	return nil
+}
+
+func (e *Environment) GetVerification(name string) (client.Verification, bool) {
+	fn, ok := e.VerifyRegistry[name]
+	return fn, ok
+}
+
+func (e *Environment) SetLoadSource(src client.LoadSource) { e.LoadSource = src }
+
+func (e *Environment) GetLoadSource() (client.LoadSource, error) {
+	if e.LoadSourceError != nil {
+		return nil, e.LoadSourceError
+	}
+
+	if e.LoadSource == nil {
+		return nil, errors.New("no load source defined")
+	}
+
+	return e.LoadSource, nil
+}
+
 func (e *Environment) MetadataNamespace() model.Namespace { return e.MetaNS }
 
 func (e *Environment) NewDependencyManager(n string) dependency.Manager {
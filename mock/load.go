@@ -0,0 +1,42 @@
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mongodb/anser/model"
+)
+
+// LoadSource is a client.LoadSource that reports a fixed load, which
+// tests can change while migrations run.
+type LoadSource struct {
+	mu    sync.Mutex
+	Load  model.ClusterLoad
+	Error error
+	Calls int
+}
+
+func (s *LoadSource) ClusterLoad(_ context.Context) (model.ClusterLoad, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Calls++
+	return s.Load, s.Error
+}
+
+// SetLoad changes the load that the source reports.
+func (s *LoadSource) SetLoad(load model.ClusterLoad) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Load = load
+}
+
+// NumCalls returns the number of times that the source reported the
+// load.
+func (s *LoadSource) NumCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Calls
+}
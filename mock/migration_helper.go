@@ -1,6 +1,8 @@
 package mock
 
 import (
+	"time"
+
 	"github.com/mongodb/amboy/job"
 	"github.com/mongodb/anser/db"
 	"github.com/mongodb/anser/model"
@@ -20,14 +22,19 @@ type MigrationHelper struct {
 func (m *MigrationHelper) Env() Environment { return m.Environment }
 
 func (m *MigrationHelper) FinishMigration(name string, j *job.Base) {
+	m.FinishMigrationWithMetadata(&model.MigrationMetadata{Migration: name}, j)
+}
+
+func (m *MigrationHelper) FinishMigrationWithMetadata(meta *model.MigrationMetadata, j *job.Base) {
 	j.MarkComplete()
-	meta := model.MigrationMetadata{
-		ID:        j.ID(),
-		Migration: name,
-		HasErrors: j.HasErrors(),
-		Completed: true,
-	}
-	err := m.SaveMigrationEvent(&meta)
+	meta.ID = j.ID()
+	meta.HasErrors = j.HasErrors()
+	meta.Errors = j.Status().Errors
+	meta.Completed = true
+	meta.StartedAt = j.TimeInfo().Start
+	meta.CompletedAt = time.Now()
+
+	err := m.SaveMigrationEvent(meta)
 	if err != nil {
 		j.AddError(err)
 		grip.Warning(message.WrapError(err, "saving migration metadata"))
@@ -35,3 +35,20 @@ func (p *Processor) Migrate(cursor client.Cursor) error {
 
 	return p.MigrateError
 }
+
+// ParameterizedProcessor is a Processor that records the params that
+// migrations configure it with.
+type ParameterizedProcessor struct {
+	Processor
+	Params      map[string]string
+	ParamsError error
+}
+
+func (p *ParameterizedProcessor) WithParams(params map[string]string) (client.Processor, error) {
+	if p.ParamsError != nil {
+		return nil, p.ParamsError
+	}
+
+	p.Params = params
+	return p, nil
+}
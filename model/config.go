@@ -12,17 +12,57 @@ type Configuration struct {
 }
 
 // ApplicationOptions define aspects of the application's behavior as
-// a whole.
+// a whole. Generators that add jobs to the queue while they run, such
+// as generators with a batch size or checkpoints, apply the Limit to
+// each generator rather than to the application as a whole.
+//
+// When VerifyPending is set, the application counts the documents
+// that match each generator's query before running the migrations,
+// and fails if any documents still match after the migrations
+// complete. This is only useful for migrations that modify documents
+// so that they no longer match the query, and is skipped when the
+// application has a Limit.
+//
+// During a dry run, the application evaluates simple migrations with
+// read-only aggregations instead of updating the matching documents,
+// and reports the changes that the migrations would make. When
+// DryRunReport is set, the report is written to that file.
+//
+// When Lock is set, the application holds a lease in the metadata
+// database while it runs or rolls back migrations, so that only one
+// application runs against a cluster at a time.
 type ApplicationOptions struct {
-	DryRun bool `bson:"dry_run" json:"dry_run" yaml:"dry_run"`
-	Limit  int  `bson:"limit" json:"limit" yaml:"limit"`
+	DryRun        bool         `bson:"dry_run" json:"dry_run" yaml:"dry_run"`
+	DryRunReport  string       `bson:"dry_run_report,omitempty" json:"dry_run_report,omitempty" yaml:"dry_run_report,omitempty"`
+	Limit         int          `bson:"limit" json:"limit" yaml:"limit"`
+	VerifyPending bool         `bson:"verify_pending,omitempty" json:"verify_pending,omitempty" yaml:"verify_pending,omitempty"`
+	Lock          *LockOptions `bson:"lock,omitempty" json:"lock,omitempty" yaml:"lock,omitempty"`
 }
 
+// LockOptions configure the lease that prevents applications from
+// running at the same time. Applications that use the same Name
+// exclude each other; the Name defaults to "anser". The lease expires
+// TTLSeconds (default 60) after the application last renewed it, so
+// that a crashed application does not hold the lease forever; running
+// applications renew the lease several times per TTL. If the lease is
+// held, the application waits up to WaitSeconds for it to be
+// released, and fails immediately if WaitSeconds is 0.
+type LockOptions struct {
+	Name        string `bson:"name,omitempty" json:"name,omitempty" yaml:"name,omitempty"`
+	TTLSeconds  int    `bson:"ttl_secs,omitempty" json:"ttl_secs,omitempty" yaml:"ttl_secs,omitempty"`
+	WaitSeconds int    `bson:"wait_secs,omitempty" json:"wait_secs,omitempty" yaml:"wait_secs,omitempty"`
+}
+
+func (o LockOptions) IsValid() bool { return o.TTLSeconds >= 0 && o.WaitSeconds >= 0 }
+
 // ConfigurationSimpleMigrations defines a migration that provides, in
-// essence a single-document update as the migration.
+// essence a single-document update as the migration. The update is
+// either an Update document of update operators or an update
+// Pipeline of aggregation stages; exactly one must be set.
 type ConfigurationSimpleMigration struct {
-	Options GeneratorOptions       `bson:"options" json:"options" yaml:"options"`
-	Update  map[string]interface{} `bson:"update" json:"update" yaml:"update"`
+	Options  GeneratorOptions         `bson:"options" json:"options" yaml:"options"`
+	Update   map[string]interface{}   `bson:"update" json:"update" yaml:"update"`
+	Pipeline []map[string]interface{} `bson:"pipeline,omitempty" json:"pipeline,omitempty" yaml:"pipeline,omitempty"`
 }
 
 // ConfigurationManualMigrations defines either a stream/manual
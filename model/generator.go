@@ -1,5 +1,11 @@
 package model
 
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
 // GeneratorOptions hold all options common to all generator types,
 // and are used in the configuration of generator functions and their
 // dependency relationships.
@@ -9,24 +15,319 @@ type GeneratorOptions struct {
 	NS        Namespace              `bson:"namespace" json:"namespace" yaml:"namespace"`
 	Query     map[string]interface{} `bson:"query" json:"query" yaml:"query"`
 	Limit     int                    `bson:"limit" json:"limit" yaml:"limit"`
+	// BatchSize, when greater than 0, makes the generator queue its
+	// jobs in batches of BatchSize as it iterates over the documents,
+	// rather than holding every job until it completes.
+	BatchSize int `bson:"batch_size,omitempty" json:"batch_size,omitempty" yaml:"batch_size,omitempty"`
+	// CheckpointInterval, when greater than 0, makes the generator
+	// process documents in _id order, and queue its jobs and record
+	// its position every CheckpointInterval documents, so that it
+	// resumes after its checkpoint when it restarts.
+	CheckpointInterval int `bson:"checkpoint_interval,omitempty" json:"checkpoint_interval,omitempty" yaml:"checkpoint_interval,omitempty"`
+	// BulkWriteSize, when greater than 0, makes simple migrations
+	// update every BulkWriteSize documents with one bulk write, which
+	// is ordered unless BulkWriteUnordered is set.
+	BulkWriteSize      int  `bson:"bulk_write_size,omitempty" json:"bulk_write_size,omitempty" yaml:"bulk_write_size,omitempty"`
+	BulkWriteUnordered bool `bson:"bulk_write_unordered,omitempty" json:"bulk_write_unordered,omitempty" yaml:"bulk_write_unordered,omitempty"`
+	// RateLimit, when set, throttles the generator's migration
+	// operations in each process that runs them.
+	RateLimit *RateLimit       `bson:"rate_limit,omitempty" json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+	Rollback  *RollbackOptions `bson:"rollback,omitempty" json:"rollback,omitempty" yaml:"rollback,omitempty"`
+	// Canary, when set, limits the generator to a sample of the
+	// documents that match its query.
+	Canary *Canary `bson:"canary,omitempty" json:"canary,omitempty" yaml:"canary,omitempty"`
+	// Verify, when set, checks the migrated documents after the
+	// generator's operations complete.
+	Verify *VerifyOptions `bson:"verify,omitempty" json:"verify,omitempty" yaml:"verify,omitempty"`
+	// Snapshot, when set, saves a copy of each document before a
+	// manual or stream migration changes it.
+	Snapshot *SnapshotOptions `bson:"snapshot,omitempty" json:"snapshot,omitempty" yaml:"snapshot,omitempty"`
+	// Backup, when set, backs up the documents that the generator
+	// will migrate before it produces any operations.
+	Backup *BackupOptions `bson:"backup,omitempty" json:"backup,omitempty" yaml:"backup,omitempty"`
+	// Continuous, when set, keeps the generator producing operations
+	// for documents that change to match its query after its first
+	// pass, until it is stopped or reaches its cutover.
+	Continuous *ContinuousOptions `bson:"continuous,omitempty" json:"continuous,omitempty" yaml:"continuous,omitempty"`
 }
 
 func (o GeneratorOptions) IsValid() bool {
-	if !o.NS.IsValid() {
+	// it might be reasonable to require that there be a query,
+	// but you could use a generator to modify every document in the
+	// collection, so we'll leave it off for now.
+
+	return len(o.Problems()) == 0
+}
+
+// OptionProblem describes an invalid generator option, by the name of
+// the field in configuration files.
+type OptionProblem struct {
+	Field   string
+	Message string
+}
+
+// Problems explains why the options are not valid, and returns an
+// empty slice when they are.
+func (o GeneratorOptions) Problems() []OptionProblem {
+	checks := []struct {
+		invalid bool
+		OptionProblem
+	}{
+		{o.JobID == "", OptionProblem{"id", "must be set"}},
+		{!o.NS.IsValid(), OptionProblem{"namespace", "must have a database and a collection"}},
+		{o.Limit < 0, OptionProblem{"limit", "cannot be negative"}},
+		{o.BatchSize < 0, OptionProblem{"batch_size", "cannot be negative"}},
+		{o.CheckpointInterval < 0, OptionProblem{"checkpoint_interval", "cannot be negative"}},
+		{o.BulkWriteSize < 0, OptionProblem{"bulk_write_size", "cannot be negative"}},
+		{o.RateLimit != nil && !o.RateLimit.IsValid(), OptionProblem{"rate_limit", "is not valid"}},
+		{o.Canary != nil && !o.Canary.IsValid(), OptionProblem{"canary", "must set either a count or a percent, and a known method"}},
+		{o.Canary != nil && o.CheckpointInterval > 0, OptionProblem{"canary", "cannot be used with checkpoints"}},
+		{o.Verify != nil && !o.Verify.IsValid(), OptionProblem{"verify", "must set a query or the name of a verification"}},
+		{o.Snapshot != nil && !o.Snapshot.IsValid(), OptionProblem{"snapshot", "cannot have a negative ttl"}},
+		{o.Backup != nil && !o.Backup.IsValid(), OptionProblem{"backup", "must set a path"}},
+		{o.Continuous != nil && !o.Continuous.IsValid(), OptionProblem{"continuous", "cannot have negative cutover conditions"}},
+		{o.Continuous != nil && (o.Canary != nil || o.CheckpointInterval > 0 || o.BulkWriteSize > 0), OptionProblem{"continuous", "cannot be used with canaries, checkpoints, or bulk writes"}},
+	}
+
+	out := []OptionProblem{}
+	for _, check := range checks {
+		if check.invalid {
+			out = append(out, check.OptionProblem)
+		}
+	}
+
+	return out
+}
+
+// RollbackOptions describe how to undo the migrations produced by a
+// generator. Simple migrations use the Update document, which is
+// applied to every document that the migration modified. Manual and
+// stream migrations use the Name of a registered MigrationOperation
+// or Processor (respectively) that reverses the migration.
+type RollbackOptions struct {
+	Update map[string]interface{} `bson:"update,omitempty" json:"update,omitempty" yaml:"update,omitempty"`
+	Name   string                 `bson:"name,omitempty" json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+// VerifyOptions describe how to check that a generator's migrations
+// left the documents as intended. The verification fails if any
+// document in the generator's namespace matches the Query, or if the
+// registered Verification with the Name returns an error. Set either
+// or both.
+type VerifyOptions struct {
+	Query map[string]interface{} `bson:"query,omitempty" json:"query,omitempty" yaml:"query,omitempty"`
+	Name  string                 `bson:"name,omitempty" json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+func (v VerifyOptions) IsValid() bool { return len(v.Query) > 0 || v.Name != "" }
+
+// SnapshotOptions describe the copies of documents that a migration
+// saves before it changes them. Copies are removed TTLSeconds after
+// the migration saves them, or kept until they are removed by hand if
+// TTLSeconds is 0.
+type SnapshotOptions struct {
+	TTLSeconds int `bson:"ttl_secs,omitempty" json:"ttl_secs,omitempty" yaml:"ttl_secs,omitempty"`
+}
+
+func (s SnapshotOptions) IsValid() bool { return s.TTLSeconds >= 0 }
+
+// BackupOptions describe the backup that a generator takes of the
+// documents that it will migrate, in a new directory within Path for
+// each run. Compress compresses the backup's files with gzip.
+type BackupOptions struct {
+	Path     string `bson:"path" json:"path" yaml:"path"`
+	Compress bool   `bson:"compress,omitempty" json:"compress,omitempty" yaml:"compress,omitempty"`
+}
+
+func (b BackupOptions) IsValid() bool { return b.Path != "" }
+
+// ContinuousOptions describe the cutover of a continuous generator,
+// which stops watching for changes to documents when it has watched
+// for DurationSeconds, when IdleSeconds pass without a change to a
+// matching document, or when it has produced operations for
+// MaxDocuments changed documents, whichever comes first. Conditions
+// that are 0 do not apply; without any, the generator runs until it
+// is stopped.
+type ContinuousOptions struct {
+	DurationSeconds int `bson:"duration_secs,omitempty" json:"duration_secs,omitempty" yaml:"duration_secs,omitempty"`
+	IdleSeconds     int `bson:"idle_secs,omitempty" json:"idle_secs,omitempty" yaml:"idle_secs,omitempty"`
+	MaxDocuments    int `bson:"max_documents,omitempty" json:"max_documents,omitempty" yaml:"max_documents,omitempty"`
+}
+
+func (c ContinuousOptions) IsValid() bool {
+	return c.DurationSeconds >= 0 && c.IdleSeconds >= 0 && c.MaxDocuments >= 0
+}
+
+// CanaryMethod names a way of selecting the documents of a canary.
+type CanaryMethod string
+
+const (
+	// CanaryMethodSample selects random documents with $sample,
+	// which can select a document more than once, so the canary
+	// may have fewer documents than its size.
+	CanaryMethodSample CanaryMethod = "sample"
+	// CanaryMethodHashed selects the documents whose hashed _id
+	// falls in the lowest buckets, so that the sample is spread
+	// evenly across the _id range and repeated canaries select
+	// the same documents.
+	CanaryMethodHashed CanaryMethod = "hashed"
+)
+
+// Canary limits a generator to a sample of the documents that match
+// its query, so that a risky migration can be proven on production
+// data before it migrates every document. The sample holds Count
+// documents, or Percent percent of the matching documents; set
+// exactly one of them. The Method defaults to CanaryMethodSample.
+// Hashed samples of a Count are approximate, because the size of
+// each bucket depends on the documents' _id values. Generators with
+// canaries cannot use checkpoints.
+type Canary struct {
+	Count   int          `bson:"count,omitempty" json:"count,omitempty" yaml:"count,omitempty"`
+	Percent float64      `bson:"percent,omitempty" json:"percent,omitempty" yaml:"percent,omitempty"`
+	Method  CanaryMethod `bson:"method,omitempty" json:"method,omitempty" yaml:"method,omitempty"`
+}
+
+func (c Canary) IsValid() bool {
+	if c.Count < 0 || c.Percent < 0 || c.Percent > 100 {
 		return false
 	}
 
-	if o.JobID == "" {
+	if (c.Count > 0) == (c.Percent > 0) {
 		return false
 	}
 
-	if o.Limit < 0 {
+	switch c.Method {
+	case "", CanaryMethodSample, CanaryMethodHashed:
+		return true
+	default:
 		return false
 	}
+}
 
-	// it might be reasonable to require that there be a query,
-	// but you could use a generator to modify every document in the
-	// collection, so we'll leave it off for now.
+// Size returns the number of documents in the sample, when total
+// documents match the generator's query.
+func (c Canary) Size(total int) int {
+	if c.Count > 0 {
+		return c.Count
+	}
+
+	return int(math.Ceil(float64(total) * c.Percent / 100))
+}
+
+// RateLimit describes limits on the throughput of a migration, so
+// that migrations can run against a cluster that serves production
+// traffic. DocumentsPerSecond limits the rate at which the
+// migration's operations process documents, and WritesPerSecond
+// limits the rate of the writes that they issue (each document of a
+// bulk write counts as a write). MaxConcurrentJobs limits the number
+// of the migration's operations that run at the same time. Zero
+// values do not limit the migration.
+//
+// The limits are enforced within each process, for each environment,
+// rather than across all of the workers of a migration: processes
+// that share a queue each allow the migration the full rates and
+// number of jobs. Operations wait for their turn inside the queue's
+// worker goroutines, so under a low MaxConcurrentJobs, a migration's
+// waiting operations can occupy every worker of the queue and starve
+// the operations of other migrations in the same queue.
+//
+// Backpressure pauses the migration's operations while the cluster is
+// under stress, in addition to these static limits.
+type RateLimit struct {
+	DocumentsPerSecond float64      `bson:"documents_per_second,omitempty" json:"documents_per_second,omitempty" yaml:"documents_per_second,omitempty"`
+	WritesPerSecond    float64      `bson:"writes_per_second,omitempty" json:"writes_per_second,omitempty" yaml:"writes_per_second,omitempty"`
+	MaxConcurrentJobs  int          `bson:"max_concurrent_jobs,omitempty" json:"max_concurrent_jobs,omitempty" yaml:"max_concurrent_jobs,omitempty"`
+	Backpressure       Backpressure `bson:"backpressure,omitempty" json:"backpressure,omitempty" yaml:"backpressure,omitempty"`
+}
+
+func (r RateLimit) IsValid() bool {
+	return r.DocumentsPerSecond >= 0 && r.WritesPerSecond >= 0 && r.MaxConcurrentJobs >= 0 && r.Backpressure.IsValid()
+}
+
+// IsZero reports if the rate limit does not limit the migration.
+func (r RateLimit) IsZero() bool {
+	return r.DocumentsPerSecond == 0 && r.WritesPerSecond == 0 && r.MaxConcurrentJobs == 0 && r.Backpressure.IsZero()
+}
+
+// Backpressure describes the cluster load above which a migration's
+// operations pause until the load subsides. Migrations pause while
+// the replication lag of any secondary exceeds
+// MaxReplicationLagSeconds, while the fraction of the WiredTiger
+// cache in use (or dirty) exceeds MaxCacheUsedRatio (or
+// MaxCacheDirtyRatio), or while the fraction of failed operations or
+// the average operation latency that the application observes exceed
+// MaxFailureRate or MaxLatencyMS. Zero values disable the
+// corresponding check.
+type Backpressure struct {
+	MaxReplicationLagSeconds float64 `bson:"max_replication_lag_secs,omitempty" json:"max_replication_lag_secs,omitempty" yaml:"max_replication_lag_secs,omitempty"`
+	MaxCacheUsedRatio        float64 `bson:"max_cache_used_ratio,omitempty" json:"max_cache_used_ratio,omitempty" yaml:"max_cache_used_ratio,omitempty"`
+	MaxCacheDirtyRatio       float64 `bson:"max_cache_dirty_ratio,omitempty" json:"max_cache_dirty_ratio,omitempty" yaml:"max_cache_dirty_ratio,omitempty"`
+	MaxFailureRate           float64 `bson:"max_failure_rate,omitempty" json:"max_failure_rate,omitempty" yaml:"max_failure_rate,omitempty"`
+	MaxLatencyMS             float64 `bson:"max_latency_ms,omitempty" json:"max_latency_ms,omitempty" yaml:"max_latency_ms,omitempty"`
+}
+
+func (b Backpressure) IsValid() bool {
+	for _, ratio := range []float64{b.MaxCacheUsedRatio, b.MaxCacheDirtyRatio, b.MaxFailureRate} {
+		if ratio < 0 || ratio > 1 {
+			return false
+		}
+	}
+
+	return b.MaxReplicationLagSeconds >= 0 && b.MaxLatencyMS >= 0
+}
+
+// IsZero reports if the backpressure options do not pause the
+// migration.
+func (b Backpressure) IsZero() bool { return b == Backpressure{} }
+
+// Exceeded returns a description of each limit that the load
+// exceeds, or nil if the load is within all limits.
+func (b Backpressure) Exceeded(load ClusterLoad) []string {
+	var out []string
+
+	if b.MaxReplicationLagSeconds > 0 && load.ReplicationLag.Seconds() > b.MaxReplicationLagSeconds {
+		out = append(out, fmt.Sprintf("replication lag %s exceeds %gs", load.ReplicationLag, b.MaxReplicationLagSeconds))
+	}
+	if b.MaxCacheUsedRatio > 0 && load.CacheUsedRatio > b.MaxCacheUsedRatio {
+		out = append(out, fmt.Sprintf("cache used ratio %.2f exceeds %.2f", load.CacheUsedRatio, b.MaxCacheUsedRatio))
+	}
+	if b.MaxCacheDirtyRatio > 0 && load.CacheDirtyRatio > b.MaxCacheDirtyRatio {
+		out = append(out, fmt.Sprintf("cache dirty ratio %.2f exceeds %.2f", load.CacheDirtyRatio, b.MaxCacheDirtyRatio))
+	}
+	if b.MaxFailureRate > 0 && load.FailureRate > b.MaxFailureRate {
+		out = append(out, fmt.Sprintf("failure rate %.2f exceeds %.2f", load.FailureRate, b.MaxFailureRate))
+	}
+	if b.MaxLatencyMS > 0 && float64(load.Latency)/float64(time.Millisecond) > b.MaxLatencyMS {
+		out = append(out, fmt.Sprintf("latency %s exceeds %gms", load.Latency, b.MaxLatencyMS))
+	}
+
+	return out
+}
+
+// ClusterLoad describes the load on a cluster. ReplicationLag is the
+// largest lag of a secondary behind the primary, CacheUsedRatio and
+// CacheDirtyRatio are the fractions of the WiredTiger cache that are
+// in use and dirty, and FailureRate and Latency are the fraction of
+// failed operations and the average operation latency.
+type ClusterLoad struct {
+	ReplicationLag  time.Duration `bson:"replication_lag" json:"replication_lag" yaml:"replication_lag"`
+	CacheUsedRatio  float64       `bson:"cache_used_ratio" json:"cache_used_ratio" yaml:"cache_used_ratio"`
+	CacheDirtyRatio float64       `bson:"cache_dirty_ratio" json:"cache_dirty_ratio" yaml:"cache_dirty_ratio"`
+	FailureRate     float64       `bson:"failure_rate" json:"failure_rate" yaml:"failure_rate"`
+	Latency         time.Duration `bson:"latency" json:"latency" yaml:"latency"`
+}
+
+// Max returns the larger of each of the loads' signals.
+func (l ClusterLoad) Max(other ClusterLoad) ClusterLoad {
+	if other.ReplicationLag > l.ReplicationLag {
+		l.ReplicationLag = other.ReplicationLag
+	}
+	if other.Latency > l.Latency {
+		l.Latency = other.Latency
+	}
+	l.CacheUsedRatio = math.Max(l.CacheUsedRatio, other.CacheUsedRatio)
+	l.CacheDirtyRatio = math.Max(l.CacheDirtyRatio, other.CacheDirtyRatio)
+	l.FailureRate = math.Max(l.FailureRate, other.FailureRate)
 
-	return true
+	return l
 }
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratorOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	opts := GeneratorOptions{}
+	assert.False(opts.IsValid())
+
+	opts.NS = Namespace{DB: "foo", Collection: "bar"}
+	assert.False(opts.IsValid())
+
+	opts.JobID = "foo"
+	assert.True(opts.IsValid())
+
+	opts.Limit = -1
+	assert.False(opts.IsValid())
+	opts.Limit = 10
+	assert.True(opts.IsValid())
+
+	opts.BatchSize = -1
+	assert.False(opts.IsValid())
+	opts.BatchSize = 1000
+	assert.True(opts.IsValid())
+
+	opts.CheckpointInterval = -1
+	assert.False(opts.IsValid())
+	opts.CheckpointInterval = 100
+	assert.True(opts.IsValid())
+
+	opts.BulkWriteSize = -1
+	assert.False(opts.IsValid())
+	opts.BulkWriteSize = 500
+	assert.True(opts.IsValid())
+
+	opts.RateLimit = &RateLimit{DocumentsPerSecond: -1}
+	assert.False(opts.IsValid())
+	opts.RateLimit = &RateLimit{DocumentsPerSecond: 100, WritesPerSecond: 50, MaxConcurrentJobs: 2}
+	assert.True(opts.IsValid())
+	assert.False(opts.RateLimit.IsZero())
+	assert.True(RateLimit{}.IsZero())
+
+	opts.RateLimit = &RateLimit{Backpressure: Backpressure{MaxCacheUsedRatio: 1.5}}
+	assert.False(opts.IsValid())
+	opts.RateLimit = &RateLimit{Backpressure: Backpressure{MaxReplicationLagSeconds: 10}}
+	assert.True(opts.IsValid())
+	assert.False(opts.RateLimit.IsZero())
+
+	opts.Canary = &Canary{Count: 10}
+	assert.False(opts.IsValid())
+	opts.CheckpointInterval = 0
+	assert.True(opts.IsValid())
+
+	opts.Verify = &VerifyOptions{}
+	assert.False(opts.IsValid())
+	opts.Verify = &VerifyOptions{Name: "check"}
+	assert.True(opts.IsValid())
+	opts.Verify = &VerifyOptions{Query: map[string]interface{}{"a": 1}}
+	assert.True(opts.IsValid())
+
+	opts.Snapshot = &SnapshotOptions{TTLSeconds: -1}
+	assert.False(opts.IsValid())
+	opts.Snapshot = &SnapshotOptions{TTLSeconds: 3600}
+	assert.True(opts.IsValid())
+
+	opts.Backup = &BackupOptions{Compress: true}
+	assert.False(opts.IsValid())
+	opts.Backup = &BackupOptions{Path: "backups", Compress: true}
+	assert.True(opts.IsValid())
+
+	opts.Continuous = &ContinuousOptions{IdleSeconds: -1}
+	assert.False(opts.IsValid())
+	opts.Continuous = &ContinuousOptions{IdleSeconds: 60, MaxDocuments: 1000}
+	assert.False(opts.IsValid())
+	opts.Canary = nil
+	opts.BulkWriteSize = 0
+	assert.True(opts.IsValid())
+	opts.CheckpointInterval = 10
+	assert.False(opts.IsValid())
+	opts.CheckpointInterval = 0
+	opts.BulkWriteSize = 100
+	assert.False(opts.IsValid())
+	opts.BulkWriteSize = 0
+}
+
+func TestCanary(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(Canary{}.IsValid())
+	assert.False(Canary{Count: 10, Percent: 5}.IsValid())
+	assert.False(Canary{Count: -1}.IsValid())
+	assert.False(Canary{Percent: 101}.IsValid())
+	assert.False(Canary{Count: 10, Method: "random"}.IsValid())
+	assert.True(Canary{Count: 10}.IsValid())
+	assert.True(Canary{Percent: 0.5, Method: CanaryMethodHashed}.IsValid())
+	assert.True(Canary{Count: 10, Method: CanaryMethodSample}.IsValid())
+
+	assert.Equal(10, Canary{Count: 10}.Size(1000))
+	assert.Equal(5, Canary{Percent: 0.5}.Size(1000))
+	assert.Equal(1, Canary{Percent: 0.5}.Size(10))
+	assert.Equal(0, Canary{Percent: 0.5}.Size(0))
+}
+
+func TestBackpressureExceeded(t *testing.T) {
+	assert := assert.New(t)
+
+	bp := Backpressure{MaxReplicationLagSeconds: 10, MaxCacheDirtyRatio: 0.2, MaxLatencyMS: 100}
+	assert.Empty(bp.Exceeded(ClusterLoad{}))
+	assert.Empty(bp.Exceeded(ClusterLoad{ReplicationLag: 10 * time.Second, CacheDirtyRatio: 0.2, CacheUsedRatio: 0.99, FailureRate: 1}))
+	assert.Len(bp.Exceeded(ClusterLoad{ReplicationLag: time.Minute}), 1)
+	assert.Len(bp.Exceeded(ClusterLoad{CacheDirtyRatio: 0.3, Latency: time.Second}), 2)
+	assert.Empty(Backpressure{}.Exceeded(ClusterLoad{ReplicationLag: time.Hour, FailureRate: 1}))
+
+	load := ClusterLoad{ReplicationLag: time.Second, FailureRate: 0.5}.Max(ClusterLoad{ReplicationLag: time.Minute, CacheUsedRatio: 0.1})
+	assert.Equal(ClusterLoad{ReplicationLag: time.Minute, CacheUsedRatio: 0.1, FailureRate: 0.5}, load)
+}
@@ -1,12 +1,131 @@
 package model
 
+import "time"
+
 // MigrationMetadata records data about completed migrations.
+// Migrations that operate on a batch of documents record the _id
+// fields of the documents that they updated in Targets, even if they
+// failed, and any errors for individual documents in DocumentErrors.
+// Generators record the number of migration operations they produced
+// in Generated, and the path of the manifest of the backup they took
+// before producing them in Backup.
 type MigrationMetadata struct {
-	ID        string `bson:"_id" json:"id" yaml:"id"`
-	Migration string `bson:"migration" json:"migration" yaml:"migration"`
-	HasErrors bool   `bson:"has_errors" json:"has_errors" yaml:"has_errors"`
-	Completed bool   `bson:"completed" json:"completed" yaml:"completed"`
+	ID             string          `bson:"_id" json:"id" yaml:"id"`
+	Migration      string          `bson:"migration" json:"migration" yaml:"migration"`
+	Target         interface{}     `bson:"target,omitempty" json:"target,omitempty" yaml:"target,omitempty"`
+	Targets        []interface{}   `bson:"targets,omitempty" json:"targets,omitempty" yaml:"targets,omitempty"`
+	DocumentErrors []DocumentError `bson:"document_errors,omitempty" json:"document_errors,omitempty" yaml:"document_errors,omitempty"`
+	Generated      int             `bson:"generated,omitempty" json:"generated,omitempty" yaml:"generated,omitempty"`
+	HasErrors      bool            `bson:"has_errors" json:"has_errors" yaml:"has_errors"`
+	Errors         []string        `bson:"errors,omitempty" json:"errors,omitempty" yaml:"errors,omitempty"`
+	Completed      bool            `bson:"completed" json:"completed" yaml:"completed"`
+	RolledBack     bool            `bson:"rolled_back" json:"rolled_back" yaml:"rolled_back"`
+	StartedAt      time.Time       `bson:"started_at,omitempty" json:"started_at,omitempty" yaml:"started_at,omitempty"`
+	CompletedAt    time.Time       `bson:"completed_at,omitempty" json:"completed_at,omitempty" yaml:"completed_at,omitempty"`
+	Verification   bool            `bson:"verification,omitempty" json:"verification,omitempty" yaml:"verification,omitempty"`
+	Backup         string          `bson:"backup,omitempty" json:"backup,omitempty" yaml:"backup,omitempty"`
+}
+
+// DocumentError records the error from migrating a single document.
+type DocumentError struct {
+	ID    interface{} `bson:"id" json:"id" yaml:"id"`
+	Error string      `bson:"error" json:"error" yaml:"error"`
+}
+
+// Satisfies reports if a migration has completed without errors and
+// has not been rolled back.
+func (m *MigrationMetadata) Satisfied() bool { return m.Completed && !m.HasErrors && !m.RolledBack }
+
+// GeneratorCheckpoint records how far a generator has progressed
+// through the documents that match its query, in _id order, so that
+// a generator that restarts can resume after the last document it
+// processed rather than scanning the whole collection again. Backup is
+// the path of the manifest of the backup that the generator took on
+// its first run, if any.
+type GeneratorCheckpoint struct {
+	ID        string      `bson:"_id" json:"id" yaml:"id"`
+	Generator string      `bson:"generator" json:"generator" yaml:"generator"`
+	LastID    interface{} `bson:"last_id" json:"last_id" yaml:"last_id"`
+	Count     int         `bson:"count" json:"count" yaml:"count"`
+	Generated int         `bson:"generated" json:"generated" yaml:"generated"`
+	Backup    string      `bson:"backup,omitempty" json:"backup,omitempty" yaml:"backup,omitempty"`
+}
+
+// GeneratorCheckpointJobs records the IDs of the jobs that a generator
+// added to the queue between two of its checkpoints, where Count is
+// the count of the later checkpoint. A generator that resumes from a
+// checkpoint adds these IDs back to its group in the dependency
+// network, so that migrations that depend on the generator also wait
+// for the jobs that it added before it resumed.
+type GeneratorCheckpointJobs struct {
+	ID        string   `bson:"_id" json:"id" yaml:"id"`
+	Generator string   `bson:"generator" json:"generator" yaml:"generator"`
+	Count     int      `bson:"count" json:"count" yaml:"count"`
+	Jobs      []string `bson:"jobs" json:"jobs" yaml:"jobs"`
 }
 
-// Satisfies reports if a migration has completed without errors.
-func (m *MigrationMetadata) Satisfied() bool { return m.Completed && !m.HasErrors }
+// MigrationStatus summarizes the progress of a migration, based on the
+// metadata that its generator and migration operations recorded.
+// Generated is the number of migration operations that the generator
+// produced, and Pending is the number of those operations that have
+// not recorded their completion. StartedAt and CompletedAt hold the
+// earliest start and the latest completion of the generator and its
+// operations; CompletedAt is only set when there are no pending
+// operations. Errors holds the errors of the failed operations, each
+// prefixed with the ID of the operation. Verification holds the
+// result of the migration's verification, if it has one and the
+// verification has run.
+type MigrationStatus struct {
+	Migration          string             `bson:"migration" json:"migration" yaml:"migration"`
+	GeneratorCompleted bool               `bson:"generator_completed" json:"generator_completed" yaml:"generator_completed"`
+	Generated          int                `bson:"generated" json:"generated" yaml:"generated"`
+	Completed          int                `bson:"completed" json:"completed" yaml:"completed"`
+	Failed             int                `bson:"failed" json:"failed" yaml:"failed"`
+	Pending            int                `bson:"pending" json:"pending" yaml:"pending"`
+	RolledBack         int                `bson:"rolled_back" json:"rolled_back" yaml:"rolled_back"`
+	StartedAt          time.Time          `bson:"started_at,omitempty" json:"started_at,omitempty" yaml:"started_at,omitempty"`
+	CompletedAt        time.Time          `bson:"completed_at,omitempty" json:"completed_at,omitempty" yaml:"completed_at,omitempty"`
+	Errors             []string           `bson:"errors,omitempty" json:"errors,omitempty" yaml:"errors,omitempty"`
+	Verification       VerificationResult `bson:"verification,omitempty" json:"verification,omitempty" yaml:"verification,omitempty"`
+}
+
+// VerificationResult describes the outcome of a migration's
+// verification.
+type VerificationResult string
+
+const (
+	VerificationPassed VerificationResult = "passed"
+	VerificationFailed VerificationResult = "failed"
+)
+
+// MigrationState describes the stage of a migration's progress.
+type MigrationState string
+
+const (
+	MigrationStatePending    MigrationState = "pending"
+	MigrationStateGenerating MigrationState = "generating"
+	MigrationStateRunning    MigrationState = "running"
+	MigrationStateCompleted  MigrationState = "completed"
+	MigrationStateFailed     MigrationState = "failed"
+	MigrationStateRolledBack MigrationState = "rolled-back"
+)
+
+// State returns the stage of the migration's progress. Migrations
+// that have not started are pending, and migrations with any failed
+// operations or a failed verification have failed.
+func (s MigrationStatus) State() MigrationState {
+	switch {
+	case s.Failed > 0 || s.Verification == VerificationFailed:
+		return MigrationStateFailed
+	case s.RolledBack > 0 && s.RolledBack >= s.Completed:
+		return MigrationStateRolledBack
+	case !s.GeneratorCompleted && s.StartedAt.IsZero():
+		return MigrationStatePending
+	case !s.GeneratorCompleted:
+		return MigrationStateGenerating
+	case s.Pending > 0:
+		return MigrationStateRunning
+	default:
+		return MigrationStateCompleted
+	}
+}
@@ -18,6 +18,12 @@ type Simple struct {
 	// bson.M
 	Update map[string]interface{} `bson:"update" json:"update" yaml:"update"`
 
+	// Pipeline is an update pipeline, an ordered list of
+	// aggregation stages (e.g. $set, $unset, and $replaceWith)
+	// that can compute new values from the document's existing
+	// fields. When set, it is used instead of Update.
+	Pipeline []map[string]interface{} `bson:"pipeline,omitempty" json:"pipeline,omitempty" yaml:"pipeline,omitempty"`
+
 	// Migration holds the ID of the migration operation,
 	// typically the name of the class of migration and
 	Migration string `bson:"migration_id" json:"migration_id" yaml:"migration_id"`
@@ -25,6 +31,43 @@ type Simple struct {
 	// Namespace holds a struct that describes which database and
 	// collection where the migration should run
 	Namespace Namespace `bson:"namespace" json:"namespace" yaml:"namespace"`
+
+	// RateLimit holds the throughput limits of the migration, which
+	// are shared by all of its operations.
+	RateLimit *RateLimit `bson:"rate_limit,omitempty" json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+}
+
+// SimpleBatch defines an operation that applies the same update to a
+// batch of documents in one collection, using a single bulk write
+// rather than one update per document.
+type SimpleBatch struct {
+	// IDs holds the _id fields of the documents that are the
+	// subject of the migration.
+	IDs []interface{} `bson:"ids" json:"ids" yaml:"ids"`
+
+	// Update is a specification for the update operation, which
+	// is applied to each document.
+	Update map[string]interface{} `bson:"update" json:"update" yaml:"update"`
+
+	// Pipeline is an update pipeline that is applied to each
+	// document. When set, it is used instead of Update.
+	Pipeline []map[string]interface{} `bson:"pipeline,omitempty" json:"pipeline,omitempty" yaml:"pipeline,omitempty"`
+
+	// Unordered allows the server to apply the updates in any
+	// order, and to continue applying updates after one fails.
+	Unordered bool `bson:"unordered" json:"unordered" yaml:"unordered"`
+
+	// Migration holds the ID of the migration operation,
+	// typically the name of the class of migration and
+	Migration string `bson:"migration_id" json:"migration_id" yaml:"migration_id"`
+
+	// Namespace holds a struct that describes which database and
+	// collection where the migration should run
+	Namespace Namespace `bson:"namespace" json:"namespace" yaml:"namespace"`
+
+	// RateLimit holds the throughput limits of the migration, which
+	// are shared by all of its operations.
+	RateLimit *RateLimit `bson:"rate_limit,omitempty" json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
 }
 
 // MigrationDefinitionManual defines an operations that runs an arbitrary
@@ -45,6 +88,18 @@ type Manual struct {
 	// Namespace holds a struct that describes which database and
 	// collection where the query for the input document should run.
 	Namespace Namespace `bson:"namespace" json:"namespace" yaml:"namespace"`
+
+	// RateLimit holds the throughput limits of the migration, which
+	// are shared by all of its operations.
+	RateLimit *RateLimit `bson:"rate_limit,omitempty" json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+
+	// Params holds the settings of the migration from its
+	// configuration, which are passed to the operation.
+	Params map[string]string `bson:"params,omitempty" json:"params,omitempty" yaml:"params,omitempty"`
+
+	// Snapshot, when set, saves a copy of each document in the
+	// metadata database before the migration changes it.
+	Snapshot *SnapshotOptions `bson:"snapshot,omitempty" json:"snapshot,omitempty" yaml:"snapshot,omitempty"`
 }
 
 // MigrationDefinitionStream is a migration definition form that has, that can
@@ -66,4 +121,86 @@ type Stream struct {
 	// Namespace holds a struct that describes which database and
 	// collection where the query for the input document should run.
 	Namespace Namespace `bson:"namespace" json:"namespace" yaml:"namespace"`
+
+	// RateLimit holds the throughput limits of the migration, which
+	// are shared by all of its operations.
+	RateLimit *RateLimit `bson:"rate_limit,omitempty" json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+
+	// Params holds the settings of the migration from its
+	// configuration, which are passed to the processor.
+	Params map[string]string `bson:"params,omitempty" json:"params,omitempty" yaml:"params,omitempty"`
+
+	// Snapshot, when set, saves a copy of each document in the
+	// metadata database before the migration changes it.
+	Snapshot *SnapshotOptions `bson:"snapshot,omitempty" json:"snapshot,omitempty" yaml:"snapshot,omitempty"`
+}
+
+// Rollback defines an operation that undoes a completed migration,
+// either by applying an inverse update to a single document, by
+// running a registered manual migration operation on a single
+// document, or by running a registered document processor.
+type Rollback struct {
+	// ID holds the _id field of the document that is the subject
+	// of the rollback. Rollbacks that use a document processor do
+	// not target a single document and leave this unset.
+	ID interface{} `bson:"id,omitempty" json:"id,omitempty" yaml:"id,omitempty"`
+
+	// IDs holds the _id fields of the documents that are the
+	// subject of a rollback that applies its Update to a batch of
+	// documents, and is used instead of ID.
+	IDs []interface{} `bson:"ids,omitempty" json:"ids,omitempty" yaml:"ids,omitempty"`
+
+	// Update, OperationName, and ProcessorName specify the
+	// inverse operation. Only one of these should be set.
+	Update        map[string]interface{} `bson:"update,omitempty" json:"update,omitempty" yaml:"update,omitempty"`
+	OperationName string                 `bson:"op_name,omitempty" json:"op_name,omitempty" yaml:"op_name,omitempty"`
+	ProcessorName string                 `bson:"producer,omitempty" json:"producer,omitempty" yaml:"producer,omitempty"`
+
+	// Query is passed to the document processor, and is typically
+	// the query of the original migration.
+	Query map[string]interface{} `bson:"query,omitempty" json:"query,omitempty" yaml:"query,omitempty"`
+
+	// Migration holds the ID of the migration that this operation
+	// rolls back.
+	Migration string `bson:"migration_id" json:"migration_id" yaml:"migration_id"`
+
+	// Events holds the IDs of the migration metadata documents
+	// that record the migration operations this rollback
+	// reverses. These are marked as rolled back when the rollback
+	// succeeds.
+	Events []string `bson:"events" json:"events" yaml:"events"`
+
+	// Namespace holds a struct that describes which database and
+	// collection where the rollback should run.
+	Namespace Namespace `bson:"namespace" json:"namespace" yaml:"namespace"`
+
+	// Params holds the settings of the migration from its
+	// configuration, which are passed to the operation or
+	// processor.
+	Params map[string]string `bson:"params,omitempty" json:"params,omitempty" yaml:"params,omitempty"`
+}
+
+// Verification defines a check of the documents that a migration
+// modified, which runs after all of the migration's operations
+// complete.
+type Verification struct {
+	// Migration holds the ID of the migration that the
+	// verification checks.
+	Migration string `bson:"migration_id" json:"migration_id" yaml:"migration_id"`
+
+	// Namespace holds a struct that describes which database and
+	// collection the migration modified.
+	Namespace Namespace `bson:"namespace" json:"namespace" yaml:"namespace"`
+
+	// Query must not match any documents in the namespace.
+	Query map[string]interface{} `bson:"query,omitempty" json:"query,omitempty" yaml:"query,omitempty"`
+
+	// Name is the name of a registered Verification function.
+	Name string `bson:"name,omitempty" json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Partial is set when the migration only modified some of the
+	// documents that match its generator's query, for example
+	// because of a canary or a limit. Partial verifications only
+	// check the documents that the migration's operations modified.
+	Partial bool `bson:"partial,omitempty" json:"partial,omitempty" yaml:"partial,omitempty"`
 }
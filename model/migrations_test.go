@@ -2,6 +2,7 @@ package model
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -19,4 +20,22 @@ func TestMigrationMetadata(t *testing.T) {
 
 	meta.HasErrors = true
 	assert.False(meta.Satisfied())
+
+	meta.HasErrors = false
+	meta.RolledBack = true
+	assert.False(meta.Satisfied())
+}
+
+func TestMigrationStatusState(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(MigrationStatePending, MigrationStatus{}.State())
+	assert.Equal(MigrationStateGenerating, MigrationStatus{StartedAt: time.Now()}.State())
+	assert.Equal(MigrationStateRunning, MigrationStatus{GeneratorCompleted: true, Generated: 2, Completed: 1, Pending: 1}.State())
+	assert.Equal(MigrationStateCompleted, MigrationStatus{GeneratorCompleted: true, Generated: 2, Completed: 2}.State())
+	assert.Equal(MigrationStateFailed, MigrationStatus{GeneratorCompleted: true, Generated: 2, Completed: 1, Failed: 1}.State())
+	assert.Equal(MigrationStateFailed, MigrationStatus{GeneratorCompleted: true, Generated: 2, Completed: 2, Verification: VerificationFailed}.State())
+	assert.Equal(MigrationStateCompleted, MigrationStatus{GeneratorCompleted: true, Generated: 2, Completed: 2, Verification: VerificationPassed}.State())
+	assert.Equal(MigrationStateRolledBack, MigrationStatus{GeneratorCompleted: true, Generated: 2, Completed: 2, RolledBack: 2}.State())
+	assert.Equal(MigrationStateCompleted, MigrationStatus{GeneratorCompleted: true, Generated: 2, Completed: 2, RolledBack: 1}.State())
 }
@@ -0,0 +1,376 @@
+package anser
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/model"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrationLimiters holds the limiters of the migrations in this
+// process, by environment and migration ID, so that all of a
+// migration's operations share the same limits regardless of which
+// worker runs them. Limiters are released when the application that
+// runs the migrations completes, or when the environment closes.
+var migrationLimiters = struct {
+	sync.Mutex
+	limiters map[limiterKey]*migrationLimiter
+	closers  map[Environment]bool
+}{
+	limiters: map[limiterKey]*migrationLimiter{},
+	closers:  map[Environment]bool{},
+}
+
+type limiterKey struct {
+	env       Environment
+	migration string
+}
+
+// migrationLimiter throttles the operations of a migration. A nil
+// migrationLimiter does not limit anything, so migrations without
+// rate limits can use the limiter unconditionally.
+type migrationLimiter struct {
+	opts         model.RateLimit
+	documents    *tokenBucket
+	writes       *tokenBucket
+	jobs         chan struct{}
+	backpressure *backpressureMonitor
+}
+
+// getMigrationLimiter returns the limiter for the migration, creating
+// it if it does not exist or if the migration's limits changed. It
+// returns nil if the migration has no limits. The limiter applies
+// backpressure using the environment's load source.
+func getMigrationLimiter(env Environment, migration string, opts *model.RateLimit) *migrationLimiter {
+	if opts == nil || opts.IsZero() {
+		return nil
+	}
+
+	key := limiterKey{env: env, migration: migration}
+	if lim := findMigrationLimiter(key, *opts); lim != nil {
+		return lim
+	}
+
+	// the environment holds its lock while it closes, and closing
+	// releases the limiters, so the limiter is built, and the
+	// closer registered, without holding the limiters' lock.
+	lim, register := storeMigrationLimiter(key, newMigrationLimiter(env, migration, *opts))
+	if register {
+		env.RegisterCloser(func() error {
+			releaseMigrationLimiters(env)
+			return nil
+		})
+	}
+
+	return lim
+}
+
+func newMigrationLimiter(env Environment, migration string, opts model.RateLimit) *migrationLimiter {
+	lim := &migrationLimiter{
+		opts:      opts,
+		documents: newTokenBucket(opts.DocumentsPerSecond),
+		writes:    newTokenBucket(opts.WritesPerSecond),
+	}
+	if opts.MaxConcurrentJobs > 0 {
+		lim.jobs = make(chan struct{}, opts.MaxConcurrentJobs)
+	}
+	if !opts.Backpressure.IsZero() {
+		lim.backpressure = newBackpressureMonitor(env, migration, opts.Backpressure)
+	}
+
+	return lim
+}
+
+// findMigrationLimiter returns the migration's limiter, if it exists
+// and has the same limits.
+func findMigrationLimiter(key limiterKey, opts model.RateLimit) *migrationLimiter {
+	migrationLimiters.Lock()
+	defer migrationLimiters.Unlock()
+
+	if lim, ok := migrationLimiters.limiters[key]; ok && lim.opts == opts {
+		return lim
+	}
+
+	return nil
+}
+
+// storeMigrationLimiter stores the limiter for the migration, unless
+// another operation stored a limiter with the same limits first, and
+// returns the stored limiter. It also reports whether the environment
+// needs a closer to release its limiters.
+func storeMigrationLimiter(key limiterKey, lim *migrationLimiter) (*migrationLimiter, bool) {
+	migrationLimiters.Lock()
+	defer migrationLimiters.Unlock()
+
+	if existing, ok := migrationLimiters.limiters[key]; ok && existing.opts == lim.opts {
+		return existing, false
+	}
+	migrationLimiters.limiters[key] = lim
+
+	if key.env == nil || migrationLimiters.closers[key.env] {
+		return lim, false
+	}
+	migrationLimiters.closers[key.env] = true
+
+	return lim, true
+}
+
+// releaseMigrationLimiters releases the limiters of the migrations in
+// the environment, or all of the environment's limiters if there are
+// no migrations. Operations that run after their limiter is released
+// share a new limiter.
+func releaseMigrationLimiters(env Environment, migrations ...string) {
+	migrationLimiters.Lock()
+	defer migrationLimiters.Unlock()
+
+	if len(migrations) > 0 {
+		for _, migration := range migrations {
+			delete(migrationLimiters.limiters, limiterKey{env: env, migration: migration})
+		}
+		return
+	}
+
+	for key := range migrationLimiters.limiters {
+		if key.env == env {
+			delete(migrationLimiters.limiters, key)
+		}
+	}
+	delete(migrationLimiters.closers, env)
+}
+
+// start blocks until the cluster is not under stress and the
+// migration has fewer than its maximum number of concurrent jobs
+// running. Callers must call finish when the job completes if start
+// does not return an error.
+func (l *migrationLimiter) start(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	if err := l.backpressure.wait(ctx); err != nil {
+		return err
+	}
+
+	if l.jobs == nil {
+		return nil
+	}
+
+	select {
+	case l.jobs <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "waiting for concurrent migration jobs")
+	}
+}
+
+func (l *migrationLimiter) finish() {
+	if l == nil || l.jobs == nil {
+		return
+	}
+
+	<-l.jobs
+}
+
+// waitDocuments blocks until the migration may process n documents.
+func (l *migrationLimiter) waitDocuments(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	if err := l.backpressure.wait(ctx); err != nil {
+		return err
+	}
+
+	return errors.Wrap(l.documents.wait(ctx, n), "waiting for document rate limit")
+}
+
+// waitWrites blocks until the migration may issue n writes.
+func (l *migrationLimiter) waitWrites(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	if err := l.backpressure.wait(ctx); err != nil {
+		return err
+	}
+
+	return errors.Wrap(l.writes.wait(ctx, n), "waiting for write rate limit")
+}
+
+// client wraps the client so that its writes honor the migration's
+// write rate limit and backpressure.
+func (l *migrationLimiter) client(cl client.Client) client.Client {
+	if l == nil || (l.writes == nil && l.backpressure == nil) {
+		return cl
+	}
+
+	return &rateLimitedClient{Client: cl, limiter: l}
+}
+
+// cursor wraps the cursor so that iterating over it honors the
+// migration's document rate limit and backpressure.
+func (l *migrationLimiter) cursor(cur client.Cursor) client.Cursor {
+	if l == nil || (l.documents == nil && l.backpressure == nil) || cur == nil {
+		return cur
+	}
+
+	return &rateLimitedCursor{Cursor: cur, limiter: l}
+}
+
+// tokenBucket is a token bucket rate limiter that allows bursts of up
+// to one second of its rate. A nil tokenBucket does not limit
+// anything.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+
+	burst := math.Max(rate, 1)
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// wait takes n tokens from the bucket, blocking until the bucket
+// would have had enough tokens. Callers take their tokens in the
+// order that they call wait, so large requests are not starved by
+// small ones.
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	if b == nil || n <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type rateLimitedClient struct {
+	client.Client
+	limiter *migrationLimiter
+}
+
+func (c *rateLimitedClient) Database(name string) client.Database {
+	return &rateLimitedDatabase{Database: c.Client.Database(name), client: c}
+}
+
+type rateLimitedDatabase struct {
+	client.Database
+	client *rateLimitedClient
+}
+
+func (d *rateLimitedDatabase) Client() client.Client { return d.client }
+func (d *rateLimitedDatabase) Collection(name string) client.Collection {
+	return &rateLimitedCollection{Collection: d.Database.Collection(name), limiter: d.client.limiter}
+}
+
+type rateLimitedCollection struct {
+	client.Collection
+	limiter *migrationLimiter
+}
+
+func (c *rateLimitedCollection) BulkWrite(ctx context.Context, models []client.WriteModel, opts ...*options.BulkWriteOptions) (*client.BulkWriteResult, error) {
+	if err := c.limiter.waitWrites(ctx, len(models)); err != nil {
+		return nil, err
+	}
+	return c.Collection.BulkWrite(ctx, models, opts...)
+}
+
+func (c *rateLimitedCollection) InsertMany(ctx context.Context, docs []interface{}) (*client.InsertManyResult, error) {
+	if err := c.limiter.waitWrites(ctx, len(docs)); err != nil {
+		return nil, err
+	}
+	return c.Collection.InsertMany(ctx, docs)
+}
+
+func (c *rateLimitedCollection) InsertOne(ctx context.Context, doc interface{}) (*client.InsertOneResult, error) {
+	if err := c.limiter.waitWrites(ctx, 1); err != nil {
+		return nil, err
+	}
+	return c.Collection.InsertOne(ctx, doc)
+}
+
+func (c *rateLimitedCollection) ReplaceOne(ctx context.Context, query, doc interface{}, opts ...*options.ReplaceOptions) (*client.UpdateResult, error) {
+	if err := c.limiter.waitWrites(ctx, 1); err != nil {
+		return nil, err
+	}
+	return c.Collection.ReplaceOne(ctx, query, doc, opts...)
+}
+
+func (c *rateLimitedCollection) UpdateMany(ctx context.Context, query, update interface{}, opts ...*options.UpdateOptions) (*client.UpdateResult, error) {
+	if err := c.limiter.waitWrites(ctx, 1); err != nil {
+		return nil, err
+	}
+	return c.Collection.UpdateMany(ctx, query, update, opts...)
+}
+
+func (c *rateLimitedCollection) UpdateOne(ctx context.Context, query, update interface{}, opts ...*options.UpdateOptions) (*client.UpdateResult, error) {
+	if err := c.limiter.waitWrites(ctx, 1); err != nil {
+		return nil, err
+	}
+	return c.Collection.UpdateOne(ctx, query, update, opts...)
+}
+
+type rateLimitedCursor struct {
+	client.Cursor
+	limiter *migrationLimiter
+	err     error
+}
+
+func (c *rateLimitedCursor) Next(ctx context.Context) bool {
+	if c.err != nil {
+		return false
+	}
+
+	if !c.Cursor.Next(ctx) {
+		return false
+	}
+
+	if c.err = c.limiter.waitDocuments(ctx, 1); c.err != nil {
+		return false
+	}
+
+	return true
+}
+
+func (c *rateLimitedCursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+
+	return c.Cursor.Err()
+}
@@ -0,0 +1,123 @@
+package anser
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationLimiter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env := mock.NewEnvironment()
+
+	t.Run("NoLimits", func(t *testing.T) {
+		assert.Nil(t, getMigrationLimiter(env, "none", nil))
+		assert.Nil(t, getMigrationLimiter(env, "none", &model.RateLimit{}))
+
+		var limiter *migrationLimiter
+		assert.NoError(t, limiter.start(ctx))
+		limiter.finish()
+		assert.NoError(t, limiter.waitDocuments(ctx, 100))
+		assert.NoError(t, limiter.waitWrites(ctx, 100))
+
+		cl := mock.NewClient()
+		assert.Equal(t, client.Client(cl), limiter.client(cl))
+	})
+	t.Run("SharedByMigration", func(t *testing.T) {
+		opts := &model.RateLimit{MaxConcurrentJobs: 2}
+		limiter := getMigrationLimiter(env, "shared", opts)
+		require.NotNil(t, limiter)
+		assert.True(t, limiter == getMigrationLimiter(env, "shared", &model.RateLimit{MaxConcurrentJobs: 2}))
+		assert.False(t, limiter == getMigrationLimiter(env, "other", opts))
+		assert.False(t, limiter == getMigrationLimiter(env, "shared", &model.RateLimit{MaxConcurrentJobs: 3}))
+	})
+	t.Run("ScopedByEnvironment", func(t *testing.T) {
+		opts := &model.RateLimit{MaxConcurrentJobs: 2}
+		other := mock.NewEnvironment()
+		limiter := getMigrationLimiter(env, "scoped", opts)
+		assert.False(t, limiter == getMigrationLimiter(other, "scoped", opts))
+		require.Len(t, other.Closers, 1)
+
+		// environments register one closer for all of their limiters.
+		getMigrationLimiter(other, "another", opts)
+		assert.Len(t, other.Closers, 1)
+
+		require.NoError(t, other.Close())
+		assert.True(t, limiter == getMigrationLimiter(env, "scoped", opts))
+	})
+	t.Run("Release", func(t *testing.T) {
+		opts := &model.RateLimit{MaxConcurrentJobs: 2}
+		limiter := getMigrationLimiter(env, "released", opts)
+		kept := getMigrationLimiter(env, "kept", opts)
+
+		releaseMigrationLimiters(env, "released")
+		assert.False(t, limiter == getMigrationLimiter(env, "released", opts))
+		assert.True(t, kept == getMigrationLimiter(env, "kept", opts))
+
+		releaseMigrationLimiters(env)
+		assert.False(t, kept == getMigrationLimiter(env, "kept", opts))
+	})
+	t.Run("MaxConcurrentJobs", func(t *testing.T) {
+		limiter := getMigrationLimiter(env, "concurrent", &model.RateLimit{MaxConcurrentJobs: 1})
+		require.NoError(t, limiter.start(ctx))
+
+		tctx, tcancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer tcancel()
+		assert.Error(t, limiter.start(tctx))
+
+		limiter.finish()
+		assert.NoError(t, limiter.start(ctx))
+		limiter.finish()
+	})
+	t.Run("DocumentsPerSecond", func(t *testing.T) {
+		limiter := getMigrationLimiter(env, "documents", &model.RateLimit{DocumentsPerSecond: 100})
+
+		// the first second's worth of documents does not wait
+		start := time.Now()
+		require.NoError(t, limiter.waitDocuments(ctx, 100))
+		assert.True(t, time.Since(start) < 50*time.Millisecond)
+
+		start = time.Now()
+		require.NoError(t, limiter.waitDocuments(ctx, 10))
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+		tctx, tcancel := context.WithTimeout(ctx, time.Millisecond)
+		defer tcancel()
+		assert.Error(t, limiter.waitDocuments(tctx, 100))
+	})
+	t.Run("WritesPerSecond", func(t *testing.T) {
+		limiter := getMigrationLimiter(env, "writes", &model.RateLimit{WritesPerSecond: 1})
+
+		cl := mock.NewClient()
+		coll := limiter.client(cl).Database("foo").Collection("bar")
+		_, ok := coll.(*rateLimitedCollection)
+		require.True(t, ok)
+
+		_, err := coll.UpdateOne(ctx, map[string]interface{}{}, map[string]interface{}{})
+		require.NoError(t, err)
+
+		tctx, tcancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer tcancel()
+		_, err = coll.UpdateOne(tctx, map[string]interface{}{}, map[string]interface{}{})
+		assert.Error(t, err)
+	})
+	t.Run("Cursor", func(t *testing.T) {
+		limiter := getMigrationLimiter(env, "cursor", &model.RateLimit{DocumentsPerSecond: 1})
+		cursor := limiter.cursor(&mock.Cursor{ShouldIter: true, MaxNextCalls: 10})
+
+		assert.True(t, cursor.Next(ctx))
+
+		tctx, tcancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer tcancel()
+		assert.False(t, cursor.Next(tctx))
+		assert.Error(t, cursor.Err())
+		assert.False(t, cursor.Next(ctx))
+	})
+}
@@ -0,0 +1,225 @@
+package anser
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mongodb/anser/client"
+	"github.com/mongodb/anser/model"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// snapshotCollection returns the name of the collection in the
+// metadata database that holds the before-images of the documents that
+// the migration changed.
+func snapshotCollection(migration string) string {
+	return fmt.Sprintf("migrations.snapshots.%s", migration)
+}
+
+// Snapshot holds a copy of a document from before a migration changed
+// it. Snapshots are only recorded the first time that a migration
+// changes a document, so that migration operations that run more than
+// once do not replace the original document. Snapshots with an
+// ExpiresAt time are removed by the server after that time.
+type Snapshot struct {
+	ID        SnapshotID      `bson:"_id" json:"id" yaml:"id"`
+	Namespace model.Namespace `bson:"namespace" json:"namespace" yaml:"namespace"`
+	Document  bson.Raw        `bson:"document" json:"document" yaml:"document"`
+	CreatedAt time.Time       `bson:"created_at" json:"created_at" yaml:"created_at"`
+	ExpiresAt time.Time       `bson:"expires_at,omitempty" json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+}
+
+// SnapshotID identifies the snapshot of a document by the document's
+// namespace and _id.
+type SnapshotID struct {
+	Namespace string      `bson:"ns" json:"ns" yaml:"ns"`
+	ID        interface{} `bson:"id" json:"id" yaml:"id"`
+}
+
+// ensureSnapshotIndex creates the index that removes the migration's
+// snapshots after they expire.
+func ensureSnapshotIndex(ctx context.Context, env Environment, migration string) error {
+	cl, err := env.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "getting database client")
+	}
+
+	res := cl.Database(env.MetadataNamespace().DB).RunCommand(ctx, bson.D{
+		{Key: "createIndexes", Value: snapshotCollection(migration)},
+		{Key: "indexes", Value: []bson.M{{
+			"key":                bson.M{"expires_at": 1},
+			"name":               "expires_at_1",
+			"expireAfterSeconds": 0,
+		}}},
+	})
+
+	return errors.Wrapf(res.Err(), "creating snapshot index for migration '%s'", migration)
+}
+
+// saveSnapshot records a copy of the document in the migration's
+// snapshot collection, unless the collection already holds a copy of
+// the document.
+func saveSnapshot(ctx context.Context, env Environment, migration string, ns model.Namespace, opts *model.SnapshotOptions, doc bson.Raw) error {
+	id, err := doc.LookupErr("_id")
+	if err != nil {
+		return errors.Wrap(err, "finding _id of document to snapshot")
+	}
+
+	cl, err := env.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "getting database client")
+	}
+
+	now := time.Now()
+	snapshot := bson.M{
+		"namespace":  ns,
+		"document":   doc,
+		"created_at": now,
+	}
+	if opts.TTLSeconds > 0 {
+		snapshot["expires_at"] = now.Add(time.Duration(opts.TTLSeconds) * time.Second)
+	}
+
+	coll := cl.Database(env.MetadataNamespace().DB).Collection(snapshotCollection(migration))
+	_, err = coll.UpdateOne(ctx,
+		bson.M{"_id": SnapshotID{Namespace: ns.String(), ID: id}},
+		bson.M{"$setOnInsert": snapshot},
+		options.Update().SetUpsert(true))
+
+	return errors.Wrapf(err, "saving snapshot of document '%s' in '%s'", id, ns)
+}
+
+// snapshotCursor saves a snapshot of the complete document in the
+// namespace for each document of the cursor, before the cursor
+// returns the document.
+type snapshotCursor struct {
+	client.Cursor
+	env       Environment
+	coll      client.Collection
+	migration string
+	ns        model.Namespace
+	opts      *model.SnapshotOptions
+	err       error
+}
+
+// newSnapshotCursor wraps the cursor of a stream migration so that it
+// saves a snapshot of each document before the migration's processor
+// sees it.
+func newSnapshotCursor(env Environment, cl client.Client, def model.Stream, cur client.Cursor) client.Cursor {
+	if def.Snapshot == nil || cur == nil {
+		return cur
+	}
+
+	return &snapshotCursor{
+		Cursor:    cur,
+		env:       env,
+		coll:      cl.Database(def.Namespace.DB).Collection(def.Namespace.Collection),
+		migration: def.Migration,
+		ns:        def.Namespace,
+		opts:      def.Snapshot,
+	}
+}
+
+func (c *snapshotCursor) Next(ctx context.Context) bool {
+	if c.err != nil || !c.Cursor.Next(ctx) {
+		return false
+	}
+
+	current := bson.Raw{}
+	if err := c.Cursor.Decode(&current); err != nil {
+		c.err = errors.Wrap(err, "decoding document to snapshot")
+		return false
+	}
+
+	id, err := current.LookupErr("_id")
+	if err != nil {
+		c.err = errors.Wrap(err, "finding _id of document to snapshot")
+		return false
+	}
+
+	// the processor's cursor may not hold the whole document, so
+	// the snapshot holds the document from the namespace.
+	res := c.coll.FindOne(ctx, bson.M{"_id": id})
+	if err = res.Err(); err == mongo.ErrNoDocuments {
+		return true
+	} else if err != nil {
+		c.err = errors.Wrapf(err, "finding document '%s' to snapshot", id)
+		return false
+	}
+
+	doc, err := res.Raw()
+	if err != nil {
+		c.err = errors.Wrapf(err, "reading document '%s' to snapshot", id)
+		return false
+	}
+
+	c.err = saveSnapshot(ctx, c.env, c.migration, c.ns, c.opts, doc)
+	return c.err == nil
+}
+
+func (c *snapshotCursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+
+	return c.Cursor.Err()
+}
+
+// RestoreSnapshots replaces documents with the snapshots that the
+// migration recorded before it changed them, and returns the number of
+// documents that it restored. If the namespace is set, RestoreSnapshots
+// only restores documents in the namespace, and if there are ids, it
+// only restores the documents with those _id values. Documents that
+// the migration removed are inserted again. RestoreSnapshots does not
+// remove the snapshots, so documents can be restored more than once.
+func RestoreSnapshots(ctx context.Context, env Environment, migration string, ns model.Namespace, ids ...interface{}) (int, error) {
+	if migration == "" {
+		return 0, errors.New("cannot restore snapshots without a migration")
+	}
+
+	cl, err := env.GetClient()
+	if err != nil {
+		return 0, errors.Wrap(err, "getting database client")
+	}
+
+	filter := bson.M{}
+	if ns.IsValid() {
+		filter["_id.ns"] = ns.String()
+	}
+	if len(ids) > 0 {
+		filter["_id.id"] = bson.M{"$in": ids}
+	}
+
+	cursor, err := cl.Database(env.MetadataNamespace().DB).Collection(snapshotCollection(migration)).Find(ctx, filter)
+	if err != nil {
+		return 0, errors.Wrapf(err, "finding snapshots of migration '%s'", migration)
+	}
+
+	count := 0
+	catcher := grip.NewBasicCatcher()
+	for cursor.Next(ctx) {
+		snapshot := Snapshot{}
+		if err = cursor.Decode(&snapshot); err != nil {
+			catcher.Wrap(err, "decoding snapshot")
+			continue
+		}
+
+		coll := cl.Database(snapshot.Namespace.DB).Collection(snapshot.Namespace.Collection)
+		_, err = coll.ReplaceOne(ctx, bson.M{"_id": snapshot.Document.Lookup("_id")}, snapshot.Document, options.Replace().SetUpsert(true))
+		if err != nil {
+			catcher.Wrapf(err, "restoring document '%v' in '%s'", snapshot.ID.ID, snapshot.Namespace)
+			continue
+		}
+		count++
+	}
+
+	catcher.Add(cursor.Err())
+	catcher.Add(cursor.Close(ctx))
+
+	return count, catcher.Resolve()
+}
@@ -0,0 +1,128 @@
+package anser
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/anser/mock"
+	"github.com/mongodb/anser/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ns := model.Namespace{DB: "foo", Collection: "bar"}
+	marshal := func(t *testing.T, doc bson.M) bson.Raw {
+		out, err := bson.Marshal(doc)
+		require.NoError(t, err)
+		return out
+	}
+	doc := marshal(t, bson.M{"_id": "one", "a": 1})
+
+	setup := func(t *testing.T) (*mock.Environment, *mock.Collection, *mock.Collection) {
+		source := &mock.Collection{SingleResult: &mock.SingleResult{DecodeBytesValue: doc}}
+		snapshots := &mock.Collection{}
+
+		env := mock.NewEnvironment()
+		env.MetaNS = model.Namespace{DB: "anser", Collection: "migrations.metadata"}
+		env.Client = mock.NewClient()
+		env.Client.Databases["anser"] = &mock.Database{DBName: "anser", Collections: map[string]*mock.Collection{snapshotCollection("migration"): snapshots}}
+		env.Client.Databases["foo"] = &mock.Database{DBName: "foo", Collections: map[string]*mock.Collection{"bar": source}}
+		return env, source, snapshots
+	}
+
+	t.Run("Save", func(t *testing.T) {
+		env, _, snapshots := setup(t)
+		require.NoError(t, saveSnapshot(ctx, env, "migration", ns, &model.SnapshotOptions{}, doc))
+		require.Len(t, snapshots.Updates, 1)
+		snapshot := snapshots.Updates[0].(bson.M)["$setOnInsert"].(bson.M)
+		assert.Equal(t, ns, snapshot["namespace"])
+		assert.Equal(t, doc, snapshot["document"])
+		assert.NotContains(t, snapshot, "expires_at")
+
+		require.NoError(t, saveSnapshot(ctx, env, "migration", ns, &model.SnapshotOptions{TTLSeconds: 60}, doc))
+		require.Len(t, snapshots.Updates, 2)
+		snapshot = snapshots.Updates[1].(bson.M)["$setOnInsert"].(bson.M)
+		assert.Equal(t, time.Minute, snapshot["expires_at"].(time.Time).Sub(snapshot["created_at"].(time.Time)))
+
+		assert.Error(t, saveSnapshot(ctx, env, "migration", ns, &model.SnapshotOptions{}, marshal(t, bson.M{"a": 1})))
+	})
+	t.Run("Index", func(t *testing.T) {
+		env, _, _ := setup(t)
+		require.NoError(t, ensureSnapshotIndex(ctx, env, "migration"))
+
+		env.Client.Databases["anser"].Commands = map[string]*mock.SingleResult{"createIndexes": {ErrorValue: errors.New("index failed")}}
+		err := ensureSnapshotIndex(ctx, env, "migration")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "index failed")
+	})
+	t.Run("Cursor", func(t *testing.T) {
+		env, source, snapshots := setup(t)
+		projected := marshal(t, bson.M{"_id": "one"})
+		def := model.Stream{Migration: "migration", Namespace: ns}
+		cursor := &mock.Cursor{ShouldIter: true, MaxNextCalls: 2, Results: []interface{}{&projected}}
+
+		assert.Equal(t, cursor, newSnapshotCursor(env, env.Client, def, cursor))
+
+		def.Snapshot = &model.SnapshotOptions{}
+		wrapped := newSnapshotCursor(env, env.Client, def, cursor)
+		require.True(t, wrapped.Next(ctx))
+		require.Len(t, snapshots.Updates, 1)
+		assert.Equal(t, doc, snapshots.Updates[0].(bson.M)["$setOnInsert"].(bson.M)["document"])
+		assert.False(t, wrapped.Next(ctx))
+		assert.NoError(t, wrapped.Err())
+
+		source.SingleResult.ErrorValue = mongo.ErrNoDocuments
+		cursor = &mock.Cursor{ShouldIter: true, MaxNextCalls: 2, Results: []interface{}{&projected}}
+		wrapped = newSnapshotCursor(env, env.Client, def, cursor)
+		assert.True(t, wrapped.Next(ctx))
+		assert.Len(t, snapshots.Updates, 1)
+
+		snapshots.UpdateError = errors.New("write failed")
+		source.SingleResult.ErrorValue = nil
+		cursor = &mock.Cursor{ShouldIter: true, MaxNextCalls: 2, Results: []interface{}{&projected}}
+		wrapped = newSnapshotCursor(env, env.Client, def, cursor)
+		assert.False(t, wrapped.Next(ctx))
+		require.Error(t, wrapped.Err())
+		assert.Contains(t, wrapped.Err().Error(), "write failed")
+	})
+	t.Run("Restore", func(t *testing.T) {
+		env, source, snapshots := setup(t)
+
+		_, err := RestoreSnapshots(ctx, env, "", ns)
+		assert.Error(t, err)
+
+		snapshots.FindCursor = &mock.Cursor{
+			ShouldIter:   true,
+			MaxNextCalls: 2,
+			Results: []interface{}{
+				&Snapshot{ID: SnapshotID{Namespace: ns.String(), ID: "one"}, Namespace: ns, Document: doc},
+			},
+		}
+		count, err := RestoreSnapshots(ctx, env, "migration", ns, "one")
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		require.Len(t, source.Updates, 1)
+		assert.Equal(t, doc, source.Updates[0])
+
+		source.UpdateError = errors.New("write failed")
+		snapshots.FindCursor = &mock.Cursor{
+			ShouldIter:   true,
+			MaxNextCalls: 2,
+			Results: []interface{}{
+				&Snapshot{ID: SnapshotID{Namespace: ns.String(), ID: "one"}, Namespace: ns, Document: doc},
+			},
+		}
+		count, err = RestoreSnapshots(ctx, env, "migration", model.Namespace{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "restoring document 'one' in 'foo.bar'")
+		assert.Zero(t, count)
+	})
+}